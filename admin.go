@@ -0,0 +1,128 @@
+package livenet
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Paths of the admin API.
+const (
+	adminFaults     = "/faults/"
+	adminPartitions = "/partitions/"
+)
+
+// Serve the admin API on the address until the server stops listening, on
+// localhost if the address does not specify a host. If tokens are configured,
+// requests must carry one of them as a bearer token in the Authorization
+// header. The admin API controls fault injection at runtime with JSON requests:
+//
+//	GET    /faults/            the faults injected on links by peer name
+//	PUT    /faults/{peer}      set the faults of the link to the peer or * for all
+//	DELETE /faults/{peer}      stop injecting faults on the link to the peer
+//	GET    /partitions/        the names of the partitioned peers
+//	PUT    /partitions/{peer}  partition the peer
+//	DELETE /partitions/{peer}  heal the partition from the peer
+func (s *Server) serveAdmin(addr string) (*http.Server, error) {
+	addr = adminAddr(addr)
+	sock, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &http.Server{Handler: s.adminHandler()}
+	go srv.Serve(sock)
+
+	info("admin api listening on %s", addr)
+	return srv, nil
+}
+
+// Returns the address to serve the admin API on, binding to localhost if the
+// address does not specify a host so that it is not exposed to the network.
+func adminAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != "" {
+		return addr
+	}
+	return net.JoinHostPort("localhost", port)
+}
+
+// Returns the handler of the admin API, which rejects requests without one of
+// the configured tokens.
+func (s *Server) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(adminFaults, s.handleFaults)
+	mux.HandleFunc(adminPartitions, s.handlePartitions)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		md := metadata.MD{}
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			md = metadata.Pairs(mdToken, strings.TrimPrefix(auth, "Bearer "))
+		}
+
+		if !authenticate(s.config, md) {
+			caution("rejected admin request from %s with invalid token", r.RemoteAddr)
+			http.Error(w, "invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Handle the requests to get, set, and clear the faults of links.
+func (s *Server) handleFaults(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, adminFaults)
+	switch {
+	case r.Method == http.MethodGet && name == "":
+	case r.Method == http.MethodPut && name != "":
+		spec := LinkFaults{}
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := s.InjectFaults(name, spec); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		info("injecting faults on link to %s", name)
+	case r.Method == http.MethodDelete && name != "":
+		s.ClearFaults(name)
+		info("cleared faults on link to %s", name)
+	default:
+		http.Error(w, "unknown admin request", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, s.Faults())
+}
+
+// Handle the requests to get, create, and heal partitions.
+func (s *Server) handlePartitions(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, adminPartitions)
+	switch {
+	case r.Method == http.MethodGet && name == "":
+	case r.Method == http.MethodPut && name != "":
+		s.Partition(name)
+		info("partitioned from %s", name)
+	case r.Method == http.MethodDelete && name != "":
+		s.Heal(name)
+		info("healed partition from %s", name)
+	default:
+		http.Error(w, "unknown admin request", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, s.Partitioned())
+}
+
+// Write the value as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		warne(err)
+	}
+}
@@ -0,0 +1,271 @@
+package livenet
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+// Store is a keyed application state store that is reconciled with the stores
+// registered under the same name on remote hosts by anti-entropy. Stores are
+// read and merged from the event loop while the application may modify them
+// concurrently, so implementations must be thread-safe.
+//
+// When the value of a key differs between two hosts, each host merges the
+// value of the other, so Merge must be commutative (e.g. last writer wins or
+// a CRDT join) for the stores to converge.
+type Store interface {
+	Keys() []string                         // all keys currently in the store
+	Get(key string) (value []byte, ok bool) // the value of a key
+	Merge(key string, value []byte) error   // reconcile the value of a remote host
+}
+
+// stores maintains the state stores registered by the application by name.
+type stores struct {
+	sync.RWMutex
+	registered map[string]Store
+}
+
+//===========================================================================
+// Server Anti-Entropy API
+//===========================================================================
+
+// Register a state store with anti-entropy under the specified name. The
+// store is reconciled with the stores of the same name on remote hosts when a
+// remote comes online and periodically on the anti-entropy interval.
+func (s *Server) Register(name string, store Store) error {
+	s.stores.Lock()
+	defer s.stores.Unlock()
+
+	if s.stores.registered == nil {
+		s.stores.registered = make(map[string]Store)
+	}
+
+	if _, ok := s.stores.registered[name]; ok {
+		return fmt.Errorf("a store named '%s' is already registered", name)
+	}
+
+	s.stores.registered[name] = store
+	return nil
+}
+
+// Unregister removes the state store with the specified name from
+// anti-entropy, returning false if no such store is registered.
+func (s *Server) Unregister(name string) bool {
+	s.stores.Lock()
+	defer s.stores.Unlock()
+
+	if _, ok := s.stores.registered[name]; !ok {
+		return false
+	}
+
+	delete(s.stores.registered, name)
+	return true
+}
+
+//===========================================================================
+// Anti-Entropy Event Handlers
+//===========================================================================
+
+// Reconcile the stores with a randomly selected online remote.
+func (s *Server) onAntiEntropyTimeout(e Event) error {
+	online := make([]*Remote, 0, len(s.remotes))
+	for _, remote := range s.remotes {
+		if remote.Online() {
+			online = append(online, remote)
+		}
+	}
+
+	if len(online) == 0 {
+		return nil
+	}
+
+	return s.reconcile(online[rand.Intn(len(online))])
+}
+
+// Begin a reconciliation of every registered store with the remote by sending
+// the root of the Merkle tree of each store.
+func (s *Server) reconcile(remote *Remote) error {
+	for _, name := range s.storeNames() {
+		store, ok := s.store(name)
+		if !ok {
+			continue
+		}
+
+		tree := newMerkle(store)
+		req := &pb.Sync{
+			Store: name,
+			Nodes: []*pb.MerkleNode{{Level: 0, Index: 0, Hash: tree.Hash(0, 0)}},
+		}
+
+		trace("starting anti-entropy of %s with %s", name, remote.Name)
+		if err := s.sendSync(remote, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handle a sync message received either as a request on the Post stream or as
+// a reply on a Remote. The response drills down into the differing nodes of
+// the tree and exchanges the differing keys: it is sent as the reply to a
+// request, or as a new request on the remote that received a reply. The
+// exchange ends when a host has nothing more to send.
+func (s *Server) onSync(in *pb.Envelope, source interface{}) (*pb.Envelope, error) {
+	req := new(pb.Sync)
+	if err := proto.Unmarshal(in.Message, req); err != nil {
+		return nil, err
+	}
+
+	out, err := s.syncResponse(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Continue the exchange with a new request if this was a reply
+	if remote, ok := source.(*Remote); ok {
+		if out != nil {
+			return nil, s.sendSync(remote, out)
+		}
+		return nil, nil
+	}
+
+	// Reply with an empty sync message to end the exchange
+	if out == nil {
+		out = &pb.Sync{Store: req.Store}
+	}
+
+	data, err := proto.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	return pb.Wrap(s.Name, pb.MessageType_SYNC, data), nil
+}
+
+// Compute the response to a sync message, merging any entries it contains.
+// Returns nil if there is nothing more to exchange.
+func (s *Server) syncResponse(in *pb.Sync) (*pb.Sync, error) {
+	store, ok := s.store(in.Store)
+	if !ok {
+		caution("anti-entropy for unregistered store %s", in.Store)
+		return nil, nil
+	}
+
+	// Merge the values of the keys that differ on the remote host
+	for _, entry := range in.Entries {
+		if err := store.Merge(entry.Key, entry.Value); err != nil {
+			return nil, fmt.Errorf("could not merge %s in store %s: %s", entry.Key, in.Store, err)
+		}
+	}
+
+	out := &pb.Sync{Store: in.Store}
+	tree := newMerkle(store)
+
+	// Send the values of the keys that are requested
+	for _, key := range in.Wants {
+		if value, ok := store.Get(key); ok {
+			out.Entries = append(out.Entries, &pb.Entry{Key: key, Value: value})
+		}
+	}
+
+	// Drill down into the nodes that differ, sending the children of interior
+	// nodes and the key digests of the leaves. Nodes that are not in the tree
+	// are dropped.
+	for _, node := range in.Nodes {
+		if !tree.Valid(node.Level, node.Index) {
+			caution("dropped invalid merkle node %d:%d for store %s", node.Level, node.Index, in.Store)
+			continue
+		}
+
+		if !tree.Differs(node.Level, node.Index, node.Hash) {
+			continue
+		}
+
+		if node.Level < merkleDepth {
+			for _, child := range tree.Children(node.Index) {
+				out.Nodes = append(out.Nodes, &pb.MerkleNode{
+					Level: node.Level + 1, Index: child, Hash: tree.Hash(node.Level+1, child),
+				})
+			}
+			continue
+		}
+
+		out.Buckets = append(out.Buckets, node.Index)
+		for key, digest := range tree.digests[node.Index] {
+			out.Digests = append(out.Digests, &pb.Digest{Key: key, Hash: digest})
+		}
+	}
+
+	// Compare the digests of the remote keys with the local keys in the same
+	// buckets, sending local values that differ and requesting remote ones.
+	if len(in.Buckets) > 0 {
+		remote := make(map[string][]byte, len(in.Digests))
+		for _, digest := range in.Digests {
+			remote[digest.Key] = digest.Hash
+		}
+
+		for _, idx := range in.Buckets {
+			if int(idx) >= merkleLeaves {
+				continue
+			}
+
+			for key, digest := range tree.digests[idx] {
+				if !bytes.Equal(remote[key], digest) {
+					value, _ := store.Get(key)
+					out.Entries = append(out.Entries, &pb.Entry{Key: key, Value: value})
+				}
+			}
+		}
+
+		for key, digest := range remote {
+			if local, ok := tree.digests[bucket(key)][key]; !ok || !bytes.Equal(local, digest) {
+				out.Wants = append(out.Wants, key)
+			}
+		}
+		sort.Strings(out.Wants)
+	}
+
+	if len(out.Nodes) == 0 && len(out.Digests) == 0 && len(out.Buckets) == 0 && len(out.Entries) == 0 && len(out.Wants) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
+
+//===========================================================================
+// Anti-Entropy Helpers
+//===========================================================================
+
+// Send a sync message to the remote.
+func (s *Server) sendSync(remote *Remote, msg *pb.Sync) error {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return remote.Send(pb.Wrap(s.Name, pb.MessageType_SYNC, data))
+}
+
+// Returns the store registered with the name.
+func (s *Server) store(name string) (Store, bool) {
+	s.stores.RLock()
+	defer s.stores.RUnlock()
+	store, ok := s.stores.registered[name]
+	return store, ok
+}
+
+// Returns the sorted names of the registered stores.
+func (s *Server) storeNames() []string {
+	s.stores.RLock()
+	defer s.stores.RUnlock()
+
+	names := make([]string, 0, len(s.stores.registered))
+	for name := range s.stores.registered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,65 @@
+package livenet
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/bbengfort/livenet/pb"
+)
+
+// A store of the last value merged for each key.
+type testStore map[string][]byte
+
+func (s testStore) Keys() []string {
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s testStore) Get(key string) ([]byte, bool) {
+	value, ok := s[key]
+	return value, ok
+}
+
+func (s testStore) Merge(key string, value []byte) error {
+	s[key] = value
+	return nil
+}
+
+func TestSyncDropsInvalidNodes(t *testing.T) {
+	server, err := New(testConfigs(1)[0])
+	if err != nil {
+		t.Fatalf("could not create server: %s", err)
+	}
+
+	if err = server.Register("kv", testStore{"foo": []byte("bar")}); err != nil {
+		t.Fatalf("could not register store: %s", err)
+	}
+
+	in := &pb.Sync{Store: "kv", Nodes: []*pb.MerkleNode{
+		{Level: merkleDepth, Index: merkleLeaves},
+		{Level: merkleDepth, Index: 1 << 31},
+		{Level: merkleDepth + 1, Index: 0},
+		{Level: 1, Index: merkleFanout},
+		{Level: 0, Index: 0},
+	}}
+
+	out, err := server.syncResponse(in)
+	if err != nil {
+		t.Fatalf("could not respond to sync: %s", err)
+	}
+
+	// Only the root is valid and differs, so its children are sent
+	if out == nil || len(out.Nodes) != merkleFanout || len(out.Buckets) != 0 {
+		t.Errorf("expected the children of the root only, got %+v", out)
+	}
+
+	for _, node := range out.GetNodes() {
+		if node.Level != 1 {
+			t.Errorf("unexpected node %d:%d in response", node.Level, node.Index)
+		}
+	}
+}
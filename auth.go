@@ -0,0 +1,65 @@
+package livenet
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// Metadata key of the shared secret that authenticates the streams of peers.
+const mdToken = "livenet-token"
+
+// GetTokens returns the shared secrets that authenticate peers, or an error
+// if a token is empty. The first token is sent to peers and any of them is
+// accepted, so that tokens can be rotated by adding the new token to all
+// hosts, moving it to the front, then removing the old token.
+func (c *Config) GetTokens() ([]string, error) {
+	for _, token := range c.Tokens {
+		if token == "" {
+			return nil, errors.New("cluster tokens cannot be empty")
+		}
+	}
+	return c.Tokens, nil
+}
+
+// Returns the metadata with the token to send to peers, empty if none.
+func clusterToken(config *Config) metadata.MD {
+	if len(config.Tokens) == 0 {
+		return metadata.MD{}
+	}
+	return metadata.Pairs(mdToken, config.Tokens[0])
+}
+
+// Returns true if the metadata contains one of the configured tokens or if no
+// tokens are configured.
+func authenticate(config *Config, md metadata.MD) bool {
+	if len(config.Tokens) == 0 {
+		return true
+	}
+
+	for _, value := range md.Get(mdToken) {
+		for _, token := range config.Tokens {
+			if subtle.ConstantTimeCompare([]byte(value), []byte(token)) == 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the stream interceptor that rejects streams without a valid cluster
+// token before the handler receives any envelopes from them.
+func authInterceptor(config *Config) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		if !authenticate(config, md) {
+			caution("rejected %s stream with invalid cluster token", info.FullMethod)
+			return grpcstatus.Error(codes.Unauthenticated, "invalid cluster token")
+		}
+		return handler(srv, stream)
+	}
+}
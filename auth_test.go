@@ -0,0 +1,90 @@
+package livenet
+
+import (
+	"testing"
+
+	"github.com/bbengfort/livenet/pb"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestAuthenticate(t *testing.T) {
+	open := &Config{}
+	for _, md := range []metadata.MD{{}, metadata.Pairs(mdToken, "anything")} {
+		if !authenticate(open, md) {
+			t.Errorf("expected %v to be accepted without tokens", md)
+		}
+	}
+
+	// Both tokens are accepted while rotating from the old to the new token
+	rotating := &Config{Tokens: []string{"new", "old"}}
+	for md, expected := range map[string]bool{
+		"":      false,
+		"new":   true,
+		"old":   true,
+		"other": false,
+		"ne":    false,
+	} {
+		if actual := authenticate(rotating, metadata.Pairs(mdToken, md)); actual != expected {
+			t.Errorf("expected token %q to be accepted %t, got %t", md, expected, actual)
+		}
+	}
+
+	if authenticate(rotating, metadata.MD{}) {
+		t.Error("expected a missing token to be rejected")
+	}
+}
+
+func TestTokenRotation(t *testing.T) {
+	for _, transport := range []string{TransportGRPC, TransportTCP, TransportMemory} {
+		t.Run(transport, func(t *testing.T) {
+			// The hosts send different tokens in the middle of a rotation but
+			// accept both, so they connect in both directions.
+			configs := testConfigs(2)
+			configs[0].Tokens = []string{"new", "old"}
+			configs[1].Tokens = []string{"old", "new"}
+			for _, config := range configs {
+				config.Transport = transport
+			}
+
+			servers := testCluster(t, configs)
+			testConnected(t, servers)
+			server := servers[0]
+
+			// Dial the server as b with the metadata and return the error of
+			// sending a heartbeat on the stream; gRPC only reports that the
+			// stream was rejected when receiving the reply.
+			dial := func(md metadata.MD) error {
+				stream, err := server.transport.Dial(server.Endpoint(false), server.Name, metadata.Join(md, peerName(configs[1])))
+				if err != nil {
+					return err
+				}
+				defer stream.Close()
+
+				if _, err = stream.Header(); err != nil {
+					return err
+				}
+
+				if err = stream.Send(pb.Wrap("b", pb.MessageType_HEARTBEAT, nil)); err != nil {
+					return err
+				}
+
+				_, err = stream.Recv()
+				return err
+			}
+
+			for _, token := range []string{"new", "old"} {
+				if err := dial(metadata.Pairs(mdToken, token)); err != nil {
+					t.Errorf("stream with the %s token was rejected: %s", token, err)
+				}
+			}
+
+			if err := dial(metadata.MD{}); err == nil {
+				t.Error("expected a stream without a token to be rejected")
+			}
+
+			if err := dial(metadata.Pairs(mdToken, "stale")); err == nil {
+				t.Error("expected a stream with an invalid token to be rejected")
+			}
+		})
+	}
+}
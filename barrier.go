@@ -0,0 +1,274 @@
+package livenet
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+// barriers implements named rendezvous points for the hosts on the network.
+// When a host arrives at a barrier, the set of hosts known to have arrived is
+// flooded to its neighbors, which merge it with their own set and forward it
+// if it has changed. A host waiting at the barrier is released when the set
+// contains the required number of hosts. The sets are resent when a remote
+// comes online, so hosts that disconnect and reconnect while waiting receive
+// the arrivals they missed.
+//
+// Barriers can be reused: each use of a barrier by a host is a new generation
+// and hosts only rendezvous with other hosts at the same generation. Only the
+// latest generation of each barrier is retained.
+//
+// The barriers are only accessed from the event loop and so are not
+// thread-safe.
+type barriers struct {
+	generations map[string]uint64                 // the latest generation of each barrier
+	arrivals    map[string]map[string]bool        // the arrived hosts at the latest generation
+	waiting     map[string]*barrierRequest        // the local host waiting at each barrier
+	pending     map[string]map[uint64]*pb.Barrier // arrivals received for future generations
+}
+
+// Initialize the barrier state if it has not been already.
+func (b *barriers) init() {
+	if b.generations == nil {
+		b.generations = make(map[string]uint64)
+		b.arrivals = make(map[string]map[string]bool)
+		b.waiting = make(map[string]*barrierRequest)
+		b.pending = make(map[string]map[uint64]*pb.Barrier)
+	}
+}
+
+// barrierRequest is the value of barrier events, sent from the application to
+// the event loop with a channel to return the result on.
+type barrierRequest struct {
+	name string
+	n    int
+	done chan error
+}
+
+// BarrierError is returned when the context is done before the required
+// number of hosts have arrived at the barrier.
+type BarrierError struct {
+	Name    string   // the name of the barrier
+	Arrived []string // the hosts that have arrived at the barrier
+	Missing []string // the hosts that have not arrived at the barrier
+	Err     error    // the error of the context
+}
+
+// Error returns a description of the hosts missing from the barrier.
+func (e *BarrierError) Error() string {
+	return fmt.Sprintf(
+		"barrier %s: %s with %d arrived, missing %s",
+		e.Name, e.Err, len(e.Arrived), strings.Join(e.Missing, ", "),
+	)
+}
+
+//===========================================================================
+// Server Barrier API
+//===========================================================================
+
+// Barrier blocks until n hosts (including this one) have arrived at the named
+// barrier or until the context is done, in which case a *BarrierError that
+// reports the missing hosts is returned. Note that an arrival cannot be
+// withdrawn, so other hosts may be released by the arrival of this host even
+// if it has timed out.
+func (s *Server) Barrier(ctx context.Context, name string, n int) error {
+	if n > len(s.config.Peers) {
+		return fmt.Errorf("barrier %s cannot wait for %d hosts on a network of %d", name, n, len(s.config.Peers))
+	}
+
+	req := &barrierRequest{name: name, n: n, done: make(chan error, 1)}
+	if err := s.Dispatch(&event{etype: BarrierEvent, source: nil, value: req}); err != nil {
+		return err
+	}
+
+	_, done := s.channels()
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		// Stop waiting and collect the missing hosts from the event loop
+		timeout := &barrierRequest{name: name, done: make(chan error, 1)}
+		if err := s.Dispatch(&event{etype: BarrierTimeout, source: ctx.Err(), value: timeout}); err != nil {
+			return err
+		}
+		return s.wait(timeout.done)
+	case <-done:
+		return errStopped
+	}
+}
+
+//===========================================================================
+// Barrier Event Handlers
+//===========================================================================
+
+// Arrive at the next generation of the barrier and flood the arrival.
+func (s *Server) onBarrierEvent(e Event) error {
+	req := e.Value().(*barrierRequest)
+	if _, ok := s.barriers.waiting[req.name]; ok {
+		req.done <- fmt.Errorf("already waiting at barrier %s", req.name)
+		return nil
+	}
+
+	s.barriers.init()
+
+	// Start the next generation with any arrivals that were received early
+	generation := s.barriers.generations[req.name] + 1
+	s.barriers.generations[req.name] = generation
+	s.barriers.arrivals[req.name] = map[string]bool{s.Name: true}
+	s.barriers.waiting[req.name] = req
+
+	if early, ok := s.barriers.pending[req.name][generation]; ok {
+		s.mergeArrivals(early)
+		delete(s.barriers.pending[req.name], generation)
+	}
+
+	s.checkBarrier(req.name)
+	return s.floodArrivals(req.name, "")
+}
+
+// Stop waiting at the barrier and report the hosts that are missing.
+func (s *Server) onBarrierTimeout(e Event) error {
+	req := e.Value().(*barrierRequest)
+	waiting, ok := s.barriers.waiting[req.name]
+	if !ok {
+		// The barrier was released before the timeout was handled
+		req.done <- nil
+		return nil
+	}
+
+	delete(s.barriers.waiting, req.name)
+	berr := &BarrierError{Name: req.name, Err: e.Source().(error)}
+	for _, peer := range s.config.Peers {
+		if s.barriers.arrivals[req.name][peer.Name] {
+			berr.Arrived = append(berr.Arrived, peer.Name)
+		} else {
+			berr.Missing = append(berr.Missing, peer.Name)
+		}
+	}
+
+	warn("barrier %s timed out with %d of %d hosts", req.name, len(berr.Arrived), waiting.n)
+	req.done <- berr
+	return nil
+}
+
+// Merge the arrivals received from a neighbor and forward them if changed.
+func (s *Server) onBarrier(in *pb.Envelope) (*pb.Envelope, error) {
+	msg := new(pb.Barrier)
+	if err := proto.Unmarshal(in.Message, msg); err != nil {
+		return nil, err
+	}
+
+	s.barriers.init()
+
+	current := s.barriers.generations[msg.Name]
+	switch {
+	case msg.Generation < current:
+		// Ignore arrivals at generations that are no longer retained
+	case msg.Generation > current:
+		// Hold arrivals at future generations until the local host arrives
+		if _, ok := s.barriers.pending[msg.Name]; !ok {
+			s.barriers.pending[msg.Name] = make(map[uint64]*pb.Barrier)
+		}
+
+		if early, ok := s.barriers.pending[msg.Name][msg.Generation]; ok {
+			msg.Arrived = append(msg.Arrived, early.Arrived...)
+		}
+		s.barriers.pending[msg.Name][msg.Generation] = msg
+	default:
+		if s.mergeArrivals(msg) {
+			s.checkBarrier(msg.Name)
+			if err := s.floodArrivals(msg.Name, in.Sender); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return pb.Wrap(s.Name, pb.MessageType_HEARTBEAT, nil), nil
+}
+
+//===========================================================================
+// Barrier Helpers
+//===========================================================================
+
+// Merge the arrivals into the current generation, returning true if changed.
+func (s *Server) mergeArrivals(msg *pb.Barrier) (changed bool) {
+	arrivals := s.barriers.arrivals[msg.Name]
+	for _, host := range msg.Arrived {
+		if !arrivals[host] {
+			arrivals[host] = true
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Release the local host if enough hosts have arrived at the barrier.
+func (s *Server) checkBarrier(name string) {
+	req, ok := s.barriers.waiting[name]
+	if !ok || len(s.barriers.arrivals[name]) < req.n {
+		return
+	}
+
+	info("released from barrier %s with %d hosts", name, len(s.barriers.arrivals[name]))
+	delete(s.barriers.waiting, name)
+	req.done <- nil
+}
+
+// Send the arrivals of the barrier to every remote except the sender.
+func (s *Server) floodArrivals(name, sender string) error {
+	msg, err := s.arrivalsMessage(name)
+	if err != nil {
+		return err
+	}
+
+	for _, remote := range s.remotes {
+		if remote.Name == sender {
+			continue
+		}
+
+		if err := remote.Send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Resend the arrivals of every barrier to a remote that has come online.
+func (s *Server) resendArrivals(remote *Remote) error {
+	names := make([]string, 0, len(s.barriers.arrivals))
+	for name := range s.barriers.arrivals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		msg, err := s.arrivalsMessage(name)
+		if err != nil {
+			return err
+		}
+
+		if err := remote.Send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create a barrier message with the arrivals at the current generation.
+func (s *Server) arrivalsMessage(name string) (*pb.Envelope, error) {
+	msg := &pb.Barrier{Name: name, Generation: s.barriers.generations[name]}
+	for host := range s.barriers.arrivals[name] {
+		msg.Arrived = append(msg.Arrived, host)
+	}
+	sort.Strings(msg.Arrived)
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return pb.Wrap(s.Name, pb.MessageType_BARRIER, data), nil
+}
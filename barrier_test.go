@@ -0,0 +1,46 @@
+package livenet
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBarrierTimeout(t *testing.T) {
+	server := testCluster(t, testConfigs(2)[:1])[0]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := server.Barrier(ctx, "start", 2)
+	berr, ok := err.(*BarrierError)
+	if !ok {
+		t.Fatalf("expected a barrier error, got %v", err)
+	}
+
+	if len(berr.Missing) != 1 || berr.Missing[0] != "b" || berr.Err != context.DeadlineExceeded {
+		t.Errorf("expected b to be missing after the deadline, got %s", berr)
+	}
+}
+
+func TestBarrierReturnsWhenServerStops(t *testing.T) {
+	server := testCluster(t, testConfigs(2)[:1])[0]
+
+	errc := make(chan error, 1)
+	go func() { errc <- server.Barrier(context.Background(), "start", 2) }()
+
+	// Wait for the arrival of the local host before stopping the server
+	time.Sleep(50 * time.Millisecond)
+	if err := server.Close(); err != nil {
+		t.Fatalf("could not close server: %s", err)
+	}
+
+	select {
+	case err := <-errc:
+		if err != errStopped {
+			t.Errorf("expected the server stopped error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("barrier blocked after the server stopped")
+	}
+}
@@ -0,0 +1,152 @@
+package livenet
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/metadata"
+)
+
+// DefaultBatchBytes is the payload size in bytes at which a batch is sent
+// without waiting for the rest of the batch window.
+const DefaultBatchBytes = 64 * 1024
+
+// Metadata key sent by the server in the stream header to indicate that it
+// unpacks batches, so that remotes only batch envelopes to hosts that can
+// receive them.
+const mdBatch = "livenet-batch"
+
+// GetBatchWindow returns how long a remote waits for more queued envelopes to
+// coalesce into a batch, zero if batching is disabled.
+func (c *Config) GetBatchWindow() (window time.Duration, err error) {
+	if c.BatchWindow == "" {
+		return 0, nil
+	}
+	if window, err = time.ParseDuration(c.BatchWindow); err != nil {
+		return window, fmt.Errorf("could not parse batch window: %s", err)
+	}
+	return window, nil
+}
+
+// GetBatchBytes returns the payload size in bytes at which a batch is sent or
+// DefaultBatchBytes if not specified.
+func (c *Config) GetBatchBytes() int {
+	if c.BatchBytes > 0 {
+		return c.BatchBytes
+	}
+	return DefaultBatchBytes
+}
+
+// Returns the stream header metadata that advertises support for batches.
+func acceptBatch() metadata.MD {
+	return metadata.Pairs(mdBatch, "true")
+}
+
+// Returns true if the server advertised support for batches in the header.
+func receivedBatch(md metadata.MD) bool {
+	return len(md.Get(mdBatch)) > 0
+}
+
+// Wrap the envelopes in order into a single batch envelope from the sender.
+// The envelopes must already be signed, the batch is compressed as a whole.
+func batch(sender string, envelopes []*pb.Envelope) (*pb.Envelope, error) {
+	data, err := proto.Marshal(&pb.Batch{Envelopes: envelopes})
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal batch: %s", err)
+	}
+	return pb.Wrap(sender, pb.MessageType_BATCH, data), nil
+}
+
+// Returns the envelopes in a decoded batch envelope in order, or the envelope
+// itself if it is not a batch. The payload of each envelope in the batch may
+// decompress to at most limit bytes.
+func unbatch(msg *pb.Envelope, limit int) ([]*pb.Envelope, error) {
+	if msg.Type != pb.MessageType_BATCH {
+		return []*pb.Envelope{msg}, nil
+	}
+
+	b := new(pb.Batch)
+	if err := proto.Unmarshal(msg.Message, b); err != nil {
+		return nil, fmt.Errorf("could not unmarshal batch from %s: %s", msg.Sender, err)
+	}
+
+	for _, env := range b.Envelopes {
+		if err := decodeEnvelope(env, limit); err != nil {
+			return nil, err
+		}
+	}
+	return b.Envelopes, nil
+}
+
+// Returns the next queued message to send to the remote, taking control
+// messages before data messages. Returns false if the timeout expires or the
+// remote is stopped before a message is queued; a nil timeout never expires.
+func (r *Remote) next(done <-chan struct{}, timeout <-chan time.Time) (queued, *sendQueue, bool) {
+	control, data := r.lanes[LaneControl], r.lanes[LaneData]
+	select {
+	case item := <-control.messages:
+		return item, control, true
+	default:
+	}
+
+	select {
+	case item := <-control.messages:
+		return item, control, true
+	case item := <-data.messages:
+		return item, data, true
+	case <-timeout:
+	case <-done:
+	}
+	return queued{}, nil, false
+}
+
+// Collect the messages queued within the batch window after the first message
+// until the batch reaches the configured size in bytes.
+func (r *Remote) gather(first queued, lane *sendQueue, done <-chan struct{}, window time.Duration) ([]queued, []*sendQueue) {
+	items := []queued{first}
+	lanes := []*sendQueue{lane}
+
+	size := len(first.msg.Message)
+	limit := r.config.GetBatchBytes()
+	timeout := time.After(window)
+
+	for size < limit {
+		item, lane, ok := r.next(done, timeout)
+		if !ok {
+			break
+		}
+
+		items = append(items, item)
+		lanes = append(lanes, lane)
+		size += len(item.msg.Message)
+	}
+
+	return items, lanes
+}
+
+// Send the messages to the remote as a single batch, or alone if there is
+// only one message in the batch.
+func (r *Remote) sendBatch(items []queued) {
+	if len(items) == 1 {
+		r.send(items[0].msg)
+		return
+	}
+
+	envelopes := make([]*pb.Envelope, 0, len(items))
+	for _, item := range items {
+		envelopes = append(envelopes, r.keys.sign(item.msg))
+	}
+
+	name, _ := r.config.GetName()
+	msg, err := batch(name, envelopes)
+	if err != nil {
+		caution("dropped %d messages to %s: %s", len(items), r.Name, err)
+		for range items {
+			r.counts.Drop()
+		}
+		return
+	}
+	r.send(msg)
+}
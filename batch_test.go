@@ -0,0 +1,130 @@
+package livenet
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+)
+
+func TestBatchUnpackedInOrder(t *testing.T) {
+	configs := testConfigs(2)
+	server := testCluster(t, configs[:1])[0]
+	log := newDirectLog(server)
+
+	// Connect to the server as the second host without running it
+	stream, err := server.transport.Dial(server.Endpoint(false), server.Name, peerName(configs[1]))
+	if err != nil {
+		t.Fatalf("could not connect to %s: %s", server.Name, err)
+	}
+	defer stream.Close()
+
+	md, err := stream.Header()
+	if err != nil {
+		t.Fatalf("no header from %s: %s", server.Name, err)
+	}
+
+	if !receivedBatch(md) {
+		t.Fatal("server did not advertise that it unpacks batches")
+	}
+
+	expected := make([]string, 0, 5)
+	envelopes := make([]*pb.Envelope, 0, 5)
+	for i := 0; i < 5; i++ {
+		expected = append(expected, fmt.Sprint(i))
+		envelopes = append(envelopes, pb.WrapTo("b", "a", 1, pb.MessageType_DIRECT, []byte(expected[i])))
+	}
+
+	msg, err := batch("b", envelopes)
+	if err != nil {
+		t.Fatalf("could not create batch: %s", err)
+	}
+
+	if err = stream.Send(msg); err != nil {
+		t.Fatalf("could not send batch: %s", err)
+	}
+
+	// The batch is replied to with a batch of the replies in order
+	reply, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("no reply to batch: %s", err)
+	}
+
+	replies, err := unbatch(reply, DefaultMaxPayload)
+	if err != nil {
+		t.Fatalf("could not unpack replies: %s", err)
+	}
+
+	if reply.Type != pb.MessageType_BATCH || len(replies) != len(envelopes) {
+		t.Fatalf("expected a batch of %d replies, got %d %s envelopes", len(envelopes), len(replies), reply.Type)
+	}
+
+	for i, reply := range replies {
+		if replyTo, _ := reply.Header(HeaderReplyTo); replyTo != envelopes[i].Id {
+			t.Errorf("reply %d is not to envelope %d of the batch", i, i)
+		}
+	}
+
+	// Each envelope of the batch was dispatched in order
+	if payloads := fmt.Sprint(log.unexpected()); payloads != fmt.Sprint(expected) {
+		t.Errorf("expected the envelopes of the batch to be dispatched in order, got %s", payloads)
+	}
+}
+
+func TestBatchMarshalFailureCountsEveryDrop(t *testing.T) {
+	config := testConfigs(2)[0]
+	remote := NewRemote(config.Peers[1].Peer, nil, config)
+
+	// An envelope with invalid UTF-8 in a string field cannot be marshaled
+	items := []queued{
+		{msg: pb.Wrap("a", pb.MessageType_DIRECT, nil)},
+		{msg: pb.Wrap("a", pb.MessageType_DIRECT, nil)},
+		{msg: pb.Wrap("\xff", pb.MessageType_DIRECT, nil)},
+	}
+
+	remote.sendBatch(items)
+	if dropped := atomic.LoadUint64(&remote.counts.drop); dropped != uint64(len(items)) {
+		t.Errorf("expected %d messages to be dropped, got %d", len(items), dropped)
+	}
+}
+
+// Send direct messages of 128 bytes from a to b as fast as the send queue
+// allows and wait for all of them to be delivered.
+func benchmarkSend(b *testing.B, window string) {
+	configs := testConfigs(2)
+	for _, config := range configs {
+		config.QueueOverflow = OverflowBlock
+		config.BatchWindow = window
+	}
+
+	servers := testCluster(b, configs)
+	testConnected(b, servers)
+
+	var received int64
+	servers[1].On(DirectMessageEvent, func(e Event) error {
+		atomic.AddInt64(&received, 1)
+		return nil
+	})
+
+	payload := make([]byte, 128)
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := servers[0].Send("b", payload); err != nil {
+			b.Fatalf("could not send message: %s", err)
+		}
+	}
+
+	eventually(b, 30*time.Second, func() bool { return atomic.LoadInt64(&received) == int64(b.N) }, "%d messages were not delivered", b.N)
+}
+
+func BenchmarkSend(b *testing.B) {
+	benchmarkSend(b, "")
+}
+
+func BenchmarkSendBatched(b *testing.B) {
+	benchmarkSend(b, "1ms")
+}
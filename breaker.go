@@ -0,0 +1,209 @@
+package livenet
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Reconnect defaults: the backoff between attempts to connect to a remote
+// doubles after each failure up to the maximum. The circuit breaker is
+// disabled unless a threshold of consecutive failures is configured, after
+// which it opens for the breaker timeout (the maximum backoff by default).
+const DefaultReconnectMax = 30 * time.Second
+
+// States of the circuit breaker that guards connections to a remote.
+const (
+	BreakerClosed   BreakerState = iota // connections are attempted with backoff
+	BreakerOpen                         // no connections are attempted until the timeout
+	BreakerHalfOpen                     // a single trial connection is attempted
+)
+
+var breakerStateStrings = [...]string{"closed", "open", "half-open"}
+
+// BreakerState is the state of the circuit breaker of a remote.
+type BreakerState uint8
+
+// String returns the name of the breaker state.
+func (s BreakerState) String() string {
+	if int(s) < len(breakerStateStrings) {
+		return breakerStateStrings[s]
+	}
+	return breakerStateStrings[BreakerClosed]
+}
+
+// GetReconnectBackoff returns the backoff after the first failure to connect
+// to a remote or the tick if not specified.
+func (c *Config) GetReconnectBackoff() (backoff time.Duration, err error) {
+	if c.ReconnectBackoff == "" {
+		return c.GetTick()
+	}
+	if backoff, err = time.ParseDuration(c.ReconnectBackoff); err != nil {
+		return backoff, fmt.Errorf("could not parse reconnect backoff: %s", err)
+	}
+	return backoff, nil
+}
+
+// GetReconnectMax returns the maximum backoff between attempts to connect to
+// a remote or DefaultReconnectMax if not specified.
+func (c *Config) GetReconnectMax() (max time.Duration, err error) {
+	if c.ReconnectMax == "" {
+		return DefaultReconnectMax, nil
+	}
+	if max, err = time.ParseDuration(c.ReconnectMax); err != nil {
+		return max, fmt.Errorf("could not parse maximum reconnect backoff: %s", err)
+	}
+	return max, nil
+}
+
+// GetBreakerThreshold returns the number of consecutive failures to connect
+// that open the circuit breaker, or zero if the breaker is disabled.
+func (c *Config) GetBreakerThreshold() int {
+	if c.BreakerThreshold > 0 {
+		return c.BreakerThreshold
+	}
+	return 0
+}
+
+// GetBreakerTimeout returns how long the circuit breaker stays open before a
+// trial connection is attempted or the maximum reconnect backoff if not
+// specified.
+func (c *Config) GetBreakerTimeout() (timeout time.Duration, err error) {
+	if c.BreakerTimeout == "" {
+		return c.GetReconnectMax()
+	}
+	if timeout, err = time.ParseDuration(c.BreakerTimeout); err != nil {
+		return timeout, fmt.Errorf("could not parse breaker timeout: %s", err)
+	}
+	return timeout, nil
+}
+
+// breaker limits the attempts to connect to an unreachable remote so that it
+// is not redialed on every message. After a failure the next attempt waits
+// for an exponential backoff with jitter; if a threshold is configured, after
+// the threshold of consecutive failures the breaker opens and no attempts are
+// made until the timeout, when a single trial attempt closes the breaker if it
+// succeeds. The wait is cut short when the remote connects to the local host,
+// since it is then likely to be reachable.
+type breaker struct {
+	sync.Mutex
+	name      string // the name of the remote
+	state     BreakerState
+	failures  int
+	retry     time.Time // no attempts are made before this time
+	backoff   time.Duration
+	max       time.Duration
+	threshold int
+	timeout   time.Duration
+}
+
+// Create a closed breaker with the configured backoff and thresholds.
+func newBreaker(name string, c *Config) *breaker {
+	b := &breaker{name: name, threshold: c.GetBreakerThreshold()}
+	b.backoff, _ = c.GetReconnectBackoff()
+	b.max, _ = c.GetReconnectMax()
+	b.timeout, _ = c.GetBreakerTimeout()
+	return b
+}
+
+// Returns true if an attempt to connect may be made now.
+func (b *breaker) allow() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	if time.Now().Before(b.retry) {
+		return false
+	}
+
+	if b.state == BreakerOpen {
+		b.state = BreakerHalfOpen
+		info("circuit breaker to %s is half-open", b.name)
+	}
+	return true
+}
+
+// Record a successful connection, closing the breaker.
+func (b *breaker) success() {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.state == BreakerClosed && b.failures == 0 {
+		return
+	}
+
+	info("circuit breaker to %s closed after %d failures", b.name, b.failures)
+	b.state = BreakerClosed
+	b.failures = 0
+	b.retry = time.Time{}
+}
+
+// Record a failed attempt to connect, opening the breaker if the trial
+// attempt failed or the threshold of consecutive failures is reached.
+func (b *breaker) failure() {
+	b.Lock()
+	defer b.Unlock()
+
+	b.failures++
+	if b.threshold > 0 && (b.state == BreakerHalfOpen || b.failures >= b.threshold) {
+		if b.state != BreakerOpen {
+			caution("circuit breaker to %s opened after %d failures", b.name, b.failures)
+		}
+		b.state = BreakerOpen
+		b.retry = time.Now().Add(b.timeout)
+		return
+	}
+
+	// Exponential backoff with equal jitter, capped at the maximum
+	delay := b.backoff << uint(b.failures-1)
+	if delay > b.max || delay <= 0 {
+		delay = b.max
+	}
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	b.retry = time.Now().Add(delay)
+}
+
+// Allow an attempt to connect immediately because the remote has been heard
+// from, making a trial attempt if the breaker is open.
+func (b *breaker) reset() {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.retry.IsZero() {
+		return
+	}
+
+	if b.state == BreakerOpen {
+		b.state = BreakerHalfOpen
+		info("circuit breaker to %s is half-open since it connected", b.name)
+	}
+	b.retry = time.Time{}
+}
+
+// String returns the state of the breaker.
+func (b *breaker) String() string {
+	b.Lock()
+	defer b.Unlock()
+
+	switch {
+	case b.state == BreakerOpen:
+		return fmt.Sprintf("breaker open after %d failures (retry in %s)", b.failures, time.Until(b.retry).Truncate(time.Millisecond))
+	case b.failures > 0:
+		return fmt.Sprintf("breaker %s after %d failures", b.state, b.failures)
+	default:
+		return "breaker " + b.state.String()
+	}
+}
+
+// errBackoff is returned when connecting to a remote is deferred by the
+// backoff or the circuit breaker.
+var errBackoff = errors.New("waiting to reconnect")
+
+// Breaker returns the state of the circuit breaker guarding connections to
+// the remote.
+func (r *Remote) Breaker() BreakerState {
+	r.breaker.Lock()
+	defer r.breaker.Unlock()
+	return r.breaker.state
+}
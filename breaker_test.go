@@ -0,0 +1,63 @@
+package livenet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerDisabledByDefault(t *testing.T) {
+	b := newBreaker("b", &Config{Tick: "10ms", ReconnectMax: "100ms"})
+	for i := 0; i < 20; i++ {
+		b.failure()
+	}
+
+	if b.state != BreakerClosed {
+		t.Errorf("breaker without a threshold opened after %d failures", b.failures)
+	}
+
+	if wait := time.Until(b.retry); wait > 100*time.Millisecond {
+		t.Errorf("backoff of %s exceeds the maximum", wait)
+	}
+}
+
+func TestBreakerReset(t *testing.T) {
+	b := newBreaker("b", &Config{Tick: "10ms", BreakerThreshold: 3, BreakerTimeout: "1h"})
+	for i := 0; i < 3; i++ {
+		b.failure()
+	}
+
+	if b.state != BreakerOpen || b.allow() {
+		t.Fatalf("expected the breaker to be open after 3 failures, got %s", b)
+	}
+
+	// Hearing from the remote allows a trial attempt without waiting
+	b.reset()
+	if !b.allow() || b.state != BreakerHalfOpen {
+		t.Errorf("expected a trial attempt after a reset, got %s", b)
+	}
+
+	b.success()
+	if b.state != BreakerClosed || b.failures != 0 {
+		t.Errorf("expected the breaker to close after a success, got %s", b)
+	}
+}
+
+func TestRecoveredPeerReconnects(t *testing.T) {
+	configs := testConfigs(2)
+	configs[0].ReconnectBackoff = "10s"
+	configs[0].ReconnectMax = "10s"
+
+	a := testCluster(t, configs[:1])[0]
+	remote := a.remote("b")
+	eventually(t, 2*time.Second, func() bool {
+		remote.breaker.Lock()
+		defer remote.breaker.Unlock()
+		return remote.breaker.failures > 0
+	}, "a did not fail to connect to b")
+
+	// Once b is listening and connects to a, a reconnects to b well before
+	// its backoff expires.
+	b := testCluster(t, configs[1:])[0]
+	eventually(t, time.Second, remote.Online, "a did not reconnect to b after it recovered")
+	eventually(t, time.Second, b.remote("a").Online, "b did not connect to a")
+}
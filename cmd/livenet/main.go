@@ -1,9 +1,13 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/bbengfort/livenet"
+	"github.com/bbengfort/x/peers"
 	"github.com/joho/godotenv"
 	"github.com/urfave/cli"
 )
@@ -44,6 +48,83 @@ func main() {
 				},
 			},
 		},
+		{
+			Name:     "certs",
+			Usage:    "generate a CA and certificates for mutual TLS between peers",
+			Action:   certs,
+			Category: "server",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "c, config",
+					Usage: "configuration file for the network",
+					Value: "config.json",
+				},
+				cli.StringFlag{
+					Name:  "o, out",
+					Usage: "directory to write the certificates to",
+					Value: "certs",
+				},
+				cli.BoolFlag{
+					Name:  "u, update",
+					Usage: "add the tls section to the configuration file",
+				},
+			},
+		},
+		{
+			Name:     "keys",
+			Usage:    "generate ed25519 keys to sign envelopes sent by peers",
+			Action:   keys,
+			Category: "server",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "c, config",
+					Usage: "configuration file for the network",
+					Value: "config.json",
+				},
+				cli.StringFlag{
+					Name:  "o, out",
+					Usage: "directory to write the signing keys to",
+					Value: "keys",
+				},
+				cli.BoolFlag{
+					Name:  "u, update",
+					Usage: "add the public and signing keys to the configuration file",
+				},
+			},
+		},
+		{
+			Name:     "bench",
+			Usage:    "compare the throughput of local peers with and without batching",
+			Action:   bench,
+			Category: "client",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "n, messages",
+					Usage: "number of messages to send between the peers",
+					Value: 10000,
+				},
+				cli.IntFlag{
+					Name:  "s, size",
+					Usage: "size in bytes of each message payload",
+					Value: 128,
+				},
+				cli.DurationFlag{
+					Name:  "w, window",
+					Usage: "batch window of the batched run",
+					Value: time.Millisecond,
+				},
+				cli.IntFlag{
+					Name:  "p, port",
+					Usage: "first of four local ports to run the peers on",
+					Value: 3264,
+				},
+				cli.StringFlag{
+					Name:  "t, transport",
+					Usage: "transport to run the peers on: grpc, tcp, or memory",
+					Value: livenet.TransportGRPC,
+				},
+			},
+		},
 		// {
 		// 	Name:     "commit",
 		// 	Usage:    "commit an entry to the distributed log",
@@ -129,10 +210,166 @@ func serve(c *cli.Context) (err error) {
 	return nil
 }
 
+func certs(c *cli.Context) (err error) {
+
+	conf := new(livenet.Config)
+	if err = conf.Load(c.String("config")); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	var tls *livenet.TLSConfig
+	if tls, err = conf.GenerateCerts(c.String("out")); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Printf("generated certificates for %d peers in %s\n", len(conf.Peers), c.String("out"))
+
+	if c.Bool("update") {
+		conf.TLS = tls
+		if err = conf.Dump(c.String("config")); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	return nil
+}
+
+func keys(c *cli.Context) (err error) {
+
+	conf := new(livenet.Config)
+	if err = conf.Load(c.String("config")); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	var path string
+	if path, err = conf.GenerateKeys(c.String("out")); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Printf("generated signing keys for %d peers in %s\n", len(conf.Peers), c.String("out"))
+
+	if c.Bool("update") {
+		conf.SigningKey = path
+		if err = conf.Dump(c.String("config")); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	} else {
+		for _, peer := range conf.Peers {
+			fmt.Printf("%s: %s\n", peer.Name, peer.PublicKey)
+		}
+	}
+
+	return nil
+}
+
 //===========================================================================
 // Client Commands
 //===========================================================================
 
+func bench(c *cli.Context) (err error) {
+	n, size, port, transport := c.Int("messages"), c.Int("size"), uint16(c.Int("port")), c.String("transport")
+	if n <= 0 || size < 0 {
+		return cli.NewExitError("specify a positive number of messages and payload size", 1)
+	}
+
+	runs := []struct {
+		name   string
+		window time.Duration
+	}{
+		{"unbatched", 0},
+		{"batched", c.Duration("window")},
+	}
+
+	for i, run := range runs {
+		var elapsed time.Duration
+		if elapsed, err = throughput(n, size, port+uint16(2*i), run.window, transport); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		fmt.Printf(
+			"%s %s: %d messages of %d bytes in %s (%0.2f messages/sec)\n",
+			transport, run.name, n, size, elapsed, float64(n)/elapsed.Seconds(),
+		)
+	}
+
+	return nil
+}
+
+// Run two local peers and time sending n direct messages from one to the other.
+func throughput(n, size int, port uint16, window time.Duration, transport string) (time.Duration, error) {
+	conf := func(name string) *livenet.Config {
+		conf := &livenet.Config{
+			Name:      name,
+			Tick:      "100ms",
+			LogLevel:  int(livenet.LogCaution),
+			SendQueue: n,
+			Transport: transport,
+		}
+		if window > 0 {
+			conf.BatchWindow = window.String()
+		}
+		for i, name := range []string{"sender", "receiver"} {
+			conf.Peers = append(conf.Peers, livenet.Peer{
+				Peer: peers.Peer{PID: uint16(i + 1), Name: name, IPAddr: "127.0.0.1", Port: port + uint16(i)},
+			})
+		}
+		return conf
+	}
+
+	sender, err := livenet.New(conf("sender"))
+	if err != nil {
+		return 0, err
+	}
+
+	receiver, err := livenet.New(conf("receiver"))
+	if err != nil {
+		return 0, err
+	}
+
+	received := make(chan struct{}, n)
+	receiver.On(livenet.DirectMessageEvent, func(livenet.Event) error {
+		received <- struct{}{}
+		return nil
+	})
+
+	errs := make(chan error, 2)
+	for _, server := range []*livenet.Server{sender, receiver} {
+		go func(server *livenet.Server) { errs <- server.Listen() }(server)
+	}
+
+	// Wait for the peers to connect before sending messages
+	deadline := time.After(10 * time.Second)
+	for !sender.Alive("receiver") {
+		select {
+		case err = <-errs:
+			return 0, err
+		case <-deadline:
+			return 0, errors.New("peers did not connect")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	payload := make([]byte, size)
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if err = sender.Send("receiver", payload); err != nil {
+			return 0, err
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		select {
+		case <-received:
+		case err = <-errs:
+			return 0, err
+		case <-time.After(10 * time.Second):
+			return 0, fmt.Errorf("received %d of %d messages", i, n)
+		}
+	}
+
+	return time.Since(start), nil
+}
+
 // func commit(c *cli.Context) (err error) {
 // 	if client, err = raft.NewClient(config); err != nil {
 // 		return cli.NewExitError(err.Error(), 1)
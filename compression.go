@@ -0,0 +1,231 @@
+package livenet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/bbengfort/livenet/pb"
+	"google.golang.org/grpc/metadata"
+)
+
+// Compression headers and metadata keys. The accept-encoding metadata is sent
+// by a Remote when it creates the Post stream, listing the compressors it
+// supports in order of preference; the server replies with the encoding
+// metadata naming the compressor selected for the stream. Compressed
+// envelopes are marked with the content-encoding header so that they can be
+// decompressed by the recipient regardless of the negotiation.
+const (
+	HeaderContentEncoding = pb.HeaderContentEncoding
+	mdAcceptEncoding      = "livenet-accept-encoding"
+	mdEncoding            = "livenet-encoding"
+	identityEncoding      = "identity"
+)
+
+// DefaultCompressionThreshold is the size in bytes of a message payload below
+// which messages are sent uncompressed.
+const DefaultCompressionThreshold = 1024
+
+// DefaultMaxPayload is the size in bytes of the largest payload that is
+// decompressed, so that a small compressed payload cannot exhaust memory.
+const DefaultMaxPayload = 16 * 1024 * 1024
+
+// Compressor compresses and decompresses message payloads. Compressors are
+// registered by name with RegisterCompressor and enabled by listing the name
+// in the compression configuration. Decompress must return an error rather
+// than a payload larger than the limit in bytes, without decompressing more
+// than the limit.
+type Compressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte, limit int) ([]byte, error)
+}
+
+// ErrPayloadTooLarge is returned when a payload decompresses to more than the
+// maximum payload size.
+var ErrPayloadTooLarge = errors.New("decompressed payload exceeds the maximum payload size")
+
+// compressors is the registry of compressors by name.
+var compressors = struct {
+	sync.RWMutex
+	registered map[string]Compressor
+}{registered: map[string]Compressor{"gzip": gzipCompressor{}}}
+
+// RegisterCompressor makes a compressor available to be negotiated by name,
+// replacing any compressor already registered with the same name.
+func RegisterCompressor(c Compressor) {
+	compressors.Lock()
+	defer compressors.Unlock()
+	compressors.registered[c.Name()] = c
+}
+
+// GetCompressor returns the compressor registered with the name.
+func GetCompressor(name string) (Compressor, bool) {
+	compressors.RLock()
+	defer compressors.RUnlock()
+	c, ok := compressors.registered[name]
+	return c, ok
+}
+
+//===========================================================================
+// Gzip Compressor
+//===========================================================================
+
+// gzipCompressor is the default compressor using the standard library.
+type gzipCompressor struct{}
+
+func (gzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte, limit int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// Read one byte past the limit to detect payloads that exceed it
+	out, err := ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out) > limit {
+		return nil, ErrPayloadTooLarge
+	}
+	return out, nil
+}
+
+//===========================================================================
+// Negotiation
+//===========================================================================
+
+// Returns the metadata sent by a Remote to negotiate compression.
+func acceptEncoding(config *Config) metadata.MD {
+	return metadata.Pairs(mdAcceptEncoding, strings.Join(config.Compression, ","))
+}
+
+// Select the first compressor accepted by the client that is also enabled on
+// the server, returning nil if no compressor is supported by both.
+func negotiateEncoding(config *Config, md metadata.MD) Compressor {
+	enabled := make(map[string]bool, len(config.Compression))
+	for _, name := range config.Compression {
+		enabled[name] = true
+	}
+
+	for _, values := range md.Get(mdAcceptEncoding) {
+		for _, name := range strings.Split(values, ",") {
+			name = strings.TrimSpace(name)
+			if !enabled[name] {
+				continue
+			}
+
+			if c, ok := GetCompressor(name); ok {
+				return c
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the metadata sent by the server with the selected compressor.
+func selectedEncoding(c Compressor) metadata.MD {
+	if c == nil {
+		return metadata.Pairs(mdEncoding, identityEncoding)
+	}
+	return metadata.Pairs(mdEncoding, c.Name())
+}
+
+// Returns the compressor selected by the server, or nil if none was.
+func receivedEncoding(md metadata.MD) Compressor {
+	for _, name := range md.Get(mdEncoding) {
+		if c, ok := GetCompressor(name); ok {
+			return c
+		}
+	}
+	return nil
+}
+
+//===========================================================================
+// Envelope Compression
+//===========================================================================
+
+// Compress the payload of the envelope if it is larger than the threshold,
+// returning a copy of the envelope with the content-encoding header so that
+// envelopes shared between multiple remotes are not modified. The envelope is
+// returned unmodified if the compressor is nil or compression doesn't help.
+func compress(msg *pb.Envelope, c Compressor, threshold int) (*pb.Envelope, error) {
+	if c == nil || len(msg.Message) < threshold {
+		return msg, nil
+	}
+
+	data, err := c.Compress(msg.Message)
+	if err != nil {
+		return nil, fmt.Errorf("could not compress message with %s: %s", c.Name(), err)
+	}
+
+	if len(data) >= len(msg.Message) {
+		return msg, nil
+	}
+
+	out := *msg
+	out.Message = data
+	out.Headers = make(map[string]string, len(msg.Headers)+1)
+	for key, value := range msg.Headers {
+		out.Headers[key] = value
+	}
+	out.Headers[HeaderContentEncoding] = c.Name()
+	return &out, nil
+}
+
+// Upgrade an envelope received from an older version of the schema and
+// decompress its payload, which may be at most limit bytes.
+func decodeEnvelope(msg *pb.Envelope, limit int) error {
+	if err := msg.Upgrade(); err != nil {
+		return err
+	}
+	return decompress(msg, limit)
+}
+
+// Decompress the payload of an envelope marked with a content-encoding,
+// returning an error if it is larger than limit bytes.
+func decompress(msg *pb.Envelope, limit int) error {
+	name, ok := msg.Header(HeaderContentEncoding)
+	if !ok {
+		return nil
+	}
+
+	c, ok := GetCompressor(name)
+	if !ok {
+		return fmt.Errorf("unknown content encoding '%s'", name)
+	}
+
+	data, err := c.Decompress(msg.Message, limit)
+	if err != nil {
+		return fmt.Errorf("could not decompress message with %s: %s", name, err)
+	}
+
+	msg.Message = data
+	delete(msg.Headers, HeaderContentEncoding)
+	return nil
+}
@@ -0,0 +1,40 @@
+package livenet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bbengfort/livenet/pb"
+)
+
+func TestDecompressLimit(t *testing.T) {
+	gz, _ := GetCompressor("gzip")
+	payload := make([]byte, 1024*1024)
+
+	data, err := gz.Compress(payload)
+	if err != nil {
+		t.Fatalf("could not compress payload: %s", err)
+	}
+
+	if out, err := gz.Decompress(data, len(payload)); err != nil || !bytes.Equal(out, payload) {
+		t.Errorf("could not decompress payload at the limit: %v", err)
+	}
+
+	if _, err = gz.Decompress(data, len(payload)-1); err != ErrPayloadTooLarge {
+		t.Errorf("expected payload over the limit to be rejected, got %v", err)
+	}
+
+	// Compressed envelopes whose payload exceeds the limit are rejected
+	msg, err := compress(pb.Wrap("a", pb.MessageType_DIRECT, payload), gz, DefaultCompressionThreshold)
+	if err != nil {
+		t.Fatalf("could not compress envelope: %s", err)
+	}
+
+	if err = decodeEnvelope(msg, 4096); err == nil {
+		t.Error("expected envelope with a payload over the limit to be rejected")
+	}
+
+	if err = decodeEnvelope(msg, DefaultMaxPayload); err != nil || len(msg.Message) != len(payload) {
+		t.Errorf("could not decode envelope: %v", err)
+	}
+}
@@ -16,18 +16,57 @@ import (
 const (
 	DefaultTick          = 500 * time.Millisecond
 	DefaultLogLevel      = LogCaution
+	DefaultGossipTicks   = 10
+	DefaultAntiEntropy   = 30 * time.Second
 	actorEventBufferSize = 1024
 )
 
 // Config implements a simple configuration object that can be loaded from a
 // JSON file and defines the LiveNet network.
 type Config struct {
-	Name     string       `json:"name,omitempty"`      // unique name of local replica (hostname by default)
-	Seed     int64        `json:"seed"`                // random seed to initialize with
-	Tick     string       `json:"tick"`                // click tick rate for timing (parseable duration)
-	Uptime   string       `json:"uptime,omitempty"`    // run for a specified duration then shutdown
-	LogLevel int          `json:"log_level,omitempty"` // verbosity of logging, lower is more verbose
-	Peers    []peers.Peer `json:"peers"`               // all hosts on the LiveNet
+	Name             string     `json:"name,omitempty"`              // unique name of local replica (hostname by default)
+	Seed             int64      `json:"seed"`                        // random seed to initialize with
+	Tick             string     `json:"tick"`                        // click tick rate for timing (parseable duration)
+	Uptime           string     `json:"uptime,omitempty"`            // run for a specified duration then shutdown
+	LogLevel         int        `json:"log_level,omitempty"`         // verbosity of logging, lower is more verbose
+	Topology         string     `json:"topology,omitempty"`          // overlay network: mesh (default), ring, star, regular, or hypercube
+	Degree           int        `json:"degree,omitempty"`            // number of neighbors of each peer in the regular topology
+	GossipTimeout    string     `json:"gossip_timeout,omitempty"`    // duration before an indirect peer is considered offline (parseable duration)
+	AntiEntropy      string     `json:"anti_entropy,omitempty"`      // interval between periodic state reconciliation (parseable duration)
+	Compression      []string   `json:"compression,omitempty"`       // payload compressors to negotiate in order of preference, e.g. gzip
+	CompressAbove    int        `json:"compress_above,omitempty"`    // payload size in bytes below which messages are sent uncompressed
+	MaxPayload       int        `json:"max_payload,omitempty"`       // maximum size in bytes of a decompressed payload, larger payloads are rejected
+	TLS              *TLSConfig `json:"tls,omitempty"`               // certificates for mutual TLS between peers, insecure if not specified
+	SigningKey       string     `json:"signing_key,omitempty"`       // path to the ed25519 key to sign envelopes with, may contain {name}
+	Tokens           []string   `json:"tokens,omitempty"`            // shared secrets that authenticate peers, the first is sent to peers
+	SendQueue        int        `json:"send_queue,omitempty"`        // number of messages queued to each remote before overflow
+	QueueOverflow    string     `json:"queue_overflow,omitempty"`    // policy when a send queue is full: drop-oldest (default), drop-newest, or block
+	BatchWindow      string     `json:"batch_window,omitempty"`      // time to wait for messages to send as a batch, disabled if not specified (parseable duration)
+	BatchBytes       int        `json:"batch_bytes,omitempty"`       // payload size in bytes at which a batch is sent before the window ends
+	ChunkSize        int        `json:"chunk_size,omitempty"`        // maximum size in bytes of the chunks of large payloads
+	Outbox           string     `json:"outbox,omitempty"`            // directory to hold undelivered messages to offline peers, may contain {name}
+	OutboxSize       int        `json:"outbox_size,omitempty"`       // maximum size in bytes of the messages held for each peer
+	OutboxAge        string     `json:"outbox_age,omitempty"`        // maximum age of the messages held for each peer (parseable duration)
+	ReconnectBackoff string     `json:"reconnect_backoff,omitempty"` // backoff after the first failure to connect to a peer, the tick by default (parseable duration)
+	ReconnectMax     string     `json:"reconnect_max,omitempty"`     // maximum backoff between attempts to connect to a peer (parseable duration)
+	BreakerThreshold int        `json:"breaker_threshold,omitempty"` // consecutive failures to connect that open the circuit breaker of a peer, disabled if not specified
+	BreakerTimeout   string     `json:"breaker_timeout,omitempty"`   // time the circuit breaker stays open before a trial connection (parseable duration)
+	Keepalive        string     `json:"keepalive,omitempty"`         // inactivity before connections are pinged, disabled if not specified (parseable duration)
+	KeepaliveTimeout string     `json:"keepalive_timeout,omitempty"` // time to wait for the reply to a keepalive ping (parseable duration)
+	Datagrams        bool       `json:"datagrams,omitempty"`         // send UDP heartbeats to every peer to track liveness independently of the streams
+	DatagramTimeout  string     `json:"datagram_timeout,omitempty"`  // duration without a heartbeat datagram before a peer is unreachable (parseable duration)
+	Transport        string     `json:"transport,omitempty"`         // carries the streams between peers: grpc (default), tcp, or memory
+	Faults           Faults     `json:"faults,omitempty"`            // faults to inject on the links to peers by name, or * for all links
+	Admin            string     `json:"admin,omitempty"`             // address of the admin api that controls fault injection (localhost if no host), disabled if not specified
+	SharedStreams    bool       `json:"shared_streams,omitempty"`    // send requests in both directions on the stream created by the lower PID
+	Peers            []Peer     `json:"peers"`                       // all hosts on the LiveNet
+}
+
+// Peer is the configuration of a host on the LiveNet with the public key that
+// verifies the envelopes it signs.
+type Peer struct {
+	peers.Peer
+	PublicKey string `json:"public_key,omitempty"` // base64 encoded ed25519 public key, unsigned if not specified
 }
 
 // Load the configuration from the path on disk
@@ -72,28 +111,25 @@ func (c *Config) GetPeer() (peers.Peer, error) {
 
 	for _, peer := range c.Peers {
 		if peer.Name == local {
-			return peer, nil
+			return peer.Peer, nil
 		}
 	}
 
 	return peers.Peer{}, fmt.Errorf("could not find peer for '%s'", local)
 }
 
-// GetRemotes returns all peer configurations for remote hosts on the network,
-// excluding the local peer configuration.
+// GetRemotes returns remotes for the neighbors of the local peer in the
+// configured topology; in the default mesh topology these are all peer
+// configurations excluding the local peer configuration.
 func (c *Config) GetRemotes(actor Dispatcher) ([]*Remote, error) {
-	local, err := c.GetName()
+	neighbors, err := c.GetNeighbors()
 	if err != nil {
 		return nil, err
 	}
 
-	remotes := make([]*Remote, 0, len(c.Peers)-1)
-
-	for _, peer := range c.Peers {
-		if local == peer.Name {
-			continue
-		}
-		remotes = append(remotes, NewRemote(peer, actor))
+	remotes := make([]*Remote, 0, len(neighbors))
+	for _, peer := range neighbors {
+		remotes = append(remotes, NewRemote(peer, actor, c))
 	}
 
 	return remotes, nil
@@ -122,6 +158,88 @@ func (c *Config) GetUptime() (uptime time.Duration, err error) {
 	return uptime, nil
 }
 
+// GetGossipTimeout returns the parsed duration from the gossip timeout
+// configuration. If not specified, the timeout is DefaultGossipTicks ticks.
+func (c *Config) GetGossipTimeout() (timeout time.Duration, err error) {
+	if c.GossipTimeout == "" {
+		var tick time.Duration
+		if tick, err = c.GetTick(); err != nil {
+			return 0, err
+		}
+		return tick * DefaultGossipTicks, nil
+	}
+	if timeout, err = time.ParseDuration(c.GossipTimeout); err != nil {
+		return timeout, fmt.Errorf("could not parse gossip timeout: %s", err)
+	}
+	return timeout, nil
+}
+
+// GetAntiEntropy returns the parsed duration from the anti-entropy
+// configuration or the default interval if not specified.
+func (c *Config) GetAntiEntropy() (interval time.Duration, err error) {
+	if c.AntiEntropy == "" {
+		return DefaultAntiEntropy, nil
+	}
+	if interval, err = time.ParseDuration(c.AntiEntropy); err != nil {
+		return interval, fmt.Errorf("could not parse anti-entropy interval: %s", err)
+	}
+	return interval, nil
+}
+
+// GetCompression returns the registered compressors enabled by the
+// configuration, or an error if a compressor has not been registered.
+func (c *Config) GetCompression() ([]Compressor, error) {
+	enabled := make([]Compressor, 0, len(c.Compression))
+	for _, name := range c.Compression {
+		compressor, ok := GetCompressor(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown compressor '%s'", name)
+		}
+		enabled = append(enabled, compressor)
+	}
+	return enabled, nil
+}
+
+// GetCompressAbove returns the payload size in bytes below which messages
+// are sent uncompressed or DefaultCompressionThreshold if not specified.
+func (c *Config) GetCompressAbove() int {
+	if c.CompressAbove > 0 {
+		return c.CompressAbove
+	}
+	return DefaultCompressionThreshold
+}
+
+// GetMaxPayload returns the maximum size in bytes of a decompressed payload
+// or DefaultMaxPayload if not specified.
+func (c *Config) GetMaxPayload() int {
+	if c.MaxPayload > 0 {
+		return c.MaxPayload
+	}
+	return DefaultMaxPayload
+}
+
+// GetSendQueue returns the capacity of the send queue of each remote or
+// DefaultSendQueue if not specified.
+func (c *Config) GetSendQueue() int {
+	if c.SendQueue > 0 {
+		return c.SendQueue
+	}
+	return DefaultSendQueue
+}
+
+// GetQueueOverflow returns the policy applied when a send queue is full or an
+// error if the policy is unknown.
+func (c *Config) GetQueueOverflow() (string, error) {
+	switch c.QueueOverflow {
+	case "", OverflowDropOldest:
+		return OverflowDropOldest, nil
+	case OverflowDropNewest, OverflowBlock:
+		return c.QueueOverflow, nil
+	default:
+		return "", fmt.Errorf("unknown queue overflow policy '%s'", c.QueueOverflow)
+	}
+}
+
 // GetLogLevel returns the uint8 parsed logging verbosity
 func (c *Config) GetLogLevel() uint8 {
 	if c.LogLevel > 0 {
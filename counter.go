@@ -1,56 +1,86 @@
 package livenet
 
-import "fmt"
+import (
+	"fmt"
+	"sync/atomic"
+)
 
 // MessageCounts is a simple data structure for keeping track of how many
-// messages are sent, received, and dropped from a connection.
+// messages are sent, received, and dropped from a connection. The counts are
+// updated atomically since they are incremented by the goroutines that send
+// and receive on the connection and read by the status of the server.
 type MessageCounts struct {
 	sent uint64
 	recv uint64
 	drop uint64
+	rjct uint64 // messages received with a bad signature
+	raw  uint64 // payload bytes before compression
+	wire uint64 // payload bytes after compression
 }
 
 // Sent increments the sent messages count
 func (c *MessageCounts) Sent() {
-	c.sent++
+	atomic.AddUint64(&c.sent, 1)
 }
 
 // Recv increments the received messages count
 func (c *MessageCounts) Recv() {
-	c.recv++
+	atomic.AddUint64(&c.recv, 1)
 }
 
 // Drop increments the dropped messages count
 func (c *MessageCounts) Drop() {
-	c.drop++
+	atomic.AddUint64(&c.drop, 1)
+}
+
+// Reject increments the count of messages received with a bad signature
+func (c *MessageCounts) Reject() {
+	atomic.AddUint64(&c.rjct, 1)
+}
+
+// Bytes adds the size of a sent payload before and after compression
+func (c *MessageCounts) Bytes(before, after int) {
+	atomic.AddUint64(&c.raw, uint64(before))
+	atomic.AddUint64(&c.wire, uint64(after))
 }
 
 func (c *MessageCounts) String() string {
 	return fmt.Sprintf(
-		"%d messages sent, %d recieved (%0.2f%%), %d dropped (%0.2f%%)",
-		c.sent, c.recv, c.RecvR(), c.drop, c.DropR(),
+		"%d messages sent, %d recieved (%0.2f%%), %d dropped (%0.2f%%), %d rejected, %d payload bytes sent as %d (%0.2f%%)",
+		atomic.LoadUint64(&c.sent), atomic.LoadUint64(&c.recv), c.RecvR(), atomic.LoadUint64(&c.drop), c.DropR(),
+		atomic.LoadUint64(&c.rjct), atomic.LoadUint64(&c.raw), atomic.LoadUint64(&c.wire), c.WireR(),
 	)
 }
 
 // RecvR returns the ratio of received to sent messages
 func (c *MessageCounts) RecvR() float64 {
-	if c.sent == 0 || c.recv == 0 {
-		return 0.0
-	}
-	return float64(c.recv) / float64(c.sent)
+	return ratio(atomic.LoadUint64(&c.recv), atomic.LoadUint64(&c.sent))
 }
 
 // DropR returns the ratio of dropped to sent messages
 func (c *MessageCounts) DropR() float64 {
-	if c.sent == 0 || c.drop == 0 {
-		return 0.0
-	}
-	return float64(c.drop) / float64(c.sent)
+	return ratio(atomic.LoadUint64(&c.drop), atomic.LoadUint64(&c.sent))
+}
+
+// WireR returns the ratio of payload bytes after compression to before
+func (c *MessageCounts) WireR() float64 {
+	return ratio(atomic.LoadUint64(&c.wire), atomic.LoadUint64(&c.raw))
 }
 
 // Reset the message counts back to zero
 func (c *MessageCounts) Reset() {
-	c.sent = 0
-	c.drop = 0
-	c.recv = 0
+	atomic.StoreUint64(&c.sent, 0)
+	atomic.StoreUint64(&c.drop, 0)
+	atomic.StoreUint64(&c.recv, 0)
+	atomic.StoreUint64(&c.rjct, 0)
+	atomic.StoreUint64(&c.raw, 0)
+	atomic.StoreUint64(&c.wire, 0)
+}
+
+// Returns the ratio of the count to the total, zero if either is zero.
+func ratio(count, total uint64) float64 {
+	if total == 0 || count == 0 {
+		return 0.0
+	}
+	return float64(count) / float64(total)
 }
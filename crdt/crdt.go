@@ -0,0 +1,32 @@
+/*
+Package crdt implements conflict-free replicated data types that are kept in
+sync across a LiveNet cluster. Each data type records the changes made to the
+local replica as a delta; the LiveNet server drains the deltas of every
+replicated data type on each heartbeat and piggybacks them on the heartbeat
+envelopes sent to its neighbors, which merge the deltas into their replicas in
+the event loop. When a remote comes back online it is sent the full state of
+every replica, so the values on every host converge once the network heals.
+
+To replicate a data type, create it with the name of the local host (which
+must be unique on the network) and register it with the server under a name
+that is shared by all hosts:
+
+	counter := crdt.NewGCounter(server.Name)
+	server.Replicate("requests", counter)
+	counter.Increment(1)
+
+The converged value can be read on any host with the Value method of the data
+type. All data types are safe for concurrent use.
+*/
+package crdt
+
+import "github.com/golang/protobuf/proto"
+
+// Returns the serialized delta, or nil if the delta is empty so that data types
+// that have not been modified do not add to the size of the heartbeat.
+func marshalDelta(msg proto.Message, empty bool) ([]byte, error) {
+	if empty {
+		return nil, nil
+	}
+	return proto.Marshal(msg)
+}
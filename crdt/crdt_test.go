@@ -0,0 +1,276 @@
+package crdt
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// replicated is the interface of the data types replicated by the server.
+type replicated interface {
+	Delta() ([]byte, error)
+	State() ([]byte, error)
+	Merge(data []byte) (bool, error)
+}
+
+// Each data type is tested by applying a sequence of updates to replicas and
+// comparing the values of the replicas after merging them in different ways.
+var testTypes = []struct {
+	name   string
+	create func(replica string) replicated
+	update func(r replicated, i int)
+	value  func(r replicated) string
+}{
+	{
+		name:   "GCounter",
+		create: func(replica string) replicated { return NewGCounter(replica) },
+		update: func(r replicated, i int) { r.(*GCounter).Increment(uint64(i + 1)) },
+		value:  func(r replicated) string { return fmt.Sprint(r.(*GCounter).Value()) },
+	},
+	{
+		name:   "PNCounter",
+		create: func(replica string) replicated { return NewPNCounter(replica) },
+		update: func(r replicated, i int) {
+			if i%3 == 2 {
+				r.(*PNCounter).Decrement(uint64(i))
+			} else {
+				r.(*PNCounter).Increment(uint64(i + 1))
+			}
+		},
+		value: func(r replicated) string { return fmt.Sprint(r.(*PNCounter).Value()) },
+	},
+	{
+		name:   "LWWRegister",
+		create: func(replica string) replicated { return NewLWWRegister(replica) },
+		update: func(r replicated, i int) { r.(*LWWRegister).Set([]byte(fmt.Sprintf("value %d", i))) },
+		value: func(r replicated) string {
+			value, ts := r.(*LWWRegister).Value()
+			return fmt.Sprintf("%s@%d", value, ts.UnixNano())
+		},
+	},
+	{
+		name:   "ORSet",
+		create: func(replica string) replicated { return NewORSet(replica) },
+		update: func(r replicated, i int) {
+			r.(*ORSet).Add(fmt.Sprintf("e%d", i%4))
+			if i%2 == 1 {
+				r.(*ORSet).Remove(fmt.Sprintf("e%d", (i+1)%4))
+			}
+		},
+		value: func(r replicated) string { return strings.Join(r.(*ORSet).Value(), ",") },
+	},
+}
+
+// Create replicas a, b, and c that have each applied a different sequence of
+// updates without merging.
+func testReplicas(create func(string) replicated, update func(replicated, int)) []replicated {
+	replicas := make([]replicated, 0, 3)
+	for i, name := range []string{"a", "b", "c"} {
+		r := create(name)
+		for j := 0; j < 3+i; j++ {
+			update(r, i*7+j)
+		}
+		replicas = append(replicas, r)
+	}
+	return replicas
+}
+
+// Create a new replica that has merged the states of the replicas in order.
+func join(t *testing.T, create func(string) replicated, replicas ...replicated) replicated {
+	t.Helper()
+	joined := create("z")
+	for _, r := range replicas {
+		state, err := r.State()
+		if err != nil {
+			t.Fatalf("could not serialize state: %s", err)
+		}
+
+		if _, err = joined.Merge(state); err != nil {
+			t.Fatalf("could not merge state: %s", err)
+		}
+	}
+	return joined
+}
+
+func TestMergeCommutative(t *testing.T) {
+	for _, tt := range testTypes {
+		replicas := testReplicas(tt.create, tt.update)
+		a, b := replicas[0], replicas[1]
+
+		ab := tt.value(join(t, tt.create, a, b))
+		ba := tt.value(join(t, tt.create, b, a))
+		if ab != ba {
+			t.Errorf("%s: merge is not commutative: %s != %s", tt.name, ab, ba)
+		}
+	}
+}
+
+func TestMergeAssociative(t *testing.T) {
+	for _, tt := range testTypes {
+		replicas := testReplicas(tt.create, tt.update)
+		a, b, c := replicas[0], replicas[1], replicas[2]
+
+		left := tt.value(join(t, tt.create, join(t, tt.create, a, b), c))
+		right := tt.value(join(t, tt.create, a, join(t, tt.create, b, c)))
+		if left != right {
+			t.Errorf("%s: merge is not associative: %s != %s", tt.name, left, right)
+		}
+	}
+}
+
+func TestMergeIdempotent(t *testing.T) {
+	for _, tt := range testTypes {
+		replicas := testReplicas(tt.create, tt.update)
+		joined := join(t, tt.create, replicas...)
+		expected := tt.value(joined)
+
+		for _, r := range append(replicas, joined) {
+			state, err := r.State()
+			if err != nil {
+				t.Fatalf("%s: could not serialize state: %s", tt.name, err)
+			}
+
+			changed, err := joined.Merge(state)
+			if err != nil {
+				t.Fatalf("%s: could not merge state: %s", tt.name, err)
+			}
+
+			if changed {
+				t.Errorf("%s: merging a state that was already merged changed the replica", tt.name)
+			}
+
+			if actual := tt.value(joined); actual != expected {
+				t.Errorf("%s: merge is not idempotent: %s != %s", tt.name, actual, expected)
+			}
+		}
+	}
+}
+
+func TestDeltas(t *testing.T) {
+	for _, tt := range testTypes {
+		a, b, c := tt.create("a"), tt.create("b"), tt.create("c")
+
+		var deltas [][]byte
+		for i := 0; i < 8; i++ {
+			tt.update(a, i)
+			delta, err := a.Delta()
+			if err != nil {
+				t.Fatalf("%s: could not serialize delta: %s", tt.name, err)
+			}
+
+			if delta == nil {
+				t.Fatalf("%s: no delta after update %d", tt.name, i)
+			}
+
+			deltas = append(deltas, delta)
+			if _, err = b.Merge(delta); err != nil {
+				t.Fatalf("%s: could not merge delta: %s", tt.name, err)
+			}
+		}
+
+		// The delta is reset once it has been drained
+		if delta, err := a.Delta(); err != nil || delta != nil {
+			t.Errorf("%s: expected no delta without updates, got %v %v", tt.name, delta, err)
+		}
+
+		if expected, actual := tt.value(a), tt.value(b); expected != actual {
+			t.Errorf("%s: deltas applied in order do not converge: %s != %s", tt.name, actual, expected)
+		}
+
+		// Deltas are also applied out of order and more than once
+		for i := len(deltas) - 1; i >= 0; i-- {
+			for j := 0; j < 2; j++ {
+				if _, err := c.Merge(deltas[i]); err != nil {
+					t.Fatalf("%s: could not merge delta: %s", tt.name, err)
+				}
+			}
+		}
+
+		if expected, actual := tt.value(a), tt.value(c); expected != actual {
+			t.Errorf("%s: deltas applied out of order do not converge: %s != %s", tt.name, actual, expected)
+		}
+	}
+}
+
+func TestORSetRestart(t *testing.T) {
+	a, b := NewORSet("a"), NewORSet("b")
+	a.Add("x")
+	if _, err := b.Merge(mustDelta(t, a)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The element added before the restart is removed
+	b.Remove("x")
+	if _, err := a.Merge(mustDelta(t, b)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The replica restarts with an empty set and adds a new element, whose
+	// tag must not match the removed tag of the previous start.
+	a = NewORSet("a")
+	a.Add("y")
+	if _, err := b.Merge(mustDelta(t, a)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !b.Contains("y") || b.Contains("x") {
+		t.Errorf("expected only the element added after the restart, got %v", b.Value())
+	}
+}
+
+// Returns the delta of the replica, failing the test if it is empty.
+func mustDelta(t *testing.T, r replicated) []byte {
+	t.Helper()
+	delta, err := r.Delta()
+	if err != nil || delta == nil {
+		t.Fatalf("expected a delta, got %v %v", delta, err)
+	}
+	return delta
+}
+
+func TestCounterRestart(t *testing.T) {
+	counters := []struct {
+		name      string
+		create    func(replica string) replicated
+		increment func(r replicated, n uint64)
+		value     func(r replicated) int64
+	}{
+		{
+			name:      "GCounter",
+			create:    func(replica string) replicated { return NewGCounter(replica) },
+			increment: func(r replicated, n uint64) { r.(*GCounter).Increment(n) },
+			value:     func(r replicated) int64 { return int64(r.(*GCounter).Value()) },
+		},
+		{
+			name:      "PNCounter",
+			create:    func(replica string) replicated { return NewPNCounter(replica) },
+			increment: func(r replicated, n uint64) { r.(*PNCounter).Increment(n) },
+			value:     func(r replicated) int64 { return r.(*PNCounter).Value() },
+		},
+	}
+
+	for _, tt := range counters {
+		a, b := tt.create("a"), tt.create("b")
+		tt.increment(a, 5)
+		if _, err := b.Merge(mustDelta(t, a)); err != nil {
+			t.Fatal(err)
+		}
+
+		// The replica restarts from zero and increments less than before, and
+		// the increments are merged as deltas and as a full state.
+		a = tt.create("a")
+		tt.increment(a, 2)
+		if _, err := b.Merge(mustDelta(t, a)); err != nil {
+			t.Fatal(err)
+		}
+
+		if value := tt.value(b); value != 7 {
+			t.Errorf("%s: increments after the restart were lost: expected 7, got %d", tt.name, value)
+		}
+
+		joined := join(t, tt.create, b, a)
+		if value := tt.value(joined); value != 7 {
+			t.Errorf("%s: increments after the restart were lost in the state: expected 7, got %d", tt.name, value)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package crdt
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+// GCounter is a grow-only counter: each replica increments its own count and
+// the value of the counter is the sum of the counts of all replicas. Merging
+// takes the maximum count of each replica.
+//
+// Counts are keyed by the name of the replica and a random epoch chosen when
+// the counter is created, so that a replica that restarts from zero counts its
+// new increments separately instead of under its count from before the
+// restart, which would hide them until they exceeded it.
+type GCounter struct {
+	sync.RWMutex
+	slot   string            // the name and epoch of the local replica
+	counts map[string]uint64 // the count of increments by replica and epoch
+	delta  map[string]uint64 // the counts modified since the last delta
+}
+
+// NewGCounter creates a grow-only counter for the local replica.
+func NewGCounter(replica string) *GCounter {
+	return &GCounter{
+		slot:   fmt.Sprintf("%s:%s", replica, pb.NewID()),
+		counts: make(map[string]uint64),
+		delta:  make(map[string]uint64),
+	}
+}
+
+// Increment the counter by the specified amount.
+func (c *GCounter) Increment(n uint64) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.counts[c.slot] += n
+	c.delta[c.slot] = c.counts[c.slot]
+}
+
+// Value returns the sum of the counts of all replicas.
+func (c *GCounter) Value() uint64 {
+	c.RLock()
+	defer c.RUnlock()
+
+	var total uint64
+	for _, count := range c.counts {
+		total += count
+	}
+	return total
+}
+
+// Delta returns the serialized counts modified since the last call to Delta
+// and resets the delta, or nil if the counter has not been modified.
+func (c *GCounter) Delta() ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	data, err := marshalDelta(&pb.GCounter{Counts: c.delta}, len(c.delta) == 0)
+	if err == nil {
+		c.delta = make(map[string]uint64)
+	}
+	return data, err
+}
+
+// State returns the serialized counts of all replicas.
+func (c *GCounter) State() ([]byte, error) {
+	c.RLock()
+	defer c.RUnlock()
+	return proto.Marshal(&pb.GCounter{Counts: c.counts})
+}
+
+// Merge a serialized delta or state, returning true if the counter changed.
+func (c *GCounter) Merge(data []byte) (bool, error) {
+	state := new(pb.GCounter)
+	if err := proto.Unmarshal(data, state); err != nil {
+		return false, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	return c.merge(state), nil
+}
+
+// Merge the counts taking the maximum of each replica and epoch (not
+// thread-safe).
+func (c *GCounter) merge(state *pb.GCounter) (changed bool) {
+	for replica, count := range state.GetCounts() {
+		if count > c.counts[replica] {
+			c.counts[replica] = count
+			changed = true
+		}
+	}
+	return changed
+}
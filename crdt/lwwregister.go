@@ -0,0 +1,88 @@
+package crdt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+// LWWRegister is a last-writer-wins register: every write is timestamped and
+// merging keeps the value with the latest timestamp, breaking ties by the name
+// of the replica that wrote the value.
+type LWWRegister struct {
+	sync.RWMutex
+	replica  string          // the name of the local replica
+	state    *pb.LWWRegister // the most recent write
+	modified bool            // if the register has changed since the last delta
+}
+
+// NewLWWRegister creates a last-writer-wins register for the local replica.
+func NewLWWRegister(replica string) *LWWRegister {
+	return &LWWRegister{replica: replica, state: new(pb.LWWRegister)}
+}
+
+// Set the value of the register.
+func (r *LWWRegister) Set(value []byte) {
+	r.Lock()
+	defer r.Unlock()
+
+	// Ensure the timestamp increases even if the clock has not advanced
+	ts := time.Now().UnixNano()
+	if ts <= r.state.Timestamp {
+		ts = r.state.Timestamp + 1
+	}
+
+	r.state = &pb.LWWRegister{Value: value, Timestamp: ts, Replica: r.replica}
+	r.modified = true
+}
+
+// Value returns the value of the register and the time it was written.
+func (r *LWWRegister) Value() ([]byte, time.Time) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.state.Value, time.Unix(0, r.state.Timestamp)
+}
+
+// Delta returns the serialized register if it has been modified since the
+// last call to Delta, or nil if it has not been modified.
+func (r *LWWRegister) Delta() ([]byte, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	data, err := marshalDelta(r.state, !r.modified)
+	if err == nil {
+		r.modified = false
+	}
+	return data, err
+}
+
+// State returns the serialized register.
+func (r *LWWRegister) State() ([]byte, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return proto.Marshal(r.state)
+}
+
+// Merge a serialized register, returning true if its write is more recent.
+func (r *LWWRegister) Merge(data []byte) (bool, error) {
+	state := new(pb.LWWRegister)
+	if err := proto.Unmarshal(data, state); err != nil {
+		return false, err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if state.Timestamp < r.state.Timestamp {
+		return false, nil
+	}
+
+	if state.Timestamp == r.state.Timestamp && state.Replica <= r.state.Replica {
+		return false, nil
+	}
+
+	r.state = state
+	return true, nil
+}
@@ -0,0 +1,177 @@
+package crdt
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+// ORSet is an observed-remove set of strings: every add of an element is
+// identified by a unique tag, and removing an element removes only the tags
+// that have been observed by the local replica. An element is in the set if it
+// has any tags that have not been removed, so concurrent adds win over removes.
+//
+// Tags are made unique by the name of the replica, a random epoch chosen when
+// the set is created, and a counter, so that the tags of a replica that
+// restarts with an empty set are not confused with tags it created (and that
+// may have been removed) before it restarted.
+type ORSet struct {
+	sync.RWMutex
+	replica    string                     // the name of the local replica
+	epoch      string                     // random nonce that distinguishes restarts of the replica
+	counter    uint64                     // used to create unique tags within the epoch
+	elements   map[string]map[string]bool // the add tags of each element
+	tombstones map[string]bool            // the add tags that have been removed
+	delta      *pb.ORSet                  // the adds and removes since the last delta
+}
+
+// NewORSet creates an observed-remove set for the local replica.
+func NewORSet(replica string) *ORSet {
+	return &ORSet{
+		replica:    replica,
+		epoch:      pb.NewID(),
+		elements:   make(map[string]map[string]bool),
+		tombstones: make(map[string]bool),
+		delta:      newORSetState(),
+	}
+}
+
+// Add the element to the set.
+func (s *ORSet) Add(element string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.counter++
+	tag := fmt.Sprintf("%s:%s:%d", s.replica, s.epoch, s.counter)
+
+	if _, ok := s.elements[element]; !ok {
+		s.elements[element] = make(map[string]bool)
+	}
+	s.elements[element][tag] = true
+
+	if _, ok := s.delta.Elements[element]; !ok {
+		s.delta.Elements[element] = new(pb.Tags)
+	}
+	s.delta.Elements[element].Tags = append(s.delta.Elements[element].Tags, tag)
+}
+
+// Remove the element from the set by removing all of its observed tags.
+func (s *ORSet) Remove(element string) {
+	s.Lock()
+	defer s.Unlock()
+
+	for tag := range s.elements[element] {
+		s.tombstones[tag] = true
+		s.delta.Tombstones = append(s.delta.Tombstones, tag)
+	}
+	delete(s.elements, element)
+}
+
+// Contains returns true if the element is in the set.
+func (s *ORSet) Contains(element string) bool {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.elements[element]) > 0
+}
+
+// Value returns the sorted elements in the set.
+func (s *ORSet) Value() []string {
+	s.RLock()
+	defer s.RUnlock()
+
+	elements := make([]string, 0, len(s.elements))
+	for element := range s.elements {
+		elements = append(elements, element)
+	}
+	sort.Strings(elements)
+	return elements
+}
+
+// Delta returns the serialized adds and removes since the last call to Delta
+// and resets the delta, or nil if the set has not been modified.
+func (s *ORSet) Delta() ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	empty := len(s.delta.Elements) == 0 && len(s.delta.Tombstones) == 0
+	data, err := marshalDelta(s.delta, empty)
+	if err == nil {
+		s.delta = newORSetState()
+	}
+	return data, err
+}
+
+// State returns the serialized tags and tombstones of the set.
+func (s *ORSet) State() ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	state := newORSetState()
+	for element, tags := range s.elements {
+		state.Elements[element] = new(pb.Tags)
+		for tag := range tags {
+			state.Elements[element].Tags = append(state.Elements[element].Tags, tag)
+		}
+	}
+
+	for tag := range s.tombstones {
+		state.Tombstones = append(state.Tombstones, tag)
+	}
+
+	return proto.Marshal(state)
+}
+
+// Merge a serialized delta or state, returning true if the set changed. The
+// merge is the union of the tags and the tombstones, removing any tags that
+// have been tombstoned.
+func (s *ORSet) Merge(data []byte) (changed bool, err error) {
+	state := new(pb.ORSet)
+	if err = proto.Unmarshal(data, state); err != nil {
+		return false, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, tag := range state.Tombstones {
+		if s.tombstones[tag] {
+			continue
+		}
+
+		s.tombstones[tag] = true
+		changed = true
+
+		for element, tags := range s.elements {
+			if tags[tag] {
+				delete(tags, tag)
+				if len(tags) == 0 {
+					delete(s.elements, element)
+				}
+			}
+		}
+	}
+
+	for element, tags := range state.Elements {
+		for _, tag := range tags.GetTags() {
+			if s.tombstones[tag] || s.elements[element][tag] {
+				continue
+			}
+
+			if _, ok := s.elements[element]; !ok {
+				s.elements[element] = make(map[string]bool)
+			}
+			s.elements[element][tag] = true
+			changed = true
+		}
+	}
+
+	return changed, nil
+}
+
+// Returns an empty set state to accumulate deltas in.
+func newORSetState() *pb.ORSet {
+	return &pb.ORSet{Elements: make(map[string]*pb.Tags)}
+}
@@ -0,0 +1,107 @@
+package crdt
+
+import (
+	"sync"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+// PNCounter is a counter that can be incremented and decremented, composed of
+// two grow-only counters: the value of the counter is the difference between
+// the increments and the decrements.
+type PNCounter struct {
+	sync.Mutex
+	increments *GCounter
+	decrements *GCounter
+}
+
+// NewPNCounter creates an increment/decrement counter for the local replica.
+func NewPNCounter(replica string) *PNCounter {
+	return &PNCounter{
+		increments: NewGCounter(replica),
+		decrements: NewGCounter(replica),
+	}
+}
+
+// Increment the counter by the specified amount.
+func (c *PNCounter) Increment(n uint64) {
+	c.Lock()
+	defer c.Unlock()
+	c.increments.Increment(n)
+}
+
+// Decrement the counter by the specified amount.
+func (c *PNCounter) Decrement(n uint64) {
+	c.Lock()
+	defer c.Unlock()
+	c.decrements.Increment(n)
+}
+
+// Value returns the difference of the increments and decrements.
+func (c *PNCounter) Value() int64 {
+	c.Lock()
+	defer c.Unlock()
+	return int64(c.increments.Value()) - int64(c.decrements.Value())
+}
+
+// Delta returns the serialized counts modified since the last call to Delta
+// and resets the delta, or nil if the counter has not been modified.
+func (c *PNCounter) Delta() ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.increments.Lock()
+	c.decrements.Lock()
+	defer c.increments.Unlock()
+	defer c.decrements.Unlock()
+
+	empty := len(c.increments.delta) == 0 && len(c.decrements.delta) == 0
+	state := &pb.PNCounter{
+		Increments: &pb.GCounter{Counts: c.increments.delta},
+		Decrements: &pb.GCounter{Counts: c.decrements.delta},
+	}
+
+	data, err := marshalDelta(state, empty)
+	if err == nil {
+		c.increments.delta = make(map[string]uint64)
+		c.decrements.delta = make(map[string]uint64)
+	}
+	return data, err
+}
+
+// State returns the serialized counts of all replicas.
+func (c *PNCounter) State() ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.increments.RLock()
+	c.decrements.RLock()
+	defer c.increments.RUnlock()
+	defer c.decrements.RUnlock()
+
+	return proto.Marshal(&pb.PNCounter{
+		Increments: &pb.GCounter{Counts: c.increments.counts},
+		Decrements: &pb.GCounter{Counts: c.decrements.counts},
+	})
+}
+
+// Merge a serialized delta or state, returning true if the counter changed.
+func (c *PNCounter) Merge(data []byte) (bool, error) {
+	state := new(pb.PNCounter)
+	if err := proto.Unmarshal(data, state); err != nil {
+		return false, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.increments.Lock()
+	c.decrements.Lock()
+	defer c.increments.Unlock()
+	defer c.decrements.Unlock()
+
+	incremented := c.increments.merge(state.Increments)
+	decremented := c.decrements.merge(state.Decrements)
+	return incremented || decremented, nil
+}
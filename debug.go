@@ -5,6 +5,7 @@ import (
 	"log"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // Levels for implementing the debug and trace message functionality.
@@ -21,9 +22,10 @@ const (
 // CautionThreshold for issuing caution logs after accumulating cautions.
 const CautionThreshold = 50
 
-// These variables are initialized in init()
+// These variables are initialized in init(); the log level is accessed
+// atomically since it can be modified at runtime by any server.
 var (
-	logLevel        = DefaultLogLevel
+	logLevel        = uint32(DefaultLogLevel)
 	logger          *log.Logger
 	cautionCounter  *counter
 	logLevelStrings = [...]string{
@@ -46,7 +48,7 @@ func (c *counter) init() {
 
 // LogLevel returns a string representation of the current level
 func LogLevel() string {
-	return logLevelStrings[logLevel]
+	return logLevelStrings[currentLogLevel()]
 }
 
 // SetLogLevel modifies the log level for messages at runtime. Ensures that
@@ -56,7 +58,12 @@ func SetLogLevel(level uint8) {
 		level = LogSilent
 	}
 
-	logLevel = level
+	atomic.StoreUint32(&logLevel, uint32(level))
+}
+
+// Returns the current log level.
+func currentLogLevel() uint8 {
+	return uint8(atomic.LoadUint32(&logLevel))
 }
 
 // SetLogger sets the logger for writing output to. Can set to a noplog to
@@ -72,7 +79,7 @@ func SetLogger(l *log.Logger) {
 // Print to the standard logger at the specified level. Arguments are handled
 // in the manner of log.Printf, but a newline is appended.
 func print(level uint8, msg string, a ...interface{}) {
-	if logLevel <= level {
+	if currentLogLevel() <= level {
 		if !strings.HasSuffix(msg, "\n") {
 			msg += "\n"
 		}
@@ -105,7 +112,7 @@ func status(msg string, a ...interface{}) {
 // NOTE: take care with string formatting individual messages, this could
 // lead to a very full caution counter that is taking up memory.
 func caution(msg string, a ...interface{}) {
-	if logLevel > LogCaution {
+	if currentLogLevel() > LogCaution {
 		// Don't waste memory if the log level is set below caution.
 		return
 	}
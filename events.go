@@ -1,6 +1,10 @@
 package livenet
 
-import "github.com/bbengfort/livenet/pb"
+import (
+	"sync"
+
+	"github.com/bbengfort/livenet/pb"
+)
 
 // Event types represented in LiveNet
 const (
@@ -9,12 +13,37 @@ const (
 	TimeoutEvent
 	HeartbeatTimeout
 	StatusTimeout
+	PeerOnlineEvent
+	PeerOfflineEvent
+	SubscriptionEvent
+	PublishEvent
+	TopicEvent
+	SendEvent
+	DirectMessageEvent
+	AntiEntropyTimeout
+	LockEvent
+	UnlockEvent
+	LockRetryTimeout
+	LockLostEvent
+	BarrierEvent
+	BarrierTimeout
+	SignatureRejectedEvent
+	TransferEvent
+	ConnectivityEvent
+	DatagramOnlineEvent
+	DatagramOfflineEvent
 )
 
 // Names of event types
 var eventTypeStrings = [...]string{
 	"error", "messageReceived",
 	"timeout", "heartbeatTimeout", "statusTimeout",
+	"peerOnline", "peerOffline",
+	"subscriptionChanged", "publish", "topicMessage",
+	"send", "directMessage", "antiEntropyTimeout",
+	"lock", "unlock", "lockRetryTimeout", "lockLost",
+	"barrier", "barrierTimeout", "signatureRejected",
+	"transfer", "connectivity", "datagramOnline", "datagramOffline",
 }
 
 //===========================================================================
@@ -35,6 +64,9 @@ func (t EventType) String() string {
 // Callback is a function that can receive events.
 type Callback func(Event) error
 
+// ListenerID identifies a registered callback so that it can be removed.
+type ListenerID uint64
+
 //===========================================================================
 // Event Definition and Methods
 //===========================================================================
@@ -79,3 +111,77 @@ type Dispatcher interface {
 	DispatchMessage(msg *pb.Envelope, source interface{}) error
 	DispatchError(err error, source interface{})
 }
+
+//===========================================================================
+// Event Listeners
+//===========================================================================
+
+// listener pairs a registered callback with the ID returned on registration.
+type listener struct {
+	id       ListenerID
+	callback Callback
+}
+
+// listeners maintains the callbacks registered for each event type. Callbacks
+// are stored in registration order, which is the order they are called in.
+type listeners struct {
+	sync.RWMutex
+	nextID    ListenerID
+	callbacks map[EventType][]listener
+}
+
+// add a callback for the event type and return its listener ID.
+func (l *listeners) add(etype EventType, callback Callback) ListenerID {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.callbacks == nil {
+		l.callbacks = make(map[EventType][]listener)
+	}
+
+	l.nextID++
+	l.callbacks[etype] = append(l.callbacks[etype], listener{id: l.nextID, callback: callback})
+	return l.nextID
+}
+
+// remove the callback with the specified ID, returning false if not found.
+func (l *listeners) remove(etype EventType, id ListenerID) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	registered := l.callbacks[etype]
+	for i, cb := range registered {
+		if cb.id == id {
+			// Copy into a new slice so that in-flight calls are not affected
+			updated := make([]listener, 0, len(registered)-1)
+			updated = append(updated, registered[:i]...)
+			updated = append(updated, registered[i+1:]...)
+			l.callbacks[etype] = updated
+			return true
+		}
+	}
+
+	return false
+}
+
+// count the number of callbacks registered for the event type.
+func (l *listeners) count(etype EventType) int {
+	l.RLock()
+	defer l.RUnlock()
+	return len(l.callbacks[etype])
+}
+
+// call each callback registered for the event type in order, stopping at
+// and returning the first error.
+func (l *listeners) call(e Event) error {
+	l.RLock()
+	registered := l.callbacks[e.Type()]
+	l.RUnlock()
+
+	for _, cb := range registered {
+		if err := cb.callback(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package livenet
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+)
+
+// Returns a callback that appends its name to the calls when it is called.
+func testCallback(calls *[]string, name string) Callback {
+	return func(e Event) error {
+		*calls = append(*calls, name)
+		return nil
+	}
+}
+
+func TestListenersOrder(t *testing.T) {
+	server, err := New(testConfigs(2)[0])
+	if err != nil {
+		t.Fatalf("could not create server: %s", err)
+	}
+
+	// The send event is queued by the built-in handler, which closes the
+	// source of the event once the message is queued.
+	queued := make(chan struct{})
+	e := &event{etype: SendEvent, source: queued, value: pb.Wrap("a", pb.MessageType_DIRECT, []byte("hello"))}
+
+	var calls []string
+	for _, name := range []string{"first", "second", "third"} {
+		server.On(SendEvent, testCallback(&calls, name))
+	}
+
+	server.On(SendEvent, func(e Event) error {
+		if stopped(queued) {
+			t.Error("listener was called after the built-in handler")
+		}
+		return nil
+	})
+
+	if err = server.Handle(e); err != nil {
+		t.Fatalf("could not handle event: %s", err)
+	}
+
+	if order := fmt.Sprint(calls); order != "[first second third]" {
+		t.Errorf("expected the listeners to be called in registration order, got %s", order)
+	}
+
+	if !stopped(queued) {
+		t.Error("the built-in handler was not called after the listeners")
+	}
+}
+
+func TestListenersOff(t *testing.T) {
+	server, err := New(testConfigs(2)[0])
+	if err != nil {
+		t.Fatalf("could not create server: %s", err)
+	}
+
+	var calls []string
+	first := server.On(ErrorEvent, testCallback(&calls, "first"))
+	second := server.On(ErrorEvent, testCallback(&calls, "second"))
+	server.On(ErrorEvent, testCallback(&calls, "third"))
+	other := server.On(TimeoutEvent, testCallback(&calls, "other"))
+
+	// Only the listener with the ID is removed from only its event type
+	if !server.Off(ErrorEvent, second) {
+		t.Fatal("could not remove the second listener")
+	}
+
+	if server.Off(ErrorEvent, second) {
+		t.Error("expected the removed listener to not be found again")
+	}
+
+	if server.Off(ErrorEvent, other) {
+		t.Error("expected a listener of another event type to not be removed")
+	}
+
+	if n := server.listeners.count(ErrorEvent); n != 2 {
+		t.Errorf("expected 2 error listeners, got %d", n)
+	}
+
+	if n := server.listeners.count(TimeoutEvent); n != 1 {
+		t.Errorf("expected 1 timeout listener, got %d", n)
+	}
+
+	if err = server.listeners.call(&event{etype: ErrorEvent}); err != nil {
+		t.Fatalf("could not call listeners: %s", err)
+	}
+
+	if order := fmt.Sprint(calls); order != "[first third]" {
+		t.Errorf("expected the remaining listeners to be called in order, got %s", order)
+	}
+
+	// Removing the first listener keeps the listener registered after it
+	server.Off(ErrorEvent, first)
+	calls = nil
+	server.listeners.call(&event{etype: ErrorEvent})
+	if order := fmt.Sprint(calls); order != "[third]" {
+		t.Errorf("expected only the third listener to be called, got %s", order)
+	}
+}
+
+func TestListenerErrorStopsServer(t *testing.T) {
+	server, err := New(testConfigs(1)[0])
+	if err != nil {
+		t.Fatalf("could not create server: %s", err)
+	}
+
+	var calls []string
+	failed := errors.New("listener failed")
+	server.On(SubscriptionEvent, testCallback(&calls, "first"))
+	server.On(SubscriptionEvent, func(e Event) error {
+		calls = append(calls, "failing")
+		return failed
+	})
+	server.On(SubscriptionEvent, testCallback(&calls, "third"))
+
+	errc := testListen(t, server)
+	server.Subscribe("topic", func(e Event) error { return nil })
+
+	// The error of the listener is returned by Listen as for an error event
+	select {
+	case err := <-errc:
+		if err != failed {
+			t.Errorf("expected the listener error to stop the server, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the server did not stop after the listener error")
+	}
+
+	if order := fmt.Sprint(calls); order != "[first failing]" {
+		t.Errorf("expected no listeners to be called after the error, got %s", order)
+	}
+}
@@ -0,0 +1,251 @@
+package livenet
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+// FaultsAll is the name of the link whose faults are injected on the links to
+// all peers that do not have faults of their own.
+const FaultsAll = "*"
+
+// errPartitioned is returned when connecting to a peer that is partitioned.
+var errPartitioned = errors.New("partitioned from peer")
+
+// Faults are the faults injected on the links to peers by name, or FaultsAll
+// for the links to all peers that do not have faults of their own.
+type Faults map[string]LinkFaults
+
+// LinkFaults are the faults injected on the envelopes sent to and received
+// from a peer: by the remote when it sends requests and receives replies, and
+// by the Post stream server when it receives requests. Each envelope is dropped,
+// duplicated, or has a random bit of its payload flipped with the specified
+// probabilities, and is delayed by the delay plus a random jitter. Since the
+// envelopes of a stream are handled in order, a delay also holds back the
+// envelopes behind it.
+type LinkFaults struct {
+	Drop      float64 `json:"drop,omitempty"`      // probability that an envelope is dropped
+	Duplicate float64 `json:"duplicate,omitempty"` // probability that an envelope is handled twice
+	Corrupt   float64 `json:"corrupt,omitempty"`   // probability that a bit of the payload is flipped
+	Delay     string  `json:"delay,omitempty"`     // time each envelope is delayed (parseable duration)
+	Jitter    string  `json:"jitter,omitempty"`    // maximum random time added to the delay (parseable duration)
+}
+
+// Returns the parsed faults or an error if a probability is not between 0 and
+// 1 or a duration cannot be parsed.
+func (f LinkFaults) parse() (l link, err error) {
+	for _, p := range []float64{f.Drop, f.Duplicate, f.Corrupt} {
+		if p < 0 || p > 1 {
+			return l, fmt.Errorf("fault probability %0.2f is not between 0 and 1", p)
+		}
+	}
+	l.drop, l.duplicate, l.corrupt = f.Drop, f.Duplicate, f.Corrupt
+
+	if f.Delay != "" {
+		if l.delay, err = time.ParseDuration(f.Delay); err != nil {
+			return l, fmt.Errorf("could not parse fault delay: %s", err)
+		}
+	}
+
+	if f.Jitter != "" {
+		if l.jitter, err = time.ParseDuration(f.Jitter); err != nil {
+			return l, fmt.Errorf("could not parse fault jitter: %s", err)
+		}
+	}
+
+	return l, nil
+}
+
+// GetFaults returns the faults to inject on links by peer name when the server
+// starts, or an error if the faults of a link are invalid.
+func (c *Config) GetFaults() (Faults, error) {
+	for name, faults := range c.Faults {
+		if _, err := faults.parse(); err != nil {
+			return nil, fmt.Errorf("invalid faults for %s: %s", name, err)
+		}
+	}
+	return c.Faults, nil
+}
+
+// link holds the parsed faults of a link.
+type link struct {
+	drop      float64
+	duplicate float64
+	corrupt   float64
+	delay     time.Duration
+	jitter    time.Duration
+}
+
+// faults holds the faults injected on the links to peers and the peers that
+// are partitioned, shared by the server and its remotes.
+type faults struct {
+	sync.RWMutex
+	specs       Faults          // faults of each link as specified
+	links       map[string]link // parsed faults of each link
+	partitioned map[string]bool // peers that cannot be reached
+}
+
+// Create the faults from the configuration, which has already been validated.
+func newFaults(config *Config) *faults {
+	f := &faults{
+		specs:       make(Faults),
+		links:       make(map[string]link),
+		partitioned: make(map[string]bool),
+	}
+
+	for name, spec := range config.Faults {
+		f.set(name, spec)
+	}
+	return f
+}
+
+// Set the faults of the link to the peer.
+func (f *faults) set(name string, spec LinkFaults) error {
+	l, err := spec.parse()
+	if err != nil {
+		return err
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	f.specs[name] = spec
+	f.links[name] = l
+	return nil
+}
+
+// Remove the faults of the link to the peer.
+func (f *faults) clear(name string) {
+	f.Lock()
+	defer f.Unlock()
+	delete(f.specs, name)
+	delete(f.links, name)
+}
+
+// Returns true if the peer is partitioned.
+func (f *faults) isPartitioned(name string) bool {
+	if f == nil {
+		return false
+	}
+
+	f.RLock()
+	defer f.RUnlock()
+	return f.partitioned[name]
+}
+
+// Inject the faults of the link to the peer on the envelope, returning the
+// envelopes to send or handle in its place: none if it is dropped and two if
+// it is duplicated. Returns after the delay of the link.
+func (f *faults) inject(name string, msg *pb.Envelope) []*pb.Envelope {
+	if f == nil {
+		return []*pb.Envelope{msg}
+	}
+
+	f.RLock()
+	l, ok := f.links[name]
+	if !ok {
+		l, ok = f.links[FaultsAll]
+	}
+	f.RUnlock()
+
+	if !ok {
+		return []*pb.Envelope{msg}
+	}
+
+	if delay := l.delay; delay > 0 || l.jitter > 0 {
+		if l.jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(l.jitter)))
+		}
+		time.Sleep(delay)
+	}
+
+	if rand.Float64() < l.drop {
+		trace("fault injected: dropped %s message on link to %s", msg.Type, name)
+		return nil
+	}
+
+	if rand.Float64() < l.corrupt && len(msg.Message) > 0 {
+		trace("fault injected: corrupted %s message on link to %s", msg.Type, name)
+		msg = proto.Clone(msg).(*pb.Envelope)
+		msg.Message[rand.Intn(len(msg.Message))] ^= 1 << uint(rand.Intn(8))
+	}
+
+	if rand.Float64() < l.duplicate {
+		trace("fault injected: duplicated %s message on link to %s", msg.Type, name)
+		return []*pb.Envelope{msg, proto.Clone(msg).(*pb.Envelope)}
+	}
+
+	return []*pb.Envelope{msg}
+}
+
+//===========================================================================
+// Server Fault Injection API
+//===========================================================================
+
+// InjectFaults sets the faults injected on the link to the named peer, or on
+// the links to all peers without faults of their own if the name is FaultsAll.
+func (s *Server) InjectFaults(name string, spec LinkFaults) error {
+	return s.faults.set(name, spec)
+}
+
+// ClearFaults stops injecting faults on the link to the named peer.
+func (s *Server) ClearFaults(name string) {
+	s.faults.clear(name)
+}
+
+// Faults returns the faults injected on links by peer name.
+func (s *Server) Faults() Faults {
+	s.faults.RLock()
+	defer s.faults.RUnlock()
+
+	specs := make(Faults, len(s.faults.specs))
+	for name, spec := range s.faults.specs {
+		specs[name] = spec
+	}
+	return specs
+}
+
+// Partition the named peers from the server: the streams to and from them are
+// closed, connections to them are not attempted, and streams from them are
+// rejected, so that they go offline on both sides until healed.
+func (s *Server) Partition(names ...string) {
+	s.faults.Lock()
+	for _, name := range names {
+		s.faults.partitioned[name] = true
+	}
+	s.faults.Unlock()
+
+	for _, name := range names {
+		if remote := s.remote(name); remote != nil {
+			remote.close()
+		}
+	}
+}
+
+// Heal the partition from the named peers so that they can reconnect.
+func (s *Server) Heal(names ...string) {
+	s.faults.Lock()
+	defer s.faults.Unlock()
+	for _, name := range names {
+		delete(s.faults.partitioned, name)
+	}
+}
+
+// Partitioned returns the sorted names of the peers that are partitioned.
+func (s *Server) Partitioned() []string {
+	s.faults.RLock()
+	defer s.faults.RUnlock()
+
+	names := make([]string, 0, len(s.faults.partitioned))
+	for name := range s.faults.partitioned {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,282 @@
+package livenet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+)
+
+// Records the payloads of the direct messages received by a server.
+type directLog struct {
+	sync.Mutex
+	payloads []string
+}
+
+func newDirectLog(server *Server) *directLog {
+	log := new(directLog)
+	server.On(DirectMessageEvent, func(e Event) error {
+		log.Lock()
+		defer log.Unlock()
+		log.payloads = append(log.payloads, string(e.Value().(*pb.Envelope).Message))
+		return nil
+	})
+	return log
+}
+
+// Returns the number of direct messages received with the payload.
+func (l *directLog) count(payload string) (n int) {
+	l.Lock()
+	defer l.Unlock()
+	for _, received := range l.payloads {
+		if received == payload {
+			n++
+		}
+	}
+	return n
+}
+
+// Returns the payloads received that are not one of the expected payloads.
+func (l *directLog) unexpected(expected ...string) (payloads []string) {
+	l.Lock()
+	defer l.Unlock()
+	for _, received := range l.payloads {
+		found := false
+		for _, payload := range expected {
+			if received == payload {
+				found = true
+			}
+		}
+
+		if !found {
+			payloads = append(payloads, received)
+		}
+	}
+	return payloads
+}
+
+// Create a cluster of two hosts and record the direct messages received by b.
+// The configurations are modified by the options before the cluster starts.
+func testFaults(t *testing.T, opts ...func(*Config)) (a, b *Server, log *directLog) {
+	t.Helper()
+	configs := testConfigs(2)
+	for _, config := range configs {
+		for _, opt := range opts {
+			opt(config)
+		}
+	}
+
+	servers := testCluster(t, configs)
+	testConnected(t, servers)
+	a, b = servers[0], servers[1]
+	return a, b, newDirectLog(b)
+}
+
+// Send a direct message from a to b, failing the test if it is not dispatched.
+func testSend(t *testing.T, a *Server, payload string) {
+	t.Helper()
+	if err := a.Send("b", []byte(payload)); err != nil {
+		t.Fatalf("could not send %q: %s", payload, err)
+	}
+}
+
+func TestFaultsDrop(t *testing.T) {
+	a, _, log := testFaults(t)
+	if err := a.InjectFaults("b", LinkFaults{Drop: 1}); err != nil {
+		t.Fatalf("could not inject faults: %s", err)
+	}
+
+	testSend(t, a, "dropped")
+	time.Sleep(200 * time.Millisecond)
+	if n := log.count("dropped"); n != 0 {
+		t.Errorf("expected the message to be dropped, received %d times", n)
+	}
+
+	// Messages are delivered once the faults are cleared
+	a.ClearFaults("b")
+	testSend(t, a, "delivered")
+	eventually(t, 2*time.Second, func() bool { return log.count("delivered") == 1 }, "message was not delivered after clearing faults")
+}
+
+func TestFaultsDuplicate(t *testing.T) {
+	a, _, log := testFaults(t)
+	if err := a.InjectFaults(FaultsAll, LinkFaults{Duplicate: 1}); err != nil {
+		t.Fatalf("could not inject faults: %s", err)
+	}
+
+	testSend(t, a, "duplicated")
+	eventually(t, 2*time.Second, func() bool { return log.count("duplicated") == 2 }, "message was not handled twice")
+
+	// The faults of the link take precedence over the faults of all links
+	if err := a.InjectFaults("b", LinkFaults{}); err != nil {
+		t.Fatalf("could not inject faults: %s", err)
+	}
+
+	testSend(t, a, "once")
+	eventually(t, 2*time.Second, func() bool { return log.count("once") == 1 }, "message was not delivered")
+	time.Sleep(100 * time.Millisecond)
+	if n := log.count("once"); n != 1 {
+		t.Errorf("expected the message to be handled once, received %d times", n)
+	}
+}
+
+func TestFaultsCorrupt(t *testing.T) {
+	a, b, log := testFaults(t)
+	if err := b.InjectFaults("a", LinkFaults{Corrupt: 1}); err != nil {
+		t.Fatalf("could not inject faults: %s", err)
+	}
+
+	// The payload of a direct message is opaque to the server, so it is handed
+	// to the handlers with a bit flipped.
+	testSend(t, a, "corrupted")
+	eventually(t, 2*time.Second, func() bool { return len(log.unexpected()) > 0 }, "corrupted message was not delivered")
+
+	payload := log.unexpected()[0]
+	if payload == "corrupted" || len(payload) != len("corrupted") {
+		t.Fatalf("expected a bit of the payload to be flipped, got %q", payload)
+	}
+
+	flipped := 0
+	for i := range payload {
+		for diff := payload[i] ^ "corrupted"[i]; diff != 0; diff &= diff - 1 {
+			flipped++
+		}
+	}
+
+	if flipped != 1 {
+		t.Errorf("expected one bit of the payload to be flipped, got %d", flipped)
+	}
+
+	// Both servers survive corrupted envelopes and deliver messages once the
+	// faults are cleared.
+	b.ClearFaults("a")
+	testConnected(t, []*Server{a, b})
+	eventually(t, 2*time.Second, func() bool {
+		testSend(t, a, "intact")
+		time.Sleep(50 * time.Millisecond)
+		return log.count("intact") > 0
+	}, "message was not delivered after clearing faults")
+
+	for _, server := range []*Server{a, b} {
+		if events, _ := server.channels(); events == nil {
+			t.Errorf("%s stopped listening after receiving corrupted envelopes", server.Name)
+		}
+	}
+}
+
+func TestFaultsDelay(t *testing.T) {
+	// Heartbeats are sent before direct messages, so they are sent less often
+	// than they are delayed to leave time for the direct message.
+	a, _, log := testFaults(t, func(c *Config) { c.Tick = "500ms" })
+	if err := a.InjectFaults("b", LinkFaults{Delay: "300ms", Jitter: "50ms"}); err != nil {
+		t.Fatalf("could not inject faults: %s", err)
+	}
+
+	testSend(t, a, "delayed")
+	time.Sleep(150 * time.Millisecond)
+	if n := log.count("delayed"); n != 0 {
+		t.Fatalf("expected the message to be delayed, received %d times", n)
+	}
+
+	eventually(t, 2*time.Second, func() bool { return log.count("delayed") == 1 }, "delayed message was not delivered")
+}
+
+func TestPartitionAndHeal(t *testing.T) {
+	servers := testCluster(t, testConfigs(3))
+	testConnected(t, servers)
+	a, b, c := servers[0], servers[1], servers[2]
+	eventsA, eventsB := newPeerEvents(a), newPeerEvents(b)
+	log := newDirectLog(b)
+
+	a.Partition("b")
+	if partitioned := a.Partitioned(); len(partitioned) != 1 || partitioned[0] != "b" {
+		t.Fatalf("expected b to be partitioned, got %v", partitioned)
+	}
+
+	// Both sides of the partition go offline and stay offline
+	eventually(t, 2*time.Second, func() bool { _, offline := eventsA.count("b"); return offline > 0 }, "a did not see b go offline")
+	eventually(t, 2*time.Second, func() bool { _, offline := eventsB.count("a"); return offline > 0 }, "b did not see a go offline")
+	time.Sleep(200 * time.Millisecond)
+	if a.remote("b").Online() {
+		t.Error("a reconnected to b while partitioned")
+	}
+
+	// The peers that are not partitioned stay connected
+	testConnected(t, []*Server{c})
+
+	a.Heal("b")
+	if partitioned := a.Partitioned(); len(partitioned) != 0 {
+		t.Fatalf("expected no partitions after healing, got %v", partitioned)
+	}
+
+	testConnected(t, servers)
+	eventually(t, 2*time.Second, func() bool {
+		testSend(t, a, "healed")
+		time.Sleep(50 * time.Millisecond)
+		return log.count("healed") > 0
+	}, "message was not delivered after healing the partition")
+}
+
+func TestAdminAddr(t *testing.T) {
+	for addr, expected := range map[string]string{
+		":9000":          "localhost:9000",
+		"0.0.0.0:9000":   "0.0.0.0:9000",
+		"10.0.0.1:9000":  "10.0.0.1:9000",
+		"localhost:9000": "localhost:9000",
+	} {
+		if actual := adminAddr(addr); actual != expected {
+			t.Errorf("expected admin api on %q to be served on %q, got %q", addr, expected, actual)
+		}
+	}
+}
+
+func TestAdminTokens(t *testing.T) {
+	config := testConfigs(2)[0]
+	config.Tokens = []string{"new", "old"}
+	server, err := New(config)
+	if err != nil {
+		t.Fatalf("could not create server: %s", err)
+	}
+	handler := server.adminHandler()
+
+	for _, tt := range []struct {
+		auth   string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer ", http.StatusUnauthorized},
+		{"new", http.StatusUnauthorized},
+		{"Bearer new", http.StatusOK},
+		{"Bearer old", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodPut, "/partitions/b", nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("expected status %d with authorization %q, got %d", tt.status, tt.auth, w.Code)
+		}
+	}
+
+	// Only the authorized requests partitioned the peer
+	if partitioned := server.Partitioned(); len(partitioned) != 1 || partitioned[0] != "b" {
+		t.Errorf("expected b to be partitioned, got %v", partitioned)
+	}
+
+	// Requests are not authenticated if no tokens are configured
+	server.config.Tokens = nil
+	req := httptest.NewRequest(http.MethodDelete, "/partitions/b", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "[]") {
+		t.Errorf("expected the partition to be healed without a token, got %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,166 @@
+package livenet
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+)
+
+// gossip implements a heartbeat-counter failure detector so that the liveness
+// of hosts that are not neighbors in the topology can be determined. Every
+// host increments its own counter on each heartbeat and gossips the counters
+// of all hosts it knows of to its neighbors. A host is considered alive if
+// its counter has increased within the gossip timeout.
+//
+// Each counter is gossiped with the incarnation of the host, the time the
+// server was created, so that the counter of a host that restarts from zero
+// supersedes the counter of its previous incarnation.
+type gossip struct {
+	sync.RWMutex
+	incarnation uint64           // local incarnation, increases when the host restarts
+	counter     uint64           // local heartbeat counter
+	heard       map[string]heard // last counter and time it increased by host
+	alive       map[string]bool  // liveness of the hosts that are not neighbors as last seen by the event loop
+}
+
+// heard records the last counter received from a host and when it was seen.
+type heard struct {
+	incarnation uint64
+	counter     uint64
+	updated     time.Time
+}
+
+// Increment the local counter and return the counters and incarnations to
+// gossip.
+func (g *gossip) tick(local string) (counters, incarnations map[string]uint64) {
+	g.Lock()
+	defer g.Unlock()
+
+	g.counter++
+	counters = make(map[string]uint64, len(g.heard)+1)
+	incarnations = make(map[string]uint64, len(g.heard)+1)
+	for host, h := range g.heard {
+		counters[host] = h.counter
+		incarnations[host] = h.incarnation
+	}
+	counters[local] = g.counter
+	incarnations[local] = g.incarnation
+	return counters, incarnations
+}
+
+// Merge the gossiped counters, recording the time any counter increased or
+// a host was heard from in a new incarnation. Counters gossiped by hosts that
+// do not send incarnations are in incarnation zero.
+func (g *gossip) merge(local string, counters, incarnations map[string]uint64) {
+	g.Lock()
+	defer g.Unlock()
+
+	if g.heard == nil {
+		g.heard = make(map[string]heard)
+	}
+
+	now := time.Now()
+	for host, counter := range counters {
+		if host == local {
+			continue
+		}
+
+		incarnation := incarnations[host]
+		h, ok := g.heard[host]
+		if !ok || incarnation > h.incarnation || (incarnation == h.incarnation && counter > h.counter) {
+			g.heard[host] = heard{incarnation: incarnation, counter: counter, updated: now}
+		}
+	}
+}
+
+// Returns the time since the counter of the host last increased and whether
+// the host has been heard from at all.
+func (g *gossip) since(host string) (time.Duration, bool) {
+	g.RLock()
+	defer g.RUnlock()
+
+	h, ok := g.heard[host]
+	if !ok {
+		return 0, false
+	}
+	return time.Since(h.updated), true
+}
+
+//===========================================================================
+// Server Liveness API
+//===========================================================================
+
+// Alive returns true if the host is reachable: neighbors are alive if the
+// stream to the remote is online, other hosts are alive if their gossiped
+// heartbeat counter has increased within the gossip timeout.
+func (s *Server) Alive(name string) bool {
+	if name == s.Name {
+		return true
+	}
+
+	if remote := s.remote(name); remote != nil {
+		return remote.Online()
+	}
+
+	since, ok := s.gossip.since(name)
+	return ok && since < s.gossipTimeout()
+}
+
+// Merge the heartbeat counters gossiped by a neighbor.
+func (s *Server) onGossip(hb *pb.Heartbeat) {
+	if len(hb.Counters) > 0 {
+		s.gossip.merge(s.Name, hb.Counters, hb.Incarnations)
+	}
+}
+
+// Detect the hosts that are not neighbors coming online or going offline by
+// their gossiped heartbeat counters and the routing table, since a host whose
+// counter is gossiped may not be routable yet. As for remotes on peer events,
+// hosts that come online are sent the local subscriptions, and the interests
+// and lock leases of hosts that go offline are forgotten.
+func (s *Server) updateIndirect() error {
+	if s.gossip.alive == nil {
+		s.gossip.alive = make(map[string]bool)
+	}
+
+	for _, name := range s.peerNames() {
+		if s.remote(name) != nil {
+			continue
+		}
+
+		_, routed := s.routes.table[name]
+		alive := routed && s.Alive(name)
+		if alive == s.gossip.alive[name] {
+			continue
+		}
+		s.gossip.alive[name] = alive
+
+		if alive {
+			info("indirect host %s is now online", name)
+			msg, err := s.subscriptions()
+			if err != nil {
+				return err
+			}
+
+			if err = s.sendTo(name, msg.Type, msg.Message); err != nil {
+				return err
+			}
+			continue
+		}
+
+		info("indirect host %s is now offline", name)
+		delete(s.topics.interests, name)
+		if err := s.expireLocks(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the gossip timeout, ignoring errors since the configuration is
+// validated when the server is created.
+func (s *Server) gossipTimeout() time.Duration {
+	timeout, _ := s.config.GetGossipTimeout()
+	return timeout
+}
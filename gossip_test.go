@@ -0,0 +1,92 @@
+package livenet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+)
+
+func TestGossipIncarnations(t *testing.T) {
+	g := &gossip{incarnation: 2}
+	g.merge("a", map[string]uint64{"b": 100}, map[string]uint64{"b": 1})
+
+	// A host that restarts gossips a lower counter in a new incarnation
+	g.merge("a", map[string]uint64{"b": 3}, map[string]uint64{"b": 2})
+	if h := g.heard["b"]; h.incarnation != 2 || h.counter != 3 {
+		t.Errorf("counter of the new incarnation was not merged: %+v", h)
+	}
+
+	// Counters of the previous incarnation are stale, however high
+	g.merge("a", map[string]uint64{"b": 200}, map[string]uint64{"b": 1})
+	if h := g.heard["b"]; h.incarnation != 2 || h.counter != 3 {
+		t.Errorf("counter of a previous incarnation was merged: %+v", h)
+	}
+
+	// The local counter is gossiped with the local incarnation
+	counters, incarnations := g.tick("a")
+	if counters["a"] != 1 || incarnations["a"] != 2 || incarnations["b"] != 2 {
+		t.Errorf("unexpected gossip %v %v", counters, incarnations)
+	}
+}
+
+func TestStarTopologyReachesAllHosts(t *testing.T) {
+	configs := testConfigs(4)
+	for _, config := range configs {
+		config.Topology = TopologyStar
+	}
+
+	servers := testCluster(t, configs)
+	testConnected(t, servers)
+	b, c, d := servers[1], servers[2], servers[3]
+	if b.remote("d") != nil {
+		t.Fatal("expected spokes of the star not to be neighbors")
+	}
+
+	// Publications are relayed by the hub to subscribers that are not neighbors
+	received := make(chan string, 16)
+	d.Subscribe("news", func(e Event) error {
+		received <- string(e.Value().(*pb.Publication).Payload)
+		return nil
+	})
+
+	eventually(t, 3*time.Second, func() bool {
+		if err := b.Publish("news", []byte("hello")); err != nil {
+			t.Fatalf("could not publish: %s", err)
+		}
+
+		select {
+		case payload := <-received:
+			return payload == "hello"
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}, "publication from b did not reach d")
+
+	// The lock requires a majority of the four hosts, which a spoke can only
+	// reach with the votes of the other spokes.
+	eventually(t, 3*time.Second, func() bool { return b.Alive("c") && b.Alive("d") }, "b did not hear from c and d")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := b.Lock(ctx, "resource"); err != nil {
+		t.Fatalf("b could not acquire the lock: %s", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := c.Lock(ctx, "resource"); err != context.DeadlineExceeded {
+		t.Fatalf("expected c not to acquire the lock held by b, got %v", err)
+	}
+
+	if err := b.Unlock("resource"); err != nil {
+		t.Fatalf("b could not release the lock: %s", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := c.Lock(ctx, "resource"); err != nil {
+		t.Fatalf("c could not acquire the released lock: %s", err)
+	}
+}
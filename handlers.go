@@ -1,17 +1,86 @@
 package livenet
 
 import (
-	"strings"
+	"fmt"
+	"sync"
+	"sync/atomic"
 
 	"github.com/bbengfort/livenet/pb"
 )
 
-// Broadcast a heartbeat message to all remote peers.
+// callbackError is returned by the handlers of messages when a callback of the
+// application fails, which stops the server like the errors of any callback.
+// All other errors handling a message are caused by the envelope, which is
+// dropped so that a malformed envelope from a peer cannot stop the server.
+type callbackError struct {
+	error
+}
+
+// invalid counts the envelopes that were dropped because they could not be
+// handled, by the host that was claimed to have sent them.
+type invalid struct {
+	sync.Mutex
+	counts map[string]uint64
+}
+
+// Count an envelope dropped because it could not be handled.
+func (i *invalid) add(sender string) {
+	i.Lock()
+	defer i.Unlock()
+	if i.counts == nil {
+		i.counts = make(map[string]uint64)
+	}
+	i.counts[sender]++
+}
+
+// Invalid returns the number of envelopes that were dropped because they could
+// not be handled, e.g. because their payload could not be decoded or their
+// type is unknown, by the host that was claimed to have sent them.
+func (s *Server) Invalid() map[string]uint64 {
+	s.invalid.Lock()
+	defer s.invalid.Unlock()
+
+	counts := make(map[string]uint64, len(s.invalid.counts))
+	for sender, count := range s.invalid.counts {
+		counts[sender] = count
+	}
+	return counts
+}
+
+// Broadcast a heartbeat message to all remote peers, advertising the routes
+// known to this server so that neighbors can relay messages through it,
+// gossiping heartbeat counters so that non-neighbors can detect liveness, and
+// piggybacking the deltas of replicated data types.
 func (s *Server) onHeartbeatTimeout(e Event) error {
 	trace("heartbeat timeout")
 
-	msg := pb.Wrap(s.Name, pb.MessageType_HEARTBEAT, nil)
+	s.updateRoutes()
+	counters, incarnations := s.gossip.tick(s.Name)
+	if err := s.updateIndirect(); err != nil {
+		return err
+	}
+
+	deltas, err := s.drainDeltas()
+	if err != nil {
+		return err
+	}
+
 	for _, remote := range s.remotes {
+		// Resend the full state if a heartbeat with deltas was discarded
+		if remote.discardedHeartbeat() {
+			s.resendReplicas(remote.Name)
+		}
+
+		replicas, err := s.replicaDeltas(remote.Name, deltas)
+		if err != nil {
+			return err
+		}
+
+		msg, err := s.heartbeat(remote.Name, counters, incarnations, replicas)
+		if err != nil {
+			return err
+		}
+
 		if err := remote.Send(msg); err != nil {
 			return err
 		}
@@ -20,26 +89,130 @@ func (s *Server) onHeartbeatTimeout(e Event) error {
 	return nil
 }
 
-// Print the status of the remote connections
+// Print the status of the remote connections to neighbors, the liveness of the
+// indirect peers that are not neighbors in the topology, and the liveness of
+// all peers by heartbeat datagrams if enabled.
 func (s *Server) onStatusTimeout(e Event) error {
-	info("%s online with %d clients connected", s.Name, s.clients)
+	info("%s online with %d clients connected", s.Name, atomic.LoadUint64(&s.clients))
 	for _, remote := range s.remotes {
-		status := remote.Status()
-		status = strings.Replace(status, "%", "%%", -1) // escape percents
-		info(status)
+		info("neighbor %s", remote.Status())
+	}
+
+	for _, peer := range s.config.Peers {
+		if peer.Name == s.Name || s.remote(peer.Name) != nil {
+			continue
+		}
+		info("indirect %s", s.indirectStatus(peer.Name))
+	}
+
+	for name, metrics := range s.Datagrams() {
+		info("%s %s", name, metrics)
 	}
 	return nil
 }
 
-// Send acknowledgment to the heartbeat message
+// Update the routes and send the local subscriptions to a remote that has just
+// come online; the remote replies with its own subscriptions, establishing
+// interests both ways. Also reconciles any state that diverged while offline,
+// sends the full state of replicated data types on the next heartbeat, and
+// resends the arrivals at barriers that the remote may have missed.
+func (s *Server) onPeerOnlineEvent(e Event) error {
+	remote := e.Source().(*Remote)
+	s.updateRoutes()
+	s.resendReplicas(remote.Name)
+
+	msg, err := s.subscriptions()
+	if err != nil {
+		return err
+	}
+
+	if err = remote.Send(msg); err != nil {
+		return err
+	}
+
+	if err = s.reconcile(remote); err != nil {
+		return err
+	}
+	return s.resendArrivals(remote)
+}
+
+// Forget the interests and routes of a remote that has gone offline, they will
+// be re-established when the remote comes back online. Also expires the lock
+// leases held by or granted by the remote.
+func (s *Server) onPeerOfflineEvent(e Event) error {
+	remote := e.Source().(*Remote)
+	delete(s.topics.interests, remote.Name)
+	s.dropRoutes(remote.Name)
+	return s.expireLocks(remote.Name)
+}
+
+// Handle the message by its type and send the reply back to the client if the
+// message was received by the Post stream server. Replies received by a Remote
+// are handled in the same way, but no reply is sent in return. Envelopes that
+// cannot be handled are logged, counted, and dropped; the client is sent an
+// empty heartbeat in reply so that it is never left waiting.
 func (s *Server) onMessageEvent(e Event) error {
 	in := e.Value().(*pb.Envelope)
 	trace("received %s message from %s", in.Type, in.Sender)
 
-	msg := pb.Wrap(s.Name, pb.MessageType_HEARTBEAT, nil)
+	var (
+		msg *pb.Envelope
+		err error
+	)
+
+	switch {
+	case in.Recipient != "" && in.Recipient != s.Name:
+		// Relay messages addressed to other hosts and acknowledge them
+		if err = s.forward(in); err == nil {
+			msg = pb.Wrap(s.Name, pb.MessageType_HEARTBEAT, nil)
+		}
+	case in.Type == pb.MessageType_HEARTBEAT:
+		msg, err = s.onHeartbeat(in)
+	case in.Type == pb.MessageType_SUBSCRIBE:
+		msg, err = s.onSubscribe(in)
+	case in.Type == pb.MessageType_PUBLISH:
+		msg, err = s.onPublish(in)
+	case in.Type == pb.MessageType_DIRECT:
+		msg, err = s.onDirect(in)
+	case in.Type == pb.MessageType_SYNC:
+		msg, err = s.onSync(in, e.Source())
+	case in.Type == pb.MessageType_LOCK:
+		msg, err = s.onLock(in)
+	case in.Type == pb.MessageType_BARRIER:
+		msg, err = s.onBarrier(in)
+	case in.Type == pb.MessageType_CHUNK:
+		msg, err = s.onChunk(in)
+	default:
+		err = fmt.Errorf("no handler identified for message %s", in.Type)
+	}
+
+	if err != nil {
+		if cerr, ok := err.(callbackError); ok {
+			return cerr.error
+		}
+
+		warn("dropped %s message %s from %s: %s", in.Type, in.Id, in.Sender, err)
+		s.invalid.add(in.Sender)
+		msg = nil
+	}
+
+	// Replies to requests relayed from hosts that are not neighbors are sent
+	// back over the routing table, and the relay is sent an empty heartbeat.
+	if _, relayed := in.Header(HeaderRelay); relayed && in.Recipient == s.Name && msg != nil {
+		if !isReply(in) && (msg.Type != pb.MessageType_HEARTBEAT || len(msg.Message) > 0) {
+			reply := pb.WrapTo(s.Name, in.Sender, s.maxHops(), msg.Type, msg.Message)
+			reply.SetHeader(HeaderReplyTo, in.Id)
+			if err = s.route(reply); err != nil {
+				return err
+			}
+		}
+		msg = nil
+	}
 
-	// TODO: better message type handling rather than checking the source
 	if src, ok := e.Source().(chan *pb.Envelope); ok {
+		if msg == nil {
+			msg = pb.Wrap(s.Name, pb.MessageType_HEARTBEAT, nil)
+		}
 		src <- msg
 	}
 	return nil
@@ -0,0 +1,61 @@
+package livenet
+
+import (
+	"testing"
+
+	"github.com/bbengfort/livenet/pb"
+)
+
+func TestInvalidEnvelopesAreDropped(t *testing.T) {
+	configs := testConfigs(2)
+	servers := testCluster(t, configs[:1])
+	server := servers[0]
+
+	// Connect to the server as the second host without running it
+	stream, err := server.transport.Dial(server.Endpoint(false), server.Name, peerName(configs[1]))
+	if err != nil {
+		t.Fatalf("could not connect to %s: %s", server.Name, err)
+	}
+	defer stream.Close()
+
+	// Streams on the memory transport are unbuffered, so the header of the
+	// server is read before sending as the receive routine of a remote does.
+	if _, err = stream.Header(); err != nil {
+		t.Fatalf("no header from %s: %s", server.Name, err)
+	}
+
+	requests := []*pb.Envelope{
+		pb.Wrap("b", pb.MessageType_SUBSCRIBE, []byte{0x0a, 0xff}),
+		pb.Wrap("b", pb.MessageType_LOCK, []byte{0xff}),
+		pb.Wrap("b", pb.MessageType(99), nil),
+		pb.Wrap("b", pb.MessageType_HEARTBEAT, nil),
+	}
+
+	// Every request is replied to, including the envelopes that are dropped
+	for _, req := range requests {
+		if err = stream.Send(req); err != nil {
+			t.Fatalf("could not send %s message: %s", req.Type, err)
+		}
+
+		reply, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("no reply to %s message: %s", req.Type, err)
+		}
+
+		if reply.Type != pb.MessageType_HEARTBEAT {
+			t.Errorf("expected heartbeat reply to %s message, got %s", req.Type, reply.Type)
+		}
+
+		if replyTo, _ := reply.Header(HeaderReplyTo); replyTo != req.Id {
+			t.Errorf("reply to %s message is for %q", req.Type, replyTo)
+		}
+	}
+
+	if invalid := server.Invalid()["b"]; invalid != 3 {
+		t.Errorf("expected 3 invalid envelopes from b, got %d", invalid)
+	}
+
+	if events, _ := server.channels(); events == nil {
+		t.Error("server stopped listening after receiving invalid envelopes")
+	}
+}
@@ -0,0 +1,142 @@
+package livenet
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/keepalive"
+)
+
+// DefaultKeepaliveTimeout is how long to wait for the reply to a keepalive
+// ping before the connection is considered broken.
+const DefaultKeepaliveTimeout = 20 * time.Second
+
+// GetKeepalive returns the interval of inactivity after which connections to
+// peers are pinged to check that they are alive, zero if disabled.
+func (c *Config) GetKeepalive() (interval time.Duration, err error) {
+	if c.Keepalive == "" {
+		return 0, nil
+	}
+	if interval, err = time.ParseDuration(c.Keepalive); err != nil {
+		return interval, fmt.Errorf("could not parse keepalive interval: %s", err)
+	}
+	return interval, nil
+}
+
+// GetKeepaliveTimeout returns how long to wait for the reply to a keepalive
+// ping or DefaultKeepaliveTimeout if not specified.
+func (c *Config) GetKeepaliveTimeout() (timeout time.Duration, err error) {
+	if c.KeepaliveTimeout == "" {
+		return DefaultKeepaliveTimeout, nil
+	}
+	if timeout, err = time.ParseDuration(c.KeepaliveTimeout); err != nil {
+		return timeout, fmt.Errorf("could not parse keepalive timeout: %s", err)
+	}
+	return timeout, nil
+}
+
+// Returns the server options that ping clients and permit the pings of
+// clients at the configured keepalive interval, none if disabled.
+func serverKeepalive(c *Config) []grpc.ServerOption {
+	interval, _ := c.GetKeepalive()
+	if interval == 0 {
+		return nil
+	}
+
+	timeout, _ := c.GetKeepaliveTimeout()
+	return []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{Time: interval, Timeout: timeout}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: interval / 2, PermitWithoutStream: true}),
+	}
+}
+
+// Returns the dial options that ping the server at the configured keepalive
+// interval, none if disabled.
+func clientKeepalive(c *Config) []grpc.DialOption {
+	interval, _ := c.GetKeepalive()
+	if interval == 0 {
+		return nil
+	}
+
+	timeout, _ := c.GetKeepaliveTimeout()
+	return []grpc.DialOption{
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{Time: interval, Timeout: timeout, PermitWithoutStream: true}),
+	}
+}
+
+// Watch the connectivity state of the connection to the remote until it is
+// shut down, dispatching an event for each transition. If the connection
+// fails, e.g. because keepalive pings are not answered, the remote goes
+// offline without waiting for an error on the stream.
+func (r *Remote) watch(stream *grpcStream) {
+	state := stream.conn.GetState()
+	for stream.conn.WaitForStateChange(context.Background(), state) {
+		state = stream.conn.GetState()
+		r.actor.Dispatch(&event{etype: ConnectivityEvent, source: r, value: state})
+
+		switch state {
+		case connectivity.TransientFailure:
+			r.RLock()
+			current := r.stream == stream
+			r.RUnlock()
+
+			if current {
+				caution("connection to %s failed", r.Name)
+				r.close()
+			}
+		case connectivity.Shutdown:
+			return
+		}
+	}
+}
+
+// Ping the remote on streams without gRPC keepalives when nothing has been
+// received for the keepalive interval, closing the stream if nothing is
+// received within the keepalive timeout of the ping. The receive routine of
+// the stream signals alive whenever it receives a message from the remote.
+func (r *Remote) keepalive(stream ClientStream, alive <-chan struct{}, interval, timeout time.Duration) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	pinged := false
+	for {
+		select {
+		case <-alive:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			pinged = false
+			timer.Reset(interval)
+		case <-timer.C:
+			r.RLock()
+			current := r.stream == stream
+			r.RUnlock()
+
+			if !current {
+				return
+			}
+
+			if pinged {
+				caution("keepalive to %s timed out", r.Name)
+				r.close()
+				return
+			}
+
+			// The remote replies to the heartbeat if the stream is alive
+			pinged = true
+			r.Send(pb.Wrap(r.config.Name, pb.MessageType_HEARTBEAT, nil))
+			timer.Reset(timeout)
+		}
+	}
+}
+
+// Log the connectivity state transitions of remotes; the listeners have been
+// called with the event before this handler.
+func (s *Server) onConnectivityEvent(e Event) error {
+	trace("connection to %s is %s", e.Source().(*Remote).Name, e.Value())
+	return nil
+}
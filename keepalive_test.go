@@ -0,0 +1,31 @@
+package livenet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeepaliveOffline(t *testing.T) {
+	a, b, _ := testFaults(t, func(c *Config) {
+		c.Keepalive = "100ms"
+		c.KeepaliveTimeout = "100ms"
+	})
+	events := newPeerEvents(a)
+
+	// Every envelope on the link to b is dropped, so the stream stays open but
+	// the keepalive pings are never answered.
+	if err := a.InjectFaults("b", LinkFaults{Drop: 1}); err != nil {
+		t.Fatalf("could not inject faults: %s", err)
+	}
+	eventually(t, 2*time.Second, func() bool { _, offline := events.count("b"); return offline > 0 }, "b did not go offline when keepalive failed")
+
+	// The remote comes back online and stays online once the link recovers
+	a.ClearFaults("b")
+	testConnected(t, []*Server{a, b})
+
+	_, offline := events.count("b")
+	time.Sleep(500 * time.Millisecond)
+	if _, after := events.count("b"); after != offline || !a.remote("b").Online() {
+		t.Errorf("b went offline %d times after the link recovered", after-offline)
+	}
+}
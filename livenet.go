@@ -38,20 +38,103 @@ func New(config *Config) (server *Server, err error) {
 		return nil, err
 	}
 
+	if _, err = config.GetGossipTimeout(); err != nil {
+		return nil, err
+	}
+
+	if _, err = config.GetAntiEntropy(); err != nil {
+		return nil, err
+	}
+
+	if _, err = config.GetCompression(); err != nil {
+		return nil, err
+	}
+
+	if _, err = config.GetTokens(); err != nil {
+		return nil, err
+	}
+
+	if _, err = config.GetQueueOverflow(); err != nil {
+		return nil, err
+	}
+
+	if _, err = config.GetBatchWindow(); err != nil {
+		return nil, err
+	}
+
+	if _, err = config.GetChunkSize(); err != nil {
+		return nil, err
+	}
+
+	if _, err = config.GetOutboxAge(); err != nil {
+		return nil, err
+	}
+
+	if _, err = config.GetReconnectBackoff(); err != nil {
+		return nil, err
+	}
+
+	if _, err = config.GetReconnectMax(); err != nil {
+		return nil, err
+	}
+
+	if _, err = config.GetBreakerTimeout(); err != nil {
+		return nil, err
+	}
+
+	if _, err = config.GetKeepalive(); err != nil {
+		return nil, err
+	}
+
+	if _, err = config.GetKeepaliveTimeout(); err != nil {
+		return nil, err
+	}
+
+	if _, err = config.GetTransport(); err != nil {
+		return nil, err
+	}
+
+	if _, err = config.GetDatagramTimeout(); err != nil {
+		return nil, err
+	}
+
+	if _, err = config.GetFaults(); err != nil {
+		return nil, err
+	}
+
 	// Set the logging level and the random seed
 	config.SetLogLevel()
 	config.SetSeed()
 
 	// Create the server object
-	server = &Server{config: config}
+	server = &Server{config: config, faults: newFaults(config)}
+	server.gossip.incarnation = uint64(time.Now().UnixNano())
+	if server.transport, err = config.GetTransport(); err != nil {
+		return nil, err
+	}
+
 	if server.Peer, err = config.GetPeer(); err != nil {
 		return nil, err
 	}
 
+	// Load the keys to sign and verify envelopes
+	if server.keys, err = config.keyring(); err != nil {
+		return nil, err
+	}
+
 	// Create the remotes
 	if server.remotes, err = config.GetRemotes(server); err != nil {
 		return nil, err
 	}
 
+	for _, remote := range server.remotes {
+		remote.keys = server.keys
+		remote.transport = server.transport
+		remote.faults = server.faults
+		if remote.outbox, err = openOutbox(config, remote.Name); err != nil {
+			return nil, err
+		}
+	}
+
 	return server, nil
 }
@@ -0,0 +1,95 @@
+package livenet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/x/peers"
+)
+
+// Ports of the hosts of the test clusters, which are incremented so that the
+// clusters of different tests never share an address on the memory network.
+var testPorts uint32 = 20000
+
+func TestMain(m *testing.M) {
+	SetLogger(log.New(ioutil.Discard, "", 0))
+	os.Exit(m.Run())
+}
+
+// Returns the configurations of a cluster of n hosts named a, b, c, ... that
+// stream envelopes over the memory transport with a short tick.
+func testConfigs(n int) []*Config {
+	base := atomic.AddUint32(&testPorts, uint32(n)) - uint32(n)
+	network := make([]Peer, 0, n)
+	for i := 0; i < n; i++ {
+		network = append(network, Peer{Peer: peers.Peer{
+			PID: uint16(i + 1), Name: string(rune('a' + i)), IPAddr: "127.0.0.1", Port: uint16(base) + uint16(i),
+		}})
+	}
+
+	configs := make([]*Config, 0, n)
+	for _, peer := range network {
+		configs = append(configs, &Config{
+			Name: peer.Name, Tick: "50ms", LogLevel: int(LogSilent), Transport: TransportMemory, Peers: network,
+		})
+	}
+	return configs
+}
+
+// Create a server for each configuration and listen on all of them, closing
+// them when the test is done. Every server is created before any listens.
+func testCluster(t testing.TB, configs []*Config) []*Server {
+	t.Helper()
+	servers := make([]*Server, 0, len(configs))
+	for _, config := range configs {
+		server, err := New(config)
+		if err != nil {
+			t.Fatalf("could not create server %s: %s", config.Name, err)
+		}
+		servers = append(servers, server)
+	}
+
+	for _, server := range servers {
+		testListen(t, server)
+	}
+	return servers
+}
+
+// Listen on the server in its own goroutine, returning a channel with the
+// error returned by Listen, and close it when the test is done.
+func testListen(t testing.TB, server *Server) <-chan error {
+	t.Helper()
+	errc := make(chan error, 1)
+	go func() { errc <- server.Listen() }()
+	eventually(t, time.Second, func() bool { events, _ := server.channels(); return events != nil }, "%s did not listen", server.Name)
+
+	t.Cleanup(func() { server.Close() })
+	return errc
+}
+
+// Wait for every server to be connected to every one of its remotes.
+func testConnected(t testing.TB, servers []*Server) {
+	t.Helper()
+	for _, server := range servers {
+		for _, remote := range server.remotes {
+			eventually(t, 2*time.Second, remote.Online, "%s did not connect to %s", server.Name, remote.Name)
+		}
+	}
+}
+
+// Poll the condition until it is true or fail the test after the timeout.
+func eventually(t testing.TB, timeout time.Duration, cond func() bool, format string, args ...interface{}) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("after %s: %s", timeout, fmt.Sprintf(format, args...))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
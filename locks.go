@@ -0,0 +1,415 @@
+package livenet
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+// Lock errors returned to the application.
+var (
+	ErrLockHeld    = errors.New("lock is already held or requested by this server")
+	ErrLockNotHeld = errors.New("lock is not held by this server")
+)
+
+// locks implements a distributed lock service by majority voting: to acquire
+// a lock a server requests the vote of every host on the network (including
+// itself) and holds the lock once a majority has voted for it. Every host
+// votes for at most one server per lock and queues the other requests until
+// the vote is released. Votes are leases tied to liveness: a host releases
+// its vote when the holder goes offline (its remote disconnects or, if it is
+// not a neighbor, its gossiped heartbeats stop), and the holder loses the
+// lock if it can no longer reach a majority of the voters.
+//
+// If the votes are split between concurrent requests so that no server can
+// reach a majority, requesters that have not acquired the lock within the
+// retry timeout release their votes and retry after a random backoff.
+//
+// The locks are only accessed from the event loop and so are not thread-safe.
+// Lock requests are sent directly to neighbors and relayed over the routing
+// table to the other hosts, so the lock service works in any topology.
+type locks struct {
+	votes    map[string]*vote    // the vote of the local host on each lock
+	requests map[string]*request // the local requests to acquire each lock
+	attempt  uint64              // used to identify each attempt to acquire a lock
+}
+
+// vote is the state of the local host as a voter on a lock.
+type vote struct {
+	holder  string    // the host that the vote has been granted to
+	attempt uint64    // the attempt of the holder the vote was granted for
+	queue   []*ballot // hosts waiting for the vote in order
+}
+
+// ballot is a queued request for the vote of the local host.
+type ballot struct {
+	requester string
+	attempt   uint64
+}
+
+// request is the state of the local host as a requester of a lock.
+type request struct {
+	name     string          // the name of the lock
+	attempt  uint64          // the current attempt to acquire the lock
+	votes    map[string]bool // the hosts that have voted for the current attempt
+	acquired bool            // if a majority of the hosts has voted for the request
+	done     chan error      // notifies the application when the lock is acquired
+}
+
+// lockRequest is the value of lock and unlock events, sent from the
+// application to the event loop with a channel to return the result on.
+type lockRequest struct {
+	name string
+	done chan error
+}
+
+//===========================================================================
+// Server Lock API
+//===========================================================================
+
+// Lock acquires the named lock across the network, blocking until a majority
+// of the hosts have granted the lock to this server or the context is done.
+// The lock is held until Unlock is called or until this server can no longer
+// reach a majority of the hosts, in which case a LockLostEvent is dispatched.
+func (s *Server) Lock(ctx context.Context, name string) error {
+	req := &lockRequest{name: name, done: make(chan error, 1)}
+	if err := s.Dispatch(&event{etype: LockEvent, source: nil, value: req}); err != nil {
+		return err
+	}
+
+	_, done := s.channels()
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		// Cancel the request created by this call, which also releases the
+		// lock if it was acquired concurrently.
+		s.Dispatch(&event{etype: UnlockEvent, source: req, value: req})
+		return ctx.Err()
+	case <-done:
+		return errStopped
+	}
+}
+
+// Unlock releases the named lock, returning an error if it is not held.
+func (s *Server) Unlock(name string) error {
+	req := &lockRequest{name: name, done: make(chan error, 1)}
+	if err := s.Dispatch(&event{etype: UnlockEvent, source: nil, value: req}); err != nil {
+		return err
+	}
+	return s.wait(req.done)
+}
+
+//===========================================================================
+// Lock Event Handlers
+//===========================================================================
+
+// Begin a new request to acquire a lock, or a new attempt of a request that
+// is retrying after its backoff if it has not been cancelled in the meantime.
+func (s *Server) onLockEvent(e Event) error {
+	if retry, ok := e.Source().(*request); ok {
+		if s.locks.requests[retry.name] != retry {
+			return nil
+		}
+		return s.acquire(retry)
+	}
+
+	req := e.Value().(*lockRequest)
+	if _, ok := s.locks.requests[req.name]; ok {
+		req.done <- ErrLockHeld
+		return nil
+	}
+
+	if s.locks.requests == nil {
+		s.locks.requests = make(map[string]*request)
+	}
+
+	s.locks.requests[req.name] = &request{name: req.name, done: req.done}
+	return s.acquire(s.locks.requests[req.name])
+}
+
+// Release a lock that is held or cancel a request that is in progress. A
+// request is only cancelled by the Lock call that created it, the source of the
+// event, so that a call that gives up before it is refused with ErrLockHeld
+// does not cancel or release the request of another call for the same lock.
+func (s *Server) onUnlockEvent(e Event) error {
+	req := e.Value().(*lockRequest)
+	lock, ok := s.locks.requests[req.name]
+
+	if cancel, _ := e.Source().(*lockRequest); cancel != nil {
+		if !ok || lock.done != cancel.done {
+			return nil
+		}
+	} else if req.done != nil {
+		if ok && lock.acquired {
+			req.done <- nil
+		} else {
+			req.done <- ErrLockNotHeld
+		}
+	}
+
+	if !ok {
+		return nil
+	}
+
+	delete(s.locks.requests, req.name)
+	return s.release(lock)
+}
+
+// Retry a request that has not acquired a majority of the votes.
+func (s *Server) onLockRetryTimeout(e Event) error {
+	lock, ok := s.locks.requests[e.Source().(string)]
+	if !ok || lock.acquired || lock.attempt != e.Value().(uint64) {
+		return nil
+	}
+
+	debug("could not acquire lock %s, retrying", lock.name)
+	if err := s.release(lock); err != nil {
+		return err
+	}
+
+	// Backoff for a random interval so that competing requests do not retry
+	// at the same time and split the votes again.
+	tick, _ := s.config.GetTick()
+	backoff := time.Duration(rand.Int63n(int64(tick) * 2))
+	time.AfterFunc(backoff, func() {
+		s.Dispatch(&event{etype: LockEvent, source: lock, value: nil})
+	})
+
+	return nil
+}
+
+// Handle a lock message: as a voter for acquire and release requests and as a
+// requester for grants and queued replies.
+func (s *Server) onLock(in *pb.Envelope) (*pb.Envelope, error) {
+	msg := new(pb.Lock)
+	if err := proto.Unmarshal(in.Message, msg); err != nil {
+		return nil, err
+	}
+
+	var reply *pb.Lock
+	switch msg.Op {
+	case pb.LockOperation_ACQUIRE:
+		reply = s.castVote(msg.Name, in.Sender, msg.Attempt)
+	case pb.LockOperation_RELEASE:
+		if err := s.releaseVote(msg.Name, in.Sender, msg.Attempt); err != nil {
+			return nil, err
+		}
+	case pb.LockOperation_GRANT:
+		if err := s.receiveVote(msg.Name, in.Sender, msg.Attempt); err != nil {
+			return nil, err
+		}
+	case pb.LockOperation_QUEUED:
+		trace("lock %s request queued by %s", msg.Name, in.Sender)
+	}
+
+	if reply == nil {
+		return pb.Wrap(s.Name, pb.MessageType_HEARTBEAT, nil), nil
+	}
+
+	data, err := proto.Marshal(reply)
+	if err != nil {
+		return nil, err
+	}
+	return pb.Wrap(s.Name, pb.MessageType_LOCK, data), nil
+}
+
+// Release the votes held by a host that has gone offline and drop the votes
+// the host has cast for local requests, losing any lock that no longer has
+// a majority.
+func (s *Server) expireLocks(remote string) error {
+	for name, v := range s.locks.votes {
+		queue := v.queue[:0]
+		for _, b := range v.queue {
+			if b.requester != remote {
+				queue = append(queue, b)
+			}
+		}
+		v.queue = queue
+
+		if v.holder == remote {
+			info("releasing lock %s held by offline host %s", name, remote)
+			if err := s.releaseVote(name, remote, v.attempt); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name, lock := range s.locks.requests {
+		if !lock.votes[remote] {
+			continue
+		}
+
+		delete(lock.votes, remote)
+		if lock.acquired && len(lock.votes) < s.quorum() {
+			warn("lost lock %s: majority of hosts is unreachable", name)
+			delete(s.locks.requests, name)
+			if err := s.release(lock); err != nil {
+				return err
+			}
+
+			if err := s.listeners.call(&event{etype: LockLostEvent, source: s, value: name}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+//===========================================================================
+// Lock Helpers
+//===========================================================================
+
+// Request the votes of all hosts for a new attempt to acquire the lock.
+func (s *Server) acquire(lock *request) error {
+	s.locks.attempt++
+	lock.attempt = s.locks.attempt
+	lock.votes = make(map[string]bool)
+
+	// Vote for the local request, which is granted or queued
+	if reply := s.castVote(lock.name, s.Name, lock.attempt); reply.Op == pb.LockOperation_GRANT {
+		if err := s.receiveVote(lock.name, s.Name, lock.attempt); err != nil {
+			return err
+		}
+	}
+
+	if err := s.sendLock(lock.name, pb.LockOperation_ACQUIRE, lock.attempt, s.peerNames()...); err != nil {
+		return err
+	}
+
+	// Retry the request if it has not acquired a majority of votes in time
+	tick, _ := s.config.GetTick()
+	timeout := tick*4 + time.Duration(rand.Int63n(int64(tick)*4))
+	name, attempt := lock.name, lock.attempt
+	time.AfterFunc(timeout, func() {
+		s.Dispatch(&event{etype: LockRetryTimeout, source: name, value: attempt})
+	})
+
+	return nil
+}
+
+// Release the votes and queued requests of the lock on all hosts.
+func (s *Server) release(lock *request) error {
+	if err := s.releaseVote(lock.name, s.Name, lock.attempt); err != nil {
+		return err
+	}
+	return s.sendLock(lock.name, pb.LockOperation_RELEASE, lock.attempt, s.peerNames()...)
+}
+
+// Vote for the requester if the vote of the local host is not held, otherwise
+// queue the request. Returns the vote to send to the requester.
+func (s *Server) castVote(name, requester string, attempt uint64) *pb.Lock {
+	if s.locks.votes == nil {
+		s.locks.votes = make(map[string]*vote)
+	}
+
+	v, ok := s.locks.votes[name]
+	if !ok {
+		v = new(vote)
+		s.locks.votes[name] = v
+	}
+
+	if v.holder == "" || v.holder == requester {
+		v.holder, v.attempt = requester, attempt
+		return &pb.Lock{Name: name, Op: pb.LockOperation_GRANT, Attempt: attempt}
+	}
+
+	// Replace any earlier queued attempts of the requester
+	for _, b := range v.queue {
+		if b.requester == requester {
+			b.attempt = attempt
+			return &pb.Lock{Name: name, Op: pb.LockOperation_QUEUED, Attempt: attempt}
+		}
+	}
+
+	v.queue = append(v.queue, &ballot{requester: requester, attempt: attempt})
+	return &pb.Lock{Name: name, Op: pb.LockOperation_QUEUED, Attempt: attempt}
+}
+
+// Release the vote of the local host held by the attempt of the requester (or
+// remove the queued attempt of the requester) and grant the vote to the next
+// request in the queue. Releases for other attempts are stale and ignored.
+func (s *Server) releaseVote(name, requester string, attempt uint64) error {
+	v, ok := s.locks.votes[name]
+	if !ok {
+		return nil
+	}
+
+	if v.holder != requester || v.attempt != attempt {
+		queue := v.queue[:0]
+		for _, b := range v.queue {
+			if b.requester != requester || b.attempt != attempt {
+				queue = append(queue, b)
+			}
+		}
+		v.queue = queue
+		return nil
+	}
+
+	// Grant the vote to the next request in the queue, skipping the requests
+	// of hosts that are not on the network.
+	for len(v.queue) > 0 {
+		next := v.queue[0]
+		v.queue = v.queue[1:]
+		if next.requester != s.Name && !s.isPeer(next.requester) {
+			caution("cannot grant lock %s to unknown host %s", name, next.requester)
+			continue
+		}
+
+		v.holder, v.attempt = next.requester, next.attempt
+		trace("granting lock %s to %s", name, next.requester)
+
+		if next.requester == s.Name {
+			return s.receiveVote(name, s.Name, next.attempt)
+		}
+		return s.sendLock(name, pb.LockOperation_GRANT, next.attempt, next.requester)
+	}
+
+	delete(s.locks.votes, name)
+	return nil
+}
+
+// Record a vote for the local request and notify the application if the
+// request has acquired a majority. Votes for stale attempts are released.
+func (s *Server) receiveVote(name, voter string, attempt uint64) error {
+	lock, ok := s.locks.requests[name]
+	if !ok || lock.attempt != attempt {
+		if voter == s.Name {
+			return s.releaseVote(name, s.Name, attempt)
+		}
+		return s.sendLock(name, pb.LockOperation_RELEASE, attempt, voter)
+	}
+
+	lock.votes[voter] = true
+	if !lock.acquired && len(lock.votes) >= s.quorum() {
+		lock.acquired = true
+		info("acquired lock %s with %d votes", name, len(lock.votes))
+		lock.done <- nil
+	}
+	return nil
+}
+
+// Send a lock message to each of the named hosts.
+func (s *Server) sendLock(name string, op pb.LockOperation, attempt uint64, hosts ...string) error {
+	data, err := proto.Marshal(&pb.Lock{Name: name, Op: op, Attempt: attempt})
+	if err != nil {
+		return err
+	}
+
+	for _, host := range hosts {
+		if err := s.sendTo(host, pb.MessageType_LOCK, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The number of votes required to acquire a lock.
+func (s *Server) quorum() int {
+	return len(s.config.Peers)/2 + 1
+}
@@ -0,0 +1,101 @@
+package livenet
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReleaseVoteSkipsUnknownHosts(t *testing.T) {
+	server, err := New(testConfigs(3)[0])
+	if err != nil {
+		t.Fatalf("could not create server: %s", err)
+	}
+
+	server.locks.votes = map[string]*vote{
+		"resource": {holder: "b", attempt: 1, queue: []*ballot{{"z", 2}, {"y", 3}, {"c", 4}}},
+	}
+
+	if err = server.releaseVote("resource", "b", 1); err != nil {
+		t.Fatalf("could not release vote: %s", err)
+	}
+
+	if v := server.locks.votes["resource"]; v == nil || v.holder != "c" || v.attempt != 4 || len(v.queue) != 0 {
+		t.Errorf("expected the vote to be granted to c, got %+v", v)
+	}
+
+	// The vote is released if only unknown hosts are queued
+	server.locks.votes["resource"].queue = []*ballot{{"z", 5}}
+	if err = server.releaseVote("resource", "c", 4); err != nil {
+		t.Fatalf("could not release vote: %s", err)
+	}
+
+	if v, ok := server.locks.votes["resource"]; ok {
+		t.Errorf("expected the vote to be released, got %+v", v)
+	}
+}
+
+func TestWaitReturnsWhenServerStops(t *testing.T) {
+	server := testCluster(t, testConfigs(1))[0]
+
+	// The reply is never sent, as if the server stopped before handling the
+	// request of the application.
+	errc := make(chan error, 1)
+	go func() { errc <- server.wait(make(chan error)) }()
+
+	if err := server.Close(); err != nil {
+		t.Fatalf("could not close server: %s", err)
+	}
+
+	select {
+	case err := <-errc:
+		if err != errStopped {
+			t.Errorf("expected the server stopped error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting for the reply blocked after the server stopped")
+	}
+}
+
+func TestCancelledLockKeepsLockOfOtherCall(t *testing.T) {
+	server := testCluster(t, testConfigs(1))[0]
+	if err := server.Lock(context.Background(), "resource"); err != nil {
+		t.Fatalf("could not acquire lock: %s", err)
+	}
+
+	// Calls that give up before they are refused must not release the lock
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := server.Lock(ctx, "resource"); err != ErrLockHeld && err != context.Canceled {
+			t.Fatalf("unexpected error requesting a held lock: %v", err)
+		}
+	}
+
+	if err := server.Unlock("resource"); err != nil {
+		t.Errorf("lock was released by a cancelled call: %v", err)
+	}
+}
+
+func TestCancelledLockRequest(t *testing.T) {
+	// Without the other hosts a majority of the votes cannot be acquired
+	server := testCluster(t, testConfigs(3)[:1])[0]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := server.Lock(ctx, "resource"); err != context.DeadlineExceeded {
+		t.Fatalf("expected the lock request to time out, got %v", err)
+	}
+
+	// The request was cancelled, so it can be made again
+	if err := server.Unlock("resource"); err != ErrLockNotHeld {
+		t.Errorf("expected the lock not to be held, got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := server.Lock(ctx, "resource"); err != context.DeadlineExceeded {
+		t.Errorf("expected the new request to time out, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package livenet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// memoryTransport sends the same frames as the TCP transport over in-process
+// connections, so that a cluster of servers can run in a single process (e.g.
+// in tests) without binding ports. Servers that use the memory transport can
+// only reach servers in the same process, and are found by the address of
+// their peer; datagrams are still sent over UDP if enabled.
+type memoryTransport struct {
+	tcpTransport
+}
+
+// Listen registers the socket in the process at the address.
+func (t *memoryTransport) Listen(addr string) (net.Listener, error) {
+	sock, err := memory.listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return t.secure(sock)
+}
+
+// Dial the socket registered at the address and open a stream to it.
+func (t *memoryTransport) Dial(addr, remote string, md metadata.MD) (ClientStream, error) {
+	conn, err := memory.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	return t.open(conn, remote, md)
+}
+
+// memory is the in-process network of the memory transport.
+var memory = &memoryNetwork{sockets: make(map[string]*memorySocket)}
+
+// memoryNetwork holds the sockets that are listening by address.
+type memoryNetwork struct {
+	sync.Mutex
+	sockets map[string]*memorySocket
+}
+
+// Register a socket at the address; only one socket can listen on an address.
+func (n *memoryNetwork) listen(addr string) (*memorySocket, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	if _, ok := n.sockets[addr]; ok {
+		return nil, fmt.Errorf("address %s already in use", addr)
+	}
+
+	sock := &memorySocket{network: n, addr: memoryAddr(addr), conns: make(chan net.Conn), done: make(chan struct{})}
+	n.sockets[addr] = sock
+	return sock, nil
+}
+
+// Connect to the socket at the address with a synchronous in-memory pipe.
+func (n *memoryNetwork) dial(addr string) (net.Conn, error) {
+	n.Lock()
+	sock, ok := n.sockets[addr]
+	n.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("connection to %s refused", addr)
+	}
+
+	client, server := net.Pipe()
+	select {
+	case sock.conns <- server:
+		return client, nil
+	case <-sock.done:
+		return nil, fmt.Errorf("connection to %s refused", addr)
+	}
+}
+
+// memorySocket implements net.Listener for the memory network.
+type memorySocket struct {
+	network *memoryNetwork
+	addr    memoryAddr
+	conns   chan net.Conn
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Accept waits for the next connection to the socket.
+func (s *memorySocket) Accept() (net.Conn, error) {
+	select {
+	case conn := <-s.conns:
+		return conn, nil
+	case <-s.done:
+		return nil, errors.New("use of closed memory socket")
+	}
+}
+
+// Close the socket and remove it from the network so the address can be reused.
+func (s *memorySocket) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+
+		s.network.Lock()
+		delete(s.network.sockets, string(s.addr))
+		s.network.Unlock()
+	})
+	return nil
+}
+
+// Addr returns the address the socket is registered at.
+func (s *memorySocket) Addr() net.Addr {
+	return s.addr
+}
+
+// memoryAddr is the address of a socket in the memory network.
+type memoryAddr string
+
+// Network returns the name of the memory network.
+func (a memoryAddr) Network() string { return TransportMemory }
+
+// String returns the address.
+func (a memoryAddr) String() string { return string(a) }
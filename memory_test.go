@@ -0,0 +1,143 @@
+package livenet
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/x/peers"
+)
+
+// Records the peer events dispatched by a server by the name of the peer.
+type peerEvents struct {
+	sync.Mutex
+	online  map[string]int
+	offline map[string]int
+}
+
+func newPeerEvents(server *Server) *peerEvents {
+	events := &peerEvents{online: make(map[string]int), offline: make(map[string]int)}
+	server.On(PeerOnlineEvent, func(e Event) error {
+		events.Lock()
+		defer events.Unlock()
+		events.online[e.Value().(peers.Peer).Name]++
+		return nil
+	})
+
+	server.On(PeerOfflineEvent, func(e Event) error {
+		events.Lock()
+		defer events.Unlock()
+		events.offline[e.Value().(peers.Peer).Name]++
+		return nil
+	})
+	return events
+}
+
+// Returns the number of online and offline events for the peer.
+func (e *peerEvents) count(name string) (online, offline int) {
+	e.Lock()
+	defer e.Unlock()
+	return e.online[name], e.offline[name]
+}
+
+func TestMemoryClusterRelisten(t *testing.T) {
+	configs := testConfigs(5)
+	servers := make([]*Server, 0, len(configs))
+	for _, config := range configs {
+		server, err := New(config)
+		if err != nil {
+			t.Fatalf("could not create server %s: %s", config.Name, err)
+		}
+		servers = append(servers, server)
+	}
+
+	// Nodes c and e are stopped and restarted, the others survive
+	stopped := map[string]<-chan error{}
+	survivors := make([]*Server, 0, 3)
+	events := make(map[string]*peerEvents, 3)
+	for _, server := range servers {
+		if server.Name == "c" || server.Name == "e" {
+			stopped[server.Name] = testListen(t, server)
+			continue
+		}
+
+		events[server.Name] = newPeerEvents(server)
+		survivors = append(survivors, server)
+		testListen(t, server)
+	}
+	testConnected(t, servers)
+
+	// Wait for the survivors to see every stopped node come online
+	for _, server := range survivors {
+		for name := range stopped {
+			eventually(t, time.Second, func() bool { online, _ := events[server.Name].count(name); return online == 1 }, "%s did not see %s come online", server.Name, name)
+		}
+	}
+
+	// Close the stopped nodes and wait for them to stop listening
+	for _, server := range servers {
+		errc, ok := stopped[server.Name]
+		if !ok {
+			continue
+		}
+
+		if err := server.Close(); err != nil {
+			t.Fatalf("could not close %s: %s", server.Name, err)
+		}
+
+		select {
+		case err := <-errc:
+			if err != nil {
+				t.Fatalf("%s stopped listening with an error: %s", server.Name, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s did not stop listening", server.Name)
+		}
+	}
+
+	// Every survivor goes offline from the stopped nodes and stays online with
+	// the other survivors.
+	for _, server := range survivors {
+		for name := range stopped {
+			remote := server.remote(name)
+			eventually(t, 2*time.Second, func() bool { return !remote.Online() }, "%s did not go offline from %s", server.Name, name)
+			eventually(t, 2*time.Second, func() bool { _, offline := events[server.Name].count(name); return offline == 1 }, "%s did not see %s go offline", server.Name, name)
+
+			if server.Alive(name) {
+				t.Errorf("%s is alive on %s after it was closed", name, server.Name)
+			}
+		}
+
+		for _, other := range survivors {
+			if remote := server.remote(other.Name); remote != nil && !remote.Online() {
+				t.Errorf("%s went offline from %s", server.Name, other.Name)
+			}
+		}
+	}
+
+	// Listen on the stopped nodes again on the same address, which reconnects
+	// them to their peers.
+	for _, server := range servers {
+		if _, ok := stopped[server.Name]; ok {
+			testListen(t, server)
+		}
+	}
+
+	for _, server := range survivors {
+		for name := range stopped {
+			remote := server.remote(name)
+			eventually(t, 2*time.Second, remote.Online, "%s did not reconnect to %s", server.Name, name)
+			eventually(t, 2*time.Second, func() bool { online, _ := events[server.Name].count(name); return online == 2 }, "%s did not see %s come back online", server.Name, name)
+		}
+	}
+	testConnected(t, servers)
+
+	// The survivors never went offline from each other
+	for _, server := range survivors {
+		for _, other := range survivors {
+			if _, offline := events[server.Name].count(other.Name); offline != 0 {
+				t.Errorf("%s saw %s go offline %d times", server.Name, other.Name, offline)
+			}
+		}
+	}
+}
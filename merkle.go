@@ -0,0 +1,113 @@
+package livenet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"sort"
+)
+
+// The Merkle tree has a fixed shape: the root, merkleFanout interior nodes,
+// and merkleFanout^2 leaves. Keys are assigned to leaves (buckets) by the
+// first byte of the hash of the key so that every host buckets keys the same.
+const (
+	merkleFanout = 16
+	merkleLeaves = merkleFanout * merkleFanout
+	merkleDepth  = 2
+)
+
+// merkle is a hash tree over the keys and values of a Store. The tree is
+// built from a snapshot of the store so that it can be compared with the
+// tree of a remote host to find the buckets whose keys differ.
+type merkle struct {
+	levels  [merkleDepth + 1][][]byte       // node hashes by level and index
+	digests [merkleLeaves]map[string][]byte // value hashes of keys by bucket
+}
+
+// Build a Merkle tree from the current keys and values of the store.
+func newMerkle(store Store) *merkle {
+	tree := new(merkle)
+	for i := range tree.digests {
+		tree.digests[i] = make(map[string][]byte)
+	}
+
+	for _, key := range store.Keys() {
+		if value, ok := store.Get(key); ok {
+			tree.digests[bucket(key)][key] = hash(value)
+		}
+	}
+
+	// Compute the leaf hashes from the sorted key digests of each bucket
+	tree.levels[merkleDepth] = make([][]byte, merkleLeaves)
+	for i, digests := range tree.digests {
+		if len(digests) == 0 {
+			continue
+		}
+
+		keys := make([]string, 0, len(digests))
+		for key := range digests {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		h := sha256.New()
+		for _, key := range keys {
+			h.Write(hash([]byte(key)))
+			h.Write(digests[key])
+		}
+		tree.levels[merkleDepth][i] = h.Sum(nil)
+	}
+
+	// Compute the interior hashes from the hashes of their children
+	for level := merkleDepth - 1; level >= 0; level-- {
+		children := tree.levels[level+1]
+		tree.levels[level] = make([][]byte, len(children)/merkleFanout)
+		for i := range tree.levels[level] {
+			h := sha256.New()
+			for _, child := range children[i*merkleFanout : (i+1)*merkleFanout] {
+				h.Write(child)
+			}
+			tree.levels[level][i] = h.Sum(nil)
+		}
+	}
+
+	return tree
+}
+
+// Valid returns true if the level and index identify a node of the tree.
+func (t *merkle) Valid(level, index uint32) bool {
+	return level <= merkleDepth && int(index) < len(t.levels[level])
+}
+
+// Hash returns the hash of the node at the level and index, or nil if the
+// node does not exist in the tree.
+func (t *merkle) Hash(level, index uint32) []byte {
+	if !t.Valid(level, index) {
+		return nil
+	}
+	return t.levels[level][index]
+}
+
+// Differs returns true if the hash of the node does not match the hash.
+func (t *merkle) Differs(level, index uint32, hash []byte) bool {
+	return !bytes.Equal(t.Hash(level, index), hash)
+}
+
+// Children returns the indices of the children of the node at the level.
+func (t *merkle) Children(index uint32) []uint32 {
+	children := make([]uint32, merkleFanout)
+	for i := range children {
+		children[i] = index*merkleFanout + uint32(i)
+	}
+	return children
+}
+
+// Bucket returns the leaf index that the key is stored in.
+func bucket(key string) uint32 {
+	return uint32(hash([]byte(key))[0])
+}
+
+// Returns the SHA-256 hash of the data.
+func hash(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
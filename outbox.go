@@ -0,0 +1,389 @@
+package livenet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+// Outbox defaults for the size and age limits of undelivered messages.
+const (
+	DefaultOutboxSize = 16 * 1024 * 1024
+	DefaultOutboxAge  = time.Hour
+)
+
+// OutboxMetrics describes the undelivered messages held for a remote.
+type OutboxMetrics struct {
+	Depth  int           // number of messages held in the outbox
+	Bytes  int           // size of the messages held in the outbox
+	Oldest time.Duration // age of the oldest message held in the outbox
+}
+
+func (m OutboxMetrics) String() string {
+	return fmt.Sprintf("outbox %d messages (%d bytes, oldest %s)", m.Depth, m.Bytes, m.Oldest)
+}
+
+// GetOutbox returns the directory that undelivered messages are stored in,
+// with {name} replaced by the name of the local host, or an empty string if
+// the outbox is disabled.
+func (c *Config) GetOutbox() (string, error) {
+	if c.Outbox == "" {
+		return "", nil
+	}
+
+	name, err := c.GetName()
+	if err != nil {
+		return "", err
+	}
+	return strings.Replace(c.Outbox, NamePlaceholder, name, -1), nil
+}
+
+// GetOutboxSize returns the maximum size in bytes of the messages held for
+// each remote or DefaultOutboxSize if not specified.
+func (c *Config) GetOutboxSize() int {
+	if c.OutboxSize > 0 {
+		return c.OutboxSize
+	}
+	return DefaultOutboxSize
+}
+
+// GetOutboxAge returns the maximum age of the messages held for each remote
+// or DefaultOutboxAge if not specified.
+func (c *Config) GetOutboxAge() (age time.Duration, err error) {
+	if c.OutboxAge == "" {
+		return DefaultOutboxAge, nil
+	}
+	if age, err = time.ParseDuration(c.OutboxAge); err != nil {
+		return age, fmt.Errorf("could not parse outbox age: %s", err)
+	}
+	return age, nil
+}
+
+// Returns true if the message is sent by the application rather than by the
+// protocols of the network, which can regenerate their messages.
+func heldWhileOffline(msg *pb.Envelope) bool {
+	return msg.Type == pb.MessageType_PUBLISH || msg.Type == pb.MessageType_DIRECT
+}
+
+// outbox holds the application messages that could not be delivered to a
+// remote in an append-only file so that they can be replayed in order when
+// the remote comes back online, even if the local host restarts. Each record
+// is the time the message was held, the length of the message, and the
+// serialized envelope. The file is rewritten when messages are removed.
+type outbox struct {
+	sync.Mutex
+	path    string
+	file    *os.File
+	entries []outboxEntry
+	size    int
+	limit   int
+	maxAge  time.Duration
+}
+
+type outboxEntry struct {
+	held time.Time
+	data []byte
+}
+
+// Open the outbox of the remote, loading the messages held before a restart,
+// or return nil if the outbox is disabled.
+func openOutbox(c *Config, remote string) (*outbox, error) {
+	dir, err := c.GetOutbox()
+	if err != nil || dir == "" {
+		return nil, err
+	}
+
+	age, err := c.GetOutboxAge()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	o := &outbox{path: filepath.Join(dir, remote+".outbox"), limit: c.GetOutboxSize(), maxAge: age}
+	if err = o.load(); err != nil {
+		return nil, fmt.Errorf("could not load outbox for %s: %s", remote, err)
+	}
+
+	// Rewrite the file without the messages that expired while stopped
+	if err = o.rewrite(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Hold the message until it can be delivered, discarding the oldest messages
+// if the outbox exceeds its size limit.
+func (o *outbox) append(msg *pb.Envelope) error {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if len(data) > o.limit {
+		return fmt.Errorf("message of %d bytes exceeds outbox limit", len(data))
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	entry := outboxEntry{held: time.Now(), data: data}
+	o.entries = append(o.entries, entry)
+	o.size += len(data)
+
+	if o.expire() {
+		return o.rewrite()
+	}
+
+	return writeOutboxEntry(o.file, entry)
+}
+
+// Returns the messages held in the outbox in order, discarding those that
+// are older than the age limit.
+func (o *outbox) pending() ([]*pb.Envelope, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	if o.expire() {
+		if err := o.rewrite(); err != nil {
+			return nil, err
+		}
+	}
+
+	msgs := make([]*pb.Envelope, 0, len(o.entries))
+	for _, entry := range o.entries {
+		msg := new(pb.Envelope)
+		if err := proto.Unmarshal(entry.data, msg); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// Remove the first n messages of the outbox once they are delivered.
+func (o *outbox) remove(n int) error {
+	if n == 0 {
+		return nil
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	for _, entry := range o.entries[:n] {
+		o.size -= len(entry.data)
+	}
+	o.entries = o.entries[n:]
+	return o.rewrite()
+}
+
+// Returns true if the outbox has no messages.
+func (o *outbox) empty() bool {
+	o.Lock()
+	defer o.Unlock()
+	return len(o.entries) == 0
+}
+
+// Returns the current metrics of the outbox.
+func (o *outbox) metrics() OutboxMetrics {
+	o.Lock()
+	defer o.Unlock()
+
+	m := OutboxMetrics{Depth: len(o.entries), Bytes: o.size}
+	if len(o.entries) > 0 {
+		m.Oldest = time.Since(o.entries[0].held)
+	}
+	return m
+}
+
+// Discard the oldest messages over the size limit or age limit, returning
+// true if any messages were discarded (not thread-safe).
+func (o *outbox) expire() bool {
+	expired := time.Now().Add(-o.maxAge)
+
+	var n int
+	for n < len(o.entries) && (o.size > o.limit || o.entries[n].held.Before(expired)) {
+		o.size -= len(o.entries[n].data)
+		n++
+	}
+
+	if n > 0 {
+		caution("discarded %d undelivered messages from %s", n, o.path)
+		o.entries = o.entries[n:]
+		return true
+	}
+	return false
+}
+
+// Load the messages held in the outbox file (not thread-safe).
+func (o *outbox) load() error {
+	f, err := os.Open(o.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		var header [12]byte
+		if _, err = io.ReadFull(reader, header[:]); err != nil {
+			// A partially written record at the end of the file is discarded
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+
+		entry := outboxEntry{
+			held: time.Unix(0, int64(binary.BigEndian.Uint64(header[:8]))),
+			data: make([]byte, binary.BigEndian.Uint32(header[8:])),
+		}
+
+		if _, err = io.ReadFull(reader, entry.data); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+
+		o.entries = append(o.entries, entry)
+		o.size += len(entry.data)
+	}
+}
+
+// Replace the outbox file with the messages currently held (not thread-safe).
+func (o *outbox) rewrite() error {
+	tmp := o.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range o.entries {
+		if err = writeOutboxEntry(f, entry); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, o.path); err != nil {
+		return err
+	}
+
+	// Reopen the file to append new messages to it
+	if o.file != nil {
+		o.file.Close()
+	}
+	o.file, err = os.OpenFile(o.path, os.O_APPEND|os.O_WRONLY, 0644)
+	return err
+}
+
+// Append a record of the held message to the file.
+func writeOutboxEntry(w io.Writer, entry outboxEntry) error {
+	record := make([]byte, 12+len(entry.data))
+	binary.BigEndian.PutUint64(record[:8], uint64(entry.held.UnixNano()))
+	binary.BigEndian.PutUint32(record[8:12], uint32(len(entry.data)))
+	copy(record[12:], entry.data)
+
+	_, err := w.Write(record)
+	return err
+}
+
+//===========================================================================
+// Remote Outbox
+//===========================================================================
+
+// Hold an undelivered application message in the outbox of the remote, or
+// count it as dropped if the outbox is disabled or cannot hold it. The
+// envelopes of an undelivered batch are held or dropped in order.
+func (r *Remote) hold(msg *pb.Envelope) {
+	if msg.Type == pb.MessageType_BATCH {
+		envelopes, err := unbatch(msg, r.config.GetMaxPayload())
+		if err == nil {
+			for _, env := range envelopes {
+				r.hold(env)
+			}
+			return
+		}
+		caution("could not unpack batch to %s: %s", r.Name, err)
+	}
+
+	if r.outbox != nil && heldWhileOffline(msg) {
+		err := r.outbox.append(msg)
+		if err == nil {
+			return
+		}
+		caution("could not hold message to %s: %s", r.Name, err)
+	}
+	r.counts.Drop()
+}
+
+// Replay the messages held in the outbox in order on the connected stream,
+// returning false if the stream failed before all of them were delivered.
+func (r *Remote) replay() bool {
+	if r.outbox == nil || r.outbox.empty() {
+		return true
+	}
+
+	msgs, err := r.outbox.pending()
+	if err != nil {
+		caution("could not read outbox for %s: %s", r.Name, err)
+		return true
+	}
+
+	var delivered int
+	defer func() {
+		if err := r.outbox.remove(delivered); err != nil {
+			caution("could not update outbox for %s: %s", r.Name, err)
+		}
+	}()
+
+	for _, msg := range msgs {
+		if !r.transmit(msg) {
+			return false
+		}
+		delivered++
+	}
+
+	info("replayed %d held messages to %s", delivered, r.Name)
+	return true
+}
+
+// Outbox returns the metrics of the outbox of the remote and false if the
+// outbox is disabled.
+func (r *Remote) Outbox() (OutboxMetrics, bool) {
+	if r.outbox == nil {
+		return OutboxMetrics{}, false
+	}
+	return r.outbox.metrics(), true
+}
+
+// Outboxes returns the metrics of the outbox of every remote by name, empty if
+// the outbox is disabled.
+func (s *Server) Outboxes() map[string]OutboxMetrics {
+	outboxes := make(map[string]OutboxMetrics, len(s.remotes))
+	for _, remote := range s.remotes {
+		if m, ok := remote.Outbox(); ok {
+			outboxes[remote.Name] = m
+		}
+	}
+	return outboxes
+}
@@ -0,0 +1,179 @@
+package livenet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+// Returns a configuration with an outbox in a temporary directory that is
+// removed when the test is done.
+func testOutboxConfig(t *testing.T) *Config {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "livenet-outbox")
+	if err != nil {
+		t.Fatalf("could not create outbox directory: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	config := testConfigs(2)[0]
+	config.Outbox = dir
+	return config
+}
+
+// Returns the payloads of the messages held in the outbox in order.
+func testPending(t *testing.T, o *outbox) []string {
+	t.Helper()
+	msgs, err := o.pending()
+	if err != nil {
+		t.Fatalf("could not read outbox: %s", err)
+	}
+
+	payloads := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		payloads = append(payloads, string(msg.Message))
+	}
+	return payloads
+}
+
+func TestOutboxSurvivesRestart(t *testing.T) {
+	config := testOutboxConfig(t)
+	o, err := openOutbox(config, "b")
+	if err != nil {
+		t.Fatalf("could not open outbox: %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err = o.append(pb.Wrap("a", pb.MessageType_DIRECT, []byte(fmt.Sprint(i)))); err != nil {
+			t.Fatalf("could not hold message: %s", err)
+		}
+	}
+
+	if err = o.remove(1); err != nil {
+		t.Fatalf("could not remove delivered message: %s", err)
+	}
+	o.file.Close()
+
+	// The messages held before closing are loaded in order when reopened
+	if o, err = openOutbox(config, "b"); err != nil {
+		t.Fatalf("could not reopen outbox: %s", err)
+	}
+	defer o.file.Close()
+
+	if payloads := fmt.Sprint(testPending(t, o)); payloads != "[1 2]" {
+		t.Errorf("expected the undelivered messages after reopening, got %s", payloads)
+	}
+}
+
+func TestOutboxLimits(t *testing.T) {
+	config := testOutboxConfig(t)
+	data, err := proto.Marshal(pb.Wrap("a", pb.MessageType_DIRECT, []byte("0")))
+	if err != nil {
+		t.Fatalf("could not marshal message: %s", err)
+	}
+	size := len(data)
+
+	// The oldest messages are discarded when the size limit is exceeded
+	config.OutboxSize = 2*size + size/2
+	o, err := openOutbox(config, "b")
+	if err != nil {
+		t.Fatalf("could not open outbox: %s", err)
+	}
+	defer o.file.Close()
+
+	for i := 0; i < 3; i++ {
+		if err = o.append(pb.Wrap("a", pb.MessageType_DIRECT, []byte(fmt.Sprint(i)))); err != nil {
+			t.Fatalf("could not hold message: %s", err)
+		}
+	}
+
+	if payloads := fmt.Sprint(testPending(t, o)); payloads != "[1 2]" {
+		t.Errorf("expected the oldest message to be discarded, got %s", payloads)
+	}
+
+	if m := o.metrics(); m.Depth != 2 || m.Bytes > config.OutboxSize || m.Oldest <= 0 {
+		t.Errorf("unexpected outbox metrics: %s", m)
+	}
+
+	if err = o.append(pb.Wrap("a", pb.MessageType_DIRECT, make([]byte, 2*size))); err == nil {
+		t.Error("expected a message larger than the outbox to be rejected")
+	}
+
+	// Messages are discarded when they are older than the age limit
+	o.maxAge = 50 * time.Millisecond
+	time.Sleep(o.maxAge)
+	if payloads := testPending(t, o); len(payloads) != 0 {
+		t.Errorf("expected expired messages to be discarded, got %v", payloads)
+	}
+
+	if m := o.metrics(); m.Depth != 0 || m.Bytes != 0 || m.Oldest != 0 {
+		t.Errorf("unexpected metrics of an empty outbox: %s", m)
+	}
+}
+
+func TestOutboxHoldsBatchedMessages(t *testing.T) {
+	config := testOutboxConfig(t)
+	remote := NewRemote(config.Peers[1].Peer, nil, config)
+
+	var err error
+	if remote.outbox, err = openOutbox(config, remote.Name); err != nil {
+		t.Fatalf("could not open outbox: %s", err)
+	}
+	defer remote.outbox.file.Close()
+
+	msg, err := batch("a", []*pb.Envelope{
+		pb.Wrap("a", pb.MessageType_DIRECT, []byte("first")),
+		pb.Wrap("a", pb.MessageType_HEARTBEAT, nil),
+		pb.Wrap("a", pb.MessageType_PUBLISH, []byte("second")),
+	})
+	if err != nil {
+		t.Fatalf("could not create batch: %s", err)
+	}
+
+	// The application messages of the batch are held in order and the
+	// protocol messages are dropped.
+	remote.hold(msg)
+	if payloads := fmt.Sprint(testPending(t, remote.outbox)); payloads != "[first second]" {
+		t.Errorf("expected the application messages of the batch to be held, got %s", payloads)
+	}
+
+	if dropped := atomic.LoadUint64(&remote.counts.drop); dropped != 1 {
+		t.Errorf("expected the heartbeat of the batch to be dropped, got %d drops", dropped)
+	}
+}
+
+func TestOutboxReplaysInOrder(t *testing.T) {
+	configs := testConfigs(2)
+	configs[0].Outbox = testOutboxConfig(t).Outbox
+	servers := testCluster(t, configs)
+	testConnected(t, servers)
+	a, log := servers[0], newDirectLog(servers[1])
+
+	// Messages sent while b is unreachable are held in the outbox
+	a.Partition("b")
+	eventually(t, 2*time.Second, func() bool { return !a.remote("b").Online() }, "b did not go offline")
+
+	expected := make([]string, 0, 5)
+	for i := 0; i < 5; i++ {
+		expected = append(expected, fmt.Sprint(i))
+		testSend(t, a, expected[i])
+	}
+	eventually(t, 2*time.Second, func() bool { return a.Outboxes()["b"].Depth == 5 }, "messages were not held in the outbox")
+
+	// The held messages are replayed in order when b comes back online
+	a.Heal("b")
+	eventually(t, 3*time.Second, func() bool { return len(log.unexpected()) == 5 }, "held messages were not replayed")
+	if payloads := fmt.Sprint(log.unexpected()); payloads != fmt.Sprint(expected) {
+		t.Errorf("expected the held messages to be replayed in order, got %s", payloads)
+	}
+
+	if m := a.Outboxes()["b"]; m.Depth != 0 || m.Bytes != 0 {
+		t.Errorf("expected the outbox to be empty after replaying, got %s", m)
+	}
+}
@@ -0,0 +1,107 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: barrier.proto
+
+/*
+Package pb is a generated protocol buffer package.
+
+It is generated from these files:
+	barrier.proto
+	crdt.proto
+	heartbeat.proto
+	lock.proto
+	message.proto
+	pubsub.proto
+	service.proto
+	sync.proto
+	transfer.proto
+	transport.proto
+
+It has these top-level messages:
+	Barrier
+	GCounter
+	PNCounter
+	Tags
+	ORSet
+	LWWRegister
+	Delta
+	Route
+	Heartbeat
+	Datagram
+	Lock
+	Envelope
+	Batch
+	Subscriptions
+	Publication
+	MerkleNode
+	Digest
+	Entry
+	Sync
+	Chunk
+	Handshake
+	Metadata
+*/
+package pb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type Barrier struct {
+	Name       string   `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Generation uint64   `protobuf:"varint,2,opt,name=generation" json:"generation,omitempty"`
+	Arrived    []string `protobuf:"bytes,3,rep,name=arrived" json:"arrived,omitempty"`
+}
+
+func (m *Barrier) Reset()                    { *m = Barrier{} }
+func (m *Barrier) String() string            { return proto.CompactTextString(m) }
+func (*Barrier) ProtoMessage()               {}
+func (*Barrier) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *Barrier) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Barrier) GetGeneration() uint64 {
+	if m != nil {
+		return m.Generation
+	}
+	return 0
+}
+
+func (m *Barrier) GetArrived() []string {
+	if m != nil {
+		return m.Arrived
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Barrier)(nil), "pb.Barrier")
+}
+
+func init() { proto.RegisterFile("barrier.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 109 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x4d, 0x4a, 0x2c, 0x2a,
+	0xca, 0x4c, 0x2d, 0xd2, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x2a, 0x48, 0x52, 0x0a, 0xe7,
+	0x62, 0x77, 0x82, 0x08, 0x0a, 0x09, 0x71, 0xb1, 0xe4, 0x25, 0xe6, 0xa6, 0x4a, 0x30, 0x2a, 0x30,
+	0x6a, 0x70, 0x06, 0x81, 0xd9, 0x42, 0x72, 0x5c, 0x5c, 0xe9, 0xa9, 0x79, 0xa9, 0x45, 0x89, 0x25,
+	0x99, 0xf9, 0x79, 0x12, 0x4c, 0x0a, 0x8c, 0x1a, 0x2c, 0x41, 0x48, 0x22, 0x42, 0x12, 0x5c, 0xec,
+	0x20, 0xdd, 0x65, 0xa9, 0x29, 0x12, 0xcc, 0x0a, 0xcc, 0x1a, 0x9c, 0x41, 0x30, 0x6e, 0x12, 0x1b,
+	0xd8, 0x0e, 0x63, 0xc0, 0x00, 0x22, 0x91, 0x86, 0xa6, 0x74, 0x00, 0x00, 0x00,
+}
@@ -0,0 +1,185 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: crdt.proto
+
+package pb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type GCounter struct {
+	Counts map[string]uint64 `protobuf:"bytes,1,rep,name=counts" json:"counts,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+}
+
+func (m *GCounter) Reset()                    { *m = GCounter{} }
+func (m *GCounter) String() string            { return proto.CompactTextString(m) }
+func (*GCounter) ProtoMessage()               {}
+func (*GCounter) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{0} }
+
+func (m *GCounter) GetCounts() map[string]uint64 {
+	if m != nil {
+		return m.Counts
+	}
+	return nil
+}
+
+type PNCounter struct {
+	Increments *GCounter `protobuf:"bytes,1,opt,name=increments" json:"increments,omitempty"`
+	Decrements *GCounter `protobuf:"bytes,2,opt,name=decrements" json:"decrements,omitempty"`
+}
+
+func (m *PNCounter) Reset()                    { *m = PNCounter{} }
+func (m *PNCounter) String() string            { return proto.CompactTextString(m) }
+func (*PNCounter) ProtoMessage()               {}
+func (*PNCounter) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{1} }
+
+func (m *PNCounter) GetIncrements() *GCounter {
+	if m != nil {
+		return m.Increments
+	}
+	return nil
+}
+
+func (m *PNCounter) GetDecrements() *GCounter {
+	if m != nil {
+		return m.Decrements
+	}
+	return nil
+}
+
+type Tags struct {
+	Tags []string `protobuf:"bytes,1,rep,name=tags" json:"tags,omitempty"`
+}
+
+func (m *Tags) Reset()                    { *m = Tags{} }
+func (m *Tags) String() string            { return proto.CompactTextString(m) }
+func (*Tags) ProtoMessage()               {}
+func (*Tags) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{2} }
+
+func (m *Tags) GetTags() []string {
+	if m != nil {
+		return m.Tags
+	}
+	return nil
+}
+
+type ORSet struct {
+	Elements   map[string]*Tags `protobuf:"bytes,1,rep,name=elements" json:"elements,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Tombstones []string         `protobuf:"bytes,2,rep,name=tombstones" json:"tombstones,omitempty"`
+}
+
+func (m *ORSet) Reset()                    { *m = ORSet{} }
+func (m *ORSet) String() string            { return proto.CompactTextString(m) }
+func (*ORSet) ProtoMessage()               {}
+func (*ORSet) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{3} }
+
+func (m *ORSet) GetElements() map[string]*Tags {
+	if m != nil {
+		return m.Elements
+	}
+	return nil
+}
+
+func (m *ORSet) GetTombstones() []string {
+	if m != nil {
+		return m.Tombstones
+	}
+	return nil
+}
+
+type LWWRegister struct {
+	Value     []byte `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	Timestamp int64  `protobuf:"varint,2,opt,name=timestamp" json:"timestamp,omitempty"`
+	Replica   string `protobuf:"bytes,3,opt,name=replica" json:"replica,omitempty"`
+}
+
+func (m *LWWRegister) Reset()                    { *m = LWWRegister{} }
+func (m *LWWRegister) String() string            { return proto.CompactTextString(m) }
+func (*LWWRegister) ProtoMessage()               {}
+func (*LWWRegister) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{4} }
+
+func (m *LWWRegister) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *LWWRegister) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func (m *LWWRegister) GetReplica() string {
+	if m != nil {
+		return m.Replica
+	}
+	return ""
+}
+
+type Delta struct {
+	Name  string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	State []byte `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
+}
+
+func (m *Delta) Reset()                    { *m = Delta{} }
+func (m *Delta) String() string            { return proto.CompactTextString(m) }
+func (*Delta) ProtoMessage()               {}
+func (*Delta) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{5} }
+
+func (m *Delta) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Delta) GetState() []byte {
+	if m != nil {
+		return m.State
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*GCounter)(nil), "pb.GCounter")
+	proto.RegisterType((*PNCounter)(nil), "pb.PNCounter")
+	proto.RegisterType((*Tags)(nil), "pb.Tags")
+	proto.RegisterType((*ORSet)(nil), "pb.ORSet")
+	proto.RegisterType((*LWWRegister)(nil), "pb.LWWRegister")
+	proto.RegisterType((*Delta)(nil), "pb.Delta")
+}
+
+func init() { proto.RegisterFile("crdt.proto", fileDescriptor1) }
+
+var fileDescriptor1 = []byte{
+	// 334 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x52, 0x4d, 0x4b, 0xc3, 0x40,
+	0x10, 0x65, 0x93, 0xb6, 0x36, 0x93, 0x0a, 0xb2, 0x08, 0x86, 0x22, 0xa5, 0xe4, 0x94, 0x83, 0x04,
+	0x6d, 0x2f, 0xea, 0x55, 0x8b, 0x17, 0x51, 0x59, 0x85, 0x1e, 0x3c, 0x6d, 0xd2, 0x21, 0x04, 0xf3,
+	0x45, 0x76, 0xab, 0xf4, 0xf7, 0xf8, 0x47, 0x65, 0x36, 0x69, 0x1a, 0xa1, 0xa7, 0xcc, 0xcc, 0x7b,
+	0x99, 0xf7, 0xe6, 0xb1, 0x00, 0x71, 0xbd, 0xd1, 0x61, 0x55, 0x97, 0xba, 0xe4, 0x56, 0x15, 0xf9,
+	0x3f, 0x30, 0x7e, 0x7a, 0x28, 0xb7, 0x85, 0xc6, 0x9a, 0x5f, 0xc3, 0x28, 0xa6, 0x52, 0x79, 0x6c,
+	0x6e, 0x07, 0xee, 0xc2, 0x0b, 0xab, 0x28, 0xdc, 0xa3, 0xa1, 0xf9, 0xaa, 0x55, 0xa1, 0xeb, 0x9d,
+	0x68, 0x79, 0xd3, 0x3b, 0x70, 0x7b, 0x63, 0x7e, 0x06, 0xf6, 0x17, 0xee, 0x3c, 0x36, 0x67, 0x81,
+	0x23, 0xa8, 0xe4, 0xe7, 0x30, 0xfc, 0x96, 0xd9, 0x16, 0x3d, 0x6b, 0xce, 0x82, 0x81, 0x68, 0x9a,
+	0x7b, 0xeb, 0x96, 0xf9, 0x09, 0x38, 0x6f, 0x2f, 0x7b, 0xe5, 0x2b, 0x80, 0xb4, 0x88, 0x6b, 0xcc,
+	0xb1, 0x51, 0x67, 0x81, 0xbb, 0x98, 0xf4, 0xd5, 0x45, 0x0f, 0x27, 0xf6, 0x06, 0x3b, 0xb6, 0x75,
+	0x8c, 0x7d, 0xc0, 0xfd, 0x29, 0x0c, 0x3e, 0x64, 0xa2, 0x38, 0x87, 0x81, 0x96, 0x49, 0x73, 0x9b,
+	0x23, 0x4c, 0xed, 0xff, 0x32, 0x18, 0xbe, 0x8a, 0x77, 0xd4, 0x7c, 0x09, 0x63, 0xcc, 0x3a, 0x7d,
+	0xba, 0xfe, 0x82, 0x36, 0x1a, 0x30, 0x5c, 0xb5, 0x48, 0x73, 0x7c, 0x47, 0xe4, 0x33, 0x00, 0x5d,
+	0xe6, 0x91, 0xd2, 0x65, 0x81, 0x64, 0x84, 0x16, 0xf7, 0x26, 0xd3, 0x15, 0x9c, 0xfe, 0xfb, 0xf5,
+	0x48, 0x40, 0xb3, 0x7e, 0x40, 0xee, 0x62, 0x4c, 0xa2, 0x64, 0xb7, 0x1f, 0xd5, 0x27, 0xb8, 0xcf,
+	0xeb, 0xb5, 0xc0, 0x24, 0x55, 0x14, 0x56, 0x97, 0x29, 0xad, 0x99, 0xb4, 0x44, 0x7e, 0x09, 0x8e,
+	0x4e, 0x73, 0x54, 0x5a, 0xe6, 0x95, 0x59, 0x66, 0x8b, 0xc3, 0x80, 0x7b, 0x70, 0x52, 0x63, 0x95,
+	0xa5, 0xb1, 0xf4, 0x6c, 0x23, 0xbe, 0x6f, 0xfd, 0x1b, 0x18, 0x3e, 0x62, 0xa6, 0x25, 0xe5, 0x53,
+	0xc8, 0x1c, 0x5b, 0x73, 0xa6, 0x26, 0x29, 0xa5, 0xa5, 0x6e, 0xdc, 0x4d, 0x44, 0xd3, 0x44, 0x23,
+	0xf3, 0x7c, 0x96, 0x7f, 0x03, 0x00, 0x63, 0x56, 0x05, 0x05, 0x4c, 0x02, 0x00, 0x00,
+}
@@ -0,0 +1,158 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: heartbeat.proto
+
+package pb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type Route struct {
+	Peer string `protobuf:"bytes,1,opt,name=peer" json:"peer,omitempty"`
+	Hops uint32 `protobuf:"varint,2,opt,name=hops" json:"hops,omitempty"`
+}
+
+func (m *Route) Reset()                    { *m = Route{} }
+func (m *Route) String() string            { return proto.CompactTextString(m) }
+func (*Route) ProtoMessage()               {}
+func (*Route) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{0} }
+
+func (m *Route) GetPeer() string {
+	if m != nil {
+		return m.Peer
+	}
+	return ""
+}
+
+func (m *Route) GetHops() uint32 {
+	if m != nil {
+		return m.Hops
+	}
+	return 0
+}
+
+type Heartbeat struct {
+	Routes       []*Route          `protobuf:"bytes,1,rep,name=routes" json:"routes,omitempty"`
+	Counters     map[string]uint64 `protobuf:"bytes,2,rep,name=counters" json:"counters,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	Deltas       []*Delta          `protobuf:"bytes,3,rep,name=deltas" json:"deltas,omitempty"`
+	Incarnations map[string]uint64 `protobuf:"bytes,4,rep,name=incarnations" json:"incarnations,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+}
+
+func (m *Heartbeat) Reset()                    { *m = Heartbeat{} }
+func (m *Heartbeat) String() string            { return proto.CompactTextString(m) }
+func (*Heartbeat) ProtoMessage()               {}
+func (*Heartbeat) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{1} }
+
+func (m *Heartbeat) GetRoutes() []*Route {
+	if m != nil {
+		return m.Routes
+	}
+	return nil
+}
+
+func (m *Heartbeat) GetCounters() map[string]uint64 {
+	if m != nil {
+		return m.Counters
+	}
+	return nil
+}
+
+func (m *Heartbeat) GetDeltas() []*Delta {
+	if m != nil {
+		return m.Deltas
+	}
+	return nil
+}
+
+func (m *Heartbeat) GetIncarnations() map[string]uint64 {
+	if m != nil {
+		return m.Incarnations
+	}
+	return nil
+}
+
+type Datagram struct {
+	Sender      string `protobuf:"bytes,1,opt,name=sender" json:"sender,omitempty"`
+	Sequence    uint64 `protobuf:"varint,2,opt,name=sequence" json:"sequence,omitempty"`
+	Mac         []byte `protobuf:"bytes,3,opt,name=mac,proto3" json:"mac,omitempty"`
+	Incarnation uint64 `protobuf:"varint,4,opt,name=incarnation" json:"incarnation,omitempty"`
+	Timestamp   int64  `protobuf:"varint,5,opt,name=timestamp" json:"timestamp,omitempty"`
+}
+
+func (m *Datagram) Reset()                    { *m = Datagram{} }
+func (m *Datagram) String() string            { return proto.CompactTextString(m) }
+func (*Datagram) ProtoMessage()               {}
+func (*Datagram) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{2} }
+
+func (m *Datagram) GetSender() string {
+	if m != nil {
+		return m.Sender
+	}
+	return ""
+}
+
+func (m *Datagram) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func (m *Datagram) GetMac() []byte {
+	if m != nil {
+		return m.Mac
+	}
+	return nil
+}
+
+func (m *Datagram) GetIncarnation() uint64 {
+	if m != nil {
+		return m.Incarnation
+	}
+	return 0
+}
+
+func (m *Datagram) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*Route)(nil), "pb.Route")
+	proto.RegisterType((*Heartbeat)(nil), "pb.Heartbeat")
+	proto.RegisterType((*Datagram)(nil), "pb.Datagram")
+}
+
+func init() { proto.RegisterFile("heartbeat.proto", fileDescriptor2) }
+
+var fileDescriptor2 = []byte{
+	// 322 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x92, 0xb1, 0x4e, 0xf3, 0x30,
+	0x14, 0x85, 0xe5, 0x24, 0xad, 0x9a, 0xdb, 0x56, 0xff, 0x8f, 0x85, 0x90, 0x15, 0x90, 0x08, 0x9d,
+	0x32, 0x05, 0x09, 0x06, 0x10, 0x0c, 0x0c, 0x2d, 0x12, 0xac, 0x7e, 0x03, 0x27, 0xbd, 0xa2, 0x15,
+	0x8d, 0x13, 0x6c, 0x07, 0xa9, 0x6f, 0xc1, 0x8b, 0xf1, 0x4e, 0xc8, 0xae, 0x9b, 0x36, 0x62, 0x62,
+	0x3b, 0xe7, 0xdc, 0x73, 0x3f, 0x27, 0x4e, 0xe0, 0xdf, 0x0a, 0x85, 0x32, 0x05, 0x0a, 0x93, 0x37,
+	0xaa, 0x36, 0x35, 0x0d, 0x9a, 0x22, 0x81, 0x52, 0x2d, 0xbd, 0x9f, 0x5d, 0xc3, 0x80, 0xd7, 0xad,
+	0x41, 0x4a, 0x21, 0x6a, 0x10, 0x15, 0x23, 0x29, 0xc9, 0x62, 0xee, 0xb4, 0xcd, 0x56, 0x75, 0xa3,
+	0x59, 0x90, 0x92, 0x6c, 0xca, 0x9d, 0x9e, 0x7d, 0x07, 0x10, 0xbf, 0xec, 0xa1, 0xf4, 0x0a, 0x86,
+	0xca, 0xae, 0x6b, 0x46, 0xd2, 0x30, 0x1b, 0xdf, 0xc4, 0x79, 0x53, 0xe4, 0x0e, 0xc8, 0xfd, 0x80,
+	0xde, 0xc1, 0xa8, 0xac, 0x5b, 0x69, 0x50, 0x59, 0x90, 0x2d, 0x9d, 0xdb, 0x52, 0xc7, 0xc8, 0xe7,
+	0x7e, 0xfa, 0x2c, 0x8d, 0xda, 0xf2, 0xae, 0x6c, 0xd9, 0x4b, 0xdc, 0x18, 0xa1, 0x59, 0x78, 0x60,
+	0x2f, 0x6c, 0xc2, 0xfd, 0x80, 0xce, 0x61, 0xb2, 0x96, 0xa5, 0x50, 0x52, 0x98, 0x75, 0x2d, 0x35,
+	0x8b, 0x5c, 0xf1, 0xb2, 0xcf, 0x7f, 0x3d, 0x6a, 0xec, 0xce, 0xe8, 0x2d, 0x25, 0x8f, 0x30, 0xed,
+	0x3d, 0x02, 0xfd, 0x0f, 0xe1, 0x3b, 0x6e, 0xfd, 0x4d, 0x58, 0x49, 0x4f, 0x61, 0xf0, 0x29, 0x36,
+	0x2d, 0xba, 0x9b, 0x88, 0xf8, 0xce, 0x3c, 0x04, 0xf7, 0x24, 0x79, 0x82, 0x93, 0x5f, 0xfc, 0xbf,
+	0x00, 0x66, 0x5f, 0x04, 0x46, 0x0b, 0x61, 0xc4, 0x9b, 0x12, 0x15, 0x3d, 0x83, 0xa1, 0x46, 0xb9,
+	0xec, 0x3e, 0x83, 0x77, 0x34, 0x81, 0x91, 0xc6, 0x8f, 0x16, 0x65, 0xb9, 0x27, 0x74, 0xde, 0x1e,
+	0x56, 0x89, 0x92, 0x85, 0x29, 0xc9, 0x26, 0xdc, 0x4a, 0x9a, 0xc2, 0xf8, 0xe8, 0x05, 0x59, 0xe4,
+	0x16, 0x8e, 0x23, 0x7a, 0x01, 0xb1, 0x59, 0x57, 0xa8, 0x8d, 0xa8, 0x1a, 0x36, 0x48, 0x49, 0x16,
+	0xf2, 0x43, 0x50, 0x0c, 0xdd, 0xaf, 0x71, 0xfb, 0x33, 0x00, 0x0e, 0x21, 0x26, 0x0d, 0x3d, 0x02,
+	0x00, 0x00,
+}
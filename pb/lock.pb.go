@@ -0,0 +1,94 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: lock.proto
+
+package pb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type LockOperation int32
+
+const (
+	LockOperation_ACQUIRE LockOperation = 0
+	LockOperation_RELEASE LockOperation = 1
+	LockOperation_GRANT   LockOperation = 2
+	LockOperation_QUEUED  LockOperation = 3
+)
+
+var LockOperation_name = map[int32]string{
+	0: "ACQUIRE",
+	1: "RELEASE",
+	2: "GRANT",
+	3: "QUEUED",
+}
+var LockOperation_value = map[string]int32{
+	"ACQUIRE": 0,
+	"RELEASE": 1,
+	"GRANT":   2,
+	"QUEUED":  3,
+}
+
+func (x LockOperation) String() string {
+	return proto.EnumName(LockOperation_name, int32(x))
+}
+func (LockOperation) EnumDescriptor() ([]byte, []int) { return fileDescriptor3, []int{0} }
+
+type Lock struct {
+	Name    string        `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Op      LockOperation `protobuf:"varint,2,opt,name=op,enum=pb.LockOperation" json:"op,omitempty"`
+	Attempt uint64        `protobuf:"varint,3,opt,name=attempt" json:"attempt,omitempty"`
+}
+
+func (m *Lock) Reset()                    { *m = Lock{} }
+func (m *Lock) String() string            { return proto.CompactTextString(m) }
+func (*Lock) ProtoMessage()               {}
+func (*Lock) Descriptor() ([]byte, []int) { return fileDescriptor3, []int{0} }
+
+func (m *Lock) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Lock) GetOp() LockOperation {
+	if m != nil {
+		return m.Op
+	}
+	return LockOperation_ACQUIRE
+}
+
+func (m *Lock) GetAttempt() uint64 {
+	if m != nil {
+		return m.Attempt
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*Lock)(nil), "pb.Lock")
+	proto.RegisterEnum("pb.LockOperation", LockOperation_name, LockOperation_value)
+}
+
+func init() { proto.RegisterFile("lock.proto", fileDescriptor3) }
+
+var fileDescriptor3 = []byte{
+	// 173 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0xca, 0xc9, 0x4f, 0xce,
+	0xd6, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x2a, 0x48, 0x52, 0x0a, 0xe7, 0x62, 0xf1, 0xc9,
+	0x4f, 0xce, 0x16, 0x12, 0xe2, 0x62, 0xc9, 0x4b, 0xcc, 0x4d, 0x95, 0x60, 0x54, 0x60, 0xd4, 0xe0,
+	0x0c, 0x02, 0xb3, 0x85, 0x14, 0xb9, 0x98, 0xf2, 0x0b, 0x24, 0x98, 0x14, 0x18, 0x35, 0xf8, 0x8c,
+	0x04, 0xf5, 0x0a, 0x92, 0xf4, 0x40, 0x2a, 0xfd, 0x0b, 0x52, 0x8b, 0x12, 0x4b, 0x32, 0xf3, 0xf3,
+	0x82, 0x98, 0xf2, 0x0b, 0x84, 0x24, 0xb8, 0xd8, 0x13, 0x4b, 0x4a, 0x52, 0x73, 0x0b, 0x4a, 0x24,
+	0x98, 0x15, 0x18, 0x35, 0x58, 0x82, 0x60, 0x5c, 0x2d, 0x07, 0x2e, 0x5e, 0x14, 0xe5, 0x42, 0xdc,
+	0x5c, 0xec, 0x8e, 0xce, 0x81, 0xa1, 0x9e, 0x41, 0xae, 0x02, 0x0c, 0x20, 0x4e, 0x90, 0xab, 0x8f,
+	0xab, 0x63, 0xb0, 0xab, 0x00, 0xa3, 0x10, 0x27, 0x17, 0xab, 0x7b, 0x90, 0xa3, 0x5f, 0x88, 0x00,
+	0x93, 0x10, 0x17, 0x17, 0x5b, 0x60, 0xa8, 0x6b, 0xa8, 0xab, 0x8b, 0x00, 0x73, 0x12, 0x1b, 0xd8,
+	0x95, 0xc6, 0x80, 0x01, 0x00, 0x5f, 0x56, 0xb9, 0x90, 0xb3, 0x00, 0x00, 0x00,
+}
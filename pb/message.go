@@ -1,18 +1,162 @@
 package pb
 
-import "time"
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+)
+
+// EnvelopeVersion is the current version of the envelope schema. Version 0
+// envelopes only have a sender, an RFC3339 string timestamp, a type, and a
+// message; version 1 adds the ID, recipient, TTL, timestamp, and headers.
+const EnvelopeVersion = 1
+
+// Transit headers are set on an envelope after it has been signed by its
+// sender: the relay header by each host that relays the envelope, and the
+// content-encoding header when the payload is compressed for a stream.
+const (
+	HeaderRelay           = "livenet-relay"
+	HeaderContentEncoding = "content-encoding"
+)
 
 // Wrap a message that has already been serialized into an Envelop for dispatch
 func Wrap(sender string, mtype MessageType, message []byte) *Envelope {
 	return &Envelope{
-		Sender:    sender,
-		Type:      mtype,
-		Timestamp: time.Now().Format(time.RFC3339Nano),
-		Message:   message,
+		Version: EnvelopeVersion,
+		Id:      NewID(),
+		Sender:  sender,
+		Type:    mtype,
+		Sent:    ptypes.TimestampNow(),
+		Message: message,
+	}
+}
+
+// WrapTo wraps a serialized message into an Envelope addressed to the
+// recipient that is relayed at most ttl hops.
+func WrapTo(sender, recipient string, ttl uint32, mtype MessageType, message []byte) *Envelope {
+	env := Wrap(sender, mtype, message)
+	env.Recipient = recipient
+	env.Ttl = ttl
+	return env
+}
+
+// NewID returns a random 128-bit hex encoded message ID.
+func NewID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		// Fall back on the time if there is no randomness available
+		return fmt.Sprintf("%032x", time.Now().UnixNano())
 	}
+	return hex.EncodeToString(id)
+}
+
+// Upgrade an envelope decoded from an older version of the schema to the
+// current version, parsing the string timestamp of version 0 envelopes and
+// assigning them an ID since their senders do not. Returns an error if the
+// envelope is from a newer version of the schema that cannot be decoded.
+func (e *Envelope) Upgrade() error {
+	if e.Version > EnvelopeVersion {
+		return fmt.Errorf("unknown envelope version %d (newest is %d)", e.Version, EnvelopeVersion)
+	}
+
+	if e.Version == EnvelopeVersion {
+		return nil
+	}
+
+	if e.Id == "" {
+		e.Id = NewID()
+	}
+
+	if e.Sent == nil && e.Timestamp != "" {
+		ts, err := time.Parse(time.RFC3339Nano, e.Timestamp)
+		if err != nil {
+			return fmt.Errorf("could not parse version %d envelope timestamp: %s", e.Version, err)
+		}
+
+		if e.Sent, err = ptypes.TimestampProto(ts); err != nil {
+			return err
+		}
+	}
+
+	e.Timestamp = ""
+	e.Version = EnvelopeVersion
+	return nil
 }
 
 // ParseTimestamp returns the parsed time struct from the envelope.
 func (e *Envelope) ParseTimestamp() (time.Time, error) {
-	return time.Parse(time.RFC3339Nano, e.GetTimestamp())
+	if e.GetSent() == nil {
+		return time.Parse(time.RFC3339Nano, e.GetTimestamp())
+	}
+	return ptypes.Timestamp(e.GetSent())
+}
+
+// Header returns the value of the header and whether it is set.
+func (e *Envelope) Header(key string) (string, bool) {
+	value, ok := e.GetHeaders()[key]
+	return value, ok
+}
+
+// SetHeader sets the value of a header on the envelope.
+func (e *Envelope) SetHeader(key, value string) {
+	if e.Headers == nil {
+		e.Headers = make(map[string]string)
+	}
+	e.Headers[key] = value
+}
+
+// Sign the envelope with the private key of the sender.
+func (e *Envelope) Sign(key ed25519.PrivateKey) {
+	e.Signature = ed25519.Sign(key, e.signed())
+}
+
+// Verify the signature of the envelope with the public key of the sender.
+func (e *Envelope) Verify(key ed25519.PublicKey) bool {
+	if len(e.Signature) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(key, e.signed(), e.Signature)
+}
+
+// Returns the canonical encoding of the fields of the envelope that are set
+// by the sender, including the headers sorted by key. The TTL and transit
+// headers are not signed because they are updated by relays and by
+// compression, and the message is signed uncompressed.
+func (e *Envelope) signed() []byte {
+	buf := new(bytes.Buffer)
+	field := func(data []byte) {
+		binary.Write(buf, binary.BigEndian, uint32(len(data)))
+		buf.Write(data)
+	}
+
+	binary.Write(buf, binary.BigEndian, e.Version)
+	field([]byte(e.Sender))
+	field([]byte(e.Recipient))
+	binary.Write(buf, binary.BigEndian, int32(e.Type))
+	field([]byte(e.Id))
+	binary.Write(buf, binary.BigEndian, e.GetSent().GetSeconds())
+	binary.Write(buf, binary.BigEndian, e.GetSent().GetNanos())
+	field(e.Message)
+
+	keys := make([]string, 0, len(e.Headers))
+	for key := range e.Headers {
+		if key != HeaderRelay && key != HeaderContentEncoding {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	binary.Write(buf, binary.BigEndian, uint32(len(keys)))
+	for _, key := range keys {
+		field([]byte(key))
+		field([]byte(e.Headers[key]))
+	}
+	return buf.Bytes()
 }
@@ -1,62 +1,78 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // source: message.proto
 
-/*
-Package pb is a generated protocol buffer package.
-
-It is generated from these files:
-	message.proto
-	service.proto
-
-It has these top-level messages:
-	Envelope
-*/
 package pb
 
 import proto "github.com/golang/protobuf/proto"
 import fmt "fmt"
 import math "math"
+import google_protobuf "github.com/golang/protobuf/ptypes/timestamp"
 
 // Reference imports to suppress errors if they are not otherwise used.
 var _ = proto.Marshal
 var _ = fmt.Errorf
 var _ = math.Inf
 
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the proto package it is being compiled against.
-// A compilation error at this line likely means your copy of the
-// proto package needs to be updated.
-const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
-
 type MessageType int32
 
 const (
 	MessageType_HEARTBEAT MessageType = 0
+	MessageType_SUBSCRIBE MessageType = 1
+	MessageType_PUBLISH   MessageType = 2
+	MessageType_DIRECT    MessageType = 3
+	MessageType_SYNC      MessageType = 4
+	MessageType_LOCK      MessageType = 5
+	MessageType_BARRIER   MessageType = 6
+	MessageType_BATCH     MessageType = 7
+	MessageType_CHUNK     MessageType = 8
 )
 
 var MessageType_name = map[int32]string{
 	0: "HEARTBEAT",
+	1: "SUBSCRIBE",
+	2: "PUBLISH",
+	3: "DIRECT",
+	4: "SYNC",
+	5: "LOCK",
+	6: "BARRIER",
+	7: "BATCH",
+	8: "CHUNK",
 }
 var MessageType_value = map[string]int32{
 	"HEARTBEAT": 0,
+	"SUBSCRIBE": 1,
+	"PUBLISH":   2,
+	"DIRECT":    3,
+	"SYNC":      4,
+	"LOCK":      5,
+	"BARRIER":   6,
+	"BATCH":     7,
+	"CHUNK":     8,
 }
 
 func (x MessageType) String() string {
 	return proto.EnumName(MessageType_name, int32(x))
 }
-func (MessageType) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+func (MessageType) EnumDescriptor() ([]byte, []int) { return fileDescriptor4, []int{0} }
 
 type Envelope struct {
-	Sender    string      `protobuf:"bytes,1,opt,name=sender" json:"sender,omitempty"`
-	Timestamp string      `protobuf:"bytes,2,opt,name=timestamp" json:"timestamp,omitempty"`
-	Type      MessageType `protobuf:"varint,3,opt,name=type,enum=pb.MessageType" json:"type,omitempty"`
-	Message   []byte      `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	Sender    string                     `protobuf:"bytes,1,opt,name=sender" json:"sender,omitempty"`
+	Timestamp string                     `protobuf:"bytes,2,opt,name=timestamp" json:"timestamp,omitempty"`
+	Type      MessageType                `protobuf:"varint,3,opt,name=type,enum=pb.MessageType" json:"type,omitempty"`
+	Message   []byte                     `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	Recipient string                     `protobuf:"bytes,5,opt,name=recipient" json:"recipient,omitempty"`
+	Ttl       uint32                     `protobuf:"varint,6,opt,name=ttl" json:"ttl,omitempty"`
+	Version   uint32                     `protobuf:"varint,7,opt,name=version" json:"version,omitempty"`
+	Id        string                     `protobuf:"bytes,8,opt,name=id" json:"id,omitempty"`
+	Sent      *google_protobuf.Timestamp `protobuf:"bytes,9,opt,name=sent" json:"sent,omitempty"`
+	Headers   map[string]string          `protobuf:"bytes,10,rep,name=headers" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Signature []byte                     `protobuf:"bytes,11,opt,name=signature,proto3" json:"signature,omitempty"`
 }
 
 func (m *Envelope) Reset()                    { *m = Envelope{} }
 func (m *Envelope) String() string            { return proto.CompactTextString(m) }
 func (*Envelope) ProtoMessage()               {}
-func (*Envelope) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+func (*Envelope) Descriptor() ([]byte, []int) { return fileDescriptor4, []int{0} }
 
 func (m *Envelope) GetSender() string {
 	if m != nil {
@@ -86,24 +102,107 @@ func (m *Envelope) GetMessage() []byte {
 	return nil
 }
 
+func (m *Envelope) GetRecipient() string {
+	if m != nil {
+		return m.Recipient
+	}
+	return ""
+}
+
+func (m *Envelope) GetTtl() uint32 {
+	if m != nil {
+		return m.Ttl
+	}
+	return 0
+}
+
+func (m *Envelope) GetVersion() uint32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *Envelope) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Envelope) GetSent() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.Sent
+	}
+	return nil
+}
+
+func (m *Envelope) GetHeaders() map[string]string {
+	if m != nil {
+		return m.Headers
+	}
+	return nil
+}
+
+func (m *Envelope) GetSignature() []byte {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
+type Batch struct {
+	Envelopes []*Envelope `protobuf:"bytes,1,rep,name=envelopes" json:"envelopes,omitempty"`
+}
+
+func (m *Batch) Reset()                    { *m = Batch{} }
+func (m *Batch) String() string            { return proto.CompactTextString(m) }
+func (*Batch) ProtoMessage()               {}
+func (*Batch) Descriptor() ([]byte, []int) { return fileDescriptor4, []int{1} }
+
+func (m *Batch) GetEnvelopes() []*Envelope {
+	if m != nil {
+		return m.Envelopes
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Envelope)(nil), "pb.Envelope")
+	proto.RegisterType((*Batch)(nil), "pb.Batch")
 	proto.RegisterEnum("pb.MessageType", MessageType_name, MessageType_value)
 }
 
-func init() { proto.RegisterFile("message.proto", fileDescriptor0) }
-
-var fileDescriptor0 = []byte{
-	// 164 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0xcd, 0x4d, 0x2d, 0x2e,
-	0x4e, 0x4c, 0x4f, 0xd5, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x2a, 0x48, 0x52, 0xaa, 0xe7,
-	0xe2, 0x70, 0xcd, 0x2b, 0x4b, 0xcd, 0xc9, 0x2f, 0x48, 0x15, 0x12, 0xe3, 0x62, 0x2b, 0x4e, 0xcd,
-	0x4b, 0x49, 0x2d, 0x92, 0x60, 0x54, 0x60, 0xd4, 0xe0, 0x0c, 0x82, 0xf2, 0x84, 0x64, 0xb8, 0x38,
-	0x4b, 0x32, 0x73, 0x53, 0x8b, 0x4b, 0x12, 0x73, 0x0b, 0x24, 0x98, 0xc0, 0x52, 0x08, 0x01, 0x21,
-	0x65, 0x2e, 0x96, 0x92, 0xca, 0x82, 0x54, 0x09, 0x66, 0x05, 0x46, 0x0d, 0x3e, 0x23, 0x7e, 0xbd,
-	0x82, 0x24, 0x3d, 0x5f, 0x88, 0x35, 0x21, 0x95, 0x05, 0xa9, 0x41, 0x60, 0x49, 0x21, 0x09, 0x2e,
-	0x76, 0xa8, 0xdd, 0x12, 0x2c, 0x0a, 0x8c, 0x1a, 0x3c, 0x41, 0x30, 0xae, 0x96, 0x0c, 0x17, 0x37,
-	0x92, 0x72, 0x21, 0x5e, 0x2e, 0x4e, 0x0f, 0x57, 0xc7, 0xa0, 0x10, 0x27, 0x57, 0xc7, 0x10, 0x01,
-	0x86, 0x24, 0x36, 0xb0, 0x4b, 0x8d, 0x01, 0x01, 0x00, 0x00, 0xff, 0xff, 0x8f, 0x3d, 0x48, 0xf5,
-	0xba, 0x00, 0x00, 0x00,
+func init() { proto.RegisterFile("message.proto", fileDescriptor4) }
+
+var fileDescriptor4 = []byte{
+	// 433 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x4c, 0x50, 0x4d, 0x6f, 0xda, 0x40,
+	0x14, 0xec, 0x1a, 0x7f, 0xe0, 0x67, 0x48, 0x57, 0xab, 0xaa, 0xda, 0xa2, 0x4a, 0xb5, 0xd2, 0x8b,
+	0x95, 0x83, 0x23, 0xc1, 0xa5, 0xca, 0x0d, 0xbb, 0x96, 0x8c, 0x92, 0xa6, 0xd5, 0x62, 0x0e, 0x3d,
+	0x9a, 0xf0, 0x4a, 0xac, 0x82, 0x6d, 0xd9, 0x0b, 0x12, 0xea, 0x5f, 0xe9, 0x8f, 0xad, 0x76, 0x8d,
+	0x0b, 0xb7, 0x37, 0xf3, 0x66, 0xdf, 0xce, 0x0c, 0x8c, 0xf7, 0xd8, 0xb6, 0xf9, 0x16, 0xc3, 0xba,
+	0xa9, 0x64, 0xc5, 0x8c, 0x7a, 0x3d, 0xf9, 0xb4, 0xad, 0xaa, 0xed, 0x0e, 0xef, 0x35, 0xb3, 0x3e,
+	0xfc, 0xba, 0x97, 0xc5, 0x1e, 0x5b, 0x99, 0xef, 0xeb, 0x4e, 0x74, 0xfb, 0x77, 0x00, 0xc3, 0xa4,
+	0x3c, 0xe2, 0xae, 0xaa, 0x91, 0xbd, 0x07, 0xbb, 0xc5, 0x72, 0x83, 0x0d, 0x27, 0x3e, 0x09, 0x5c,
+	0x71, 0x46, 0xcc, 0x07, 0xf7, 0xff, 0x3b, 0x6e, 0xa8, 0x55, 0x64, 0x70, 0x22, 0x2e, 0x24, 0xfb,
+	0x0c, 0xa6, 0x3c, 0xd5, 0xc8, 0x07, 0x3e, 0x09, 0x6e, 0xa6, 0x6f, 0xc3, 0x7a, 0x1d, 0x7e, 0xeb,
+	0xcc, 0x64, 0xa7, 0x1a, 0x85, 0x5e, 0x32, 0x0e, 0xce, 0xd9, 0x21, 0x37, 0x7d, 0x12, 0x8c, 0x44,
+	0x0f, 0xd9, 0x47, 0x70, 0x1b, 0x7c, 0x29, 0xea, 0x02, 0x4b, 0xc9, 0x2d, 0xfd, 0xf7, 0x85, 0x60,
+	0x14, 0x06, 0x52, 0xee, 0xb8, 0xed, 0x93, 0x60, 0x2c, 0xd4, 0xa8, 0x2e, 0x1d, 0xb1, 0x69, 0x8b,
+	0xaa, 0xe4, 0x8e, 0x66, 0x7b, 0xc8, 0x6e, 0xc0, 0x28, 0x36, 0x7c, 0xa8, 0x4f, 0x18, 0xc5, 0x86,
+	0x85, 0x60, 0xb6, 0xea, 0xa8, 0xeb, 0x93, 0xc0, 0x9b, 0x4e, 0xc2, 0xae, 0x8f, 0xb0, 0xef, 0x23,
+	0xcc, 0xfa, 0x08, 0x42, 0xeb, 0xd8, 0x0c, 0x9c, 0x57, 0xcc, 0x37, 0xd8, 0xb4, 0x1c, 0xfc, 0x41,
+	0xe0, 0x4d, 0x3f, 0xa8, 0x2c, 0x7d, 0x43, 0x61, 0xda, 0xed, 0x92, 0x52, 0x36, 0x27, 0xd1, 0x2b,
+	0x95, 0xfd, 0xb6, 0xd8, 0x96, 0xb9, 0x3c, 0x34, 0xc8, 0x3d, 0x1d, 0xed, 0x42, 0x4c, 0x1e, 0x60,
+	0x74, 0xfd, 0x4c, 0xc5, 0xf9, 0x8d, 0xa7, 0x73, 0xc5, 0x6a, 0x64, 0xef, 0xc0, 0x3a, 0xe6, 0xbb,
+	0x03, 0x76, 0xdd, 0x8a, 0x0e, 0x3c, 0x18, 0x5f, 0xc8, 0xed, 0x0c, 0xac, 0x28, 0x97, 0x2f, 0xaf,
+	0xec, 0x0e, 0x5c, 0x3c, 0x9b, 0x68, 0x39, 0xd1, 0xce, 0x46, 0xd7, 0xce, 0xc4, 0x65, 0x7d, 0xf7,
+	0x07, 0xbc, 0xab, 0xf2, 0xd9, 0x18, 0xdc, 0x34, 0x99, 0x8b, 0x2c, 0x4a, 0xe6, 0x19, 0x7d, 0xa3,
+	0xe0, 0x72, 0x15, 0x2d, 0x63, 0xb1, 0x88, 0x12, 0x4a, 0x98, 0x07, 0xce, 0x8f, 0x55, 0xf4, 0xb4,
+	0x58, 0xa6, 0xd4, 0x60, 0x00, 0xf6, 0xd7, 0x85, 0x48, 0xe2, 0x8c, 0x0e, 0xd8, 0x10, 0xcc, 0xe5,
+	0xcf, 0xe7, 0x98, 0x9a, 0x6a, 0x7a, 0xfa, 0x1e, 0x3f, 0x52, 0x4b, 0x89, 0xa3, 0xb9, 0x10, 0x8b,
+	0x44, 0x50, 0x9b, 0xb9, 0x60, 0x45, 0xf3, 0x2c, 0x4e, 0xa9, 0xa3, 0xc6, 0x38, 0x5d, 0x3d, 0x3f,
+	0xd2, 0xe1, 0xda, 0xd6, 0xd5, 0xce, 0xfe, 0x0d, 0x00, 0x5f, 0x40, 0xa1, 0x66, 0x8d, 0x02, 0x00,
+	0x00,
 }
@@ -0,0 +1,85 @@
+package pb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+)
+
+// Encode a version 0 envelope as it was serialized before the schema had a
+// version: only the sender, the string timestamp, the type, and the message.
+func encodeV0(sender, timestamp string, mtype MessageType, message []byte) []byte {
+	field := func(data []byte, tag byte, value []byte) []byte {
+		data = append(data, tag, byte(len(value)))
+		return append(data, value...)
+	}
+
+	var data []byte
+	data = field(data, 0x0a, []byte(sender))
+	data = field(data, 0x12, []byte(timestamp))
+	data = append(data, 0x18, byte(mtype))
+	return field(data, 0x22, message)
+}
+
+func TestUpgradeVersion0(t *testing.T) {
+	sent := time.Date(2018, 3, 14, 15, 9, 26, 535897000, time.UTC)
+	data := encodeV0("alpha", sent.Format(time.RFC3339Nano), MessageType_DIRECT, []byte("hello"))
+
+	env := new(Envelope)
+	if err := proto.Unmarshal(data, env); err != nil {
+		t.Fatalf("could not unmarshal version 0 envelope: %s", err)
+	}
+
+	if env.Version != 0 || env.Id != "" || env.Sent != nil || env.Headers != nil {
+		t.Fatalf("unexpected fields of version 0 envelope before upgrading: %+v", env)
+	}
+
+	if err := env.Upgrade(); err != nil {
+		t.Fatalf("could not upgrade version 0 envelope: %s", err)
+	}
+
+	if env.Version != EnvelopeVersion || env.Timestamp != "" || len(env.Id) != 32 {
+		t.Errorf("envelope was not upgraded: %+v", env)
+	}
+
+	if ts, err := ptypes.Timestamp(env.Sent); err != nil || !ts.Equal(sent) {
+		t.Errorf("expected the sent time %s, got %s (%v)", sent, ts, err)
+	}
+
+	if ts, err := env.ParseTimestamp(); err != nil || !ts.Equal(sent) {
+		t.Errorf("expected the parsed timestamp %s, got %s (%v)", sent, ts, err)
+	}
+
+	if env.Sender != "alpha" || env.Type != MessageType_DIRECT || string(env.Message) != "hello" {
+		t.Errorf("fields of version 0 envelope were modified: %+v", env)
+	}
+
+	if env.Recipient != "" || env.Ttl != 0 || len(env.Headers) != 0 || len(env.Signature) != 0 {
+		t.Errorf("unexpected fields set on upgraded envelope: %+v", env)
+	}
+
+	// Upgrading an envelope of the current version does not modify it
+	id := env.Id
+	if err := env.Upgrade(); err != nil || env.Id != id {
+		t.Errorf("upgrading a current envelope modified it: %v", err)
+	}
+}
+
+func TestUpgradeInvalidEnvelopes(t *testing.T) {
+	env := new(Envelope)
+	if err := proto.Unmarshal(encodeV0("alpha", "yesterday", MessageType_HEARTBEAT, nil), env); err != nil {
+		t.Fatalf("could not unmarshal version 0 envelope: %s", err)
+	}
+
+	if err := env.Upgrade(); err == nil {
+		t.Error("expected an unparseable timestamp to be rejected")
+	}
+
+	future := Wrap("alpha", MessageType_DIRECT, []byte("hello"))
+	future.Version = EnvelopeVersion + 1
+	if err := future.Upgrade(); err == nil {
+		t.Error("expected an envelope of an unknown future version to be rejected")
+	}
+}
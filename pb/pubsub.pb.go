@@ -0,0 +1,72 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: pubsub.proto
+
+package pb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type Subscriptions struct {
+	Topics []string `protobuf:"bytes,1,rep,name=topics" json:"topics,omitempty"`
+}
+
+func (m *Subscriptions) Reset()                    { *m = Subscriptions{} }
+func (m *Subscriptions) String() string            { return proto.CompactTextString(m) }
+func (*Subscriptions) ProtoMessage()               {}
+func (*Subscriptions) Descriptor() ([]byte, []int) { return fileDescriptor5, []int{0} }
+
+func (m *Subscriptions) GetTopics() []string {
+	if m != nil {
+		return m.Topics
+	}
+	return nil
+}
+
+type Publication struct {
+	Topic   string `protobuf:"bytes,1,opt,name=topic" json:"topic,omitempty"`
+	Payload []byte `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+}
+
+func (m *Publication) Reset()                    { *m = Publication{} }
+func (m *Publication) String() string            { return proto.CompactTextString(m) }
+func (*Publication) ProtoMessage()               {}
+func (*Publication) Descriptor() ([]byte, []int) { return fileDescriptor5, []int{1} }
+
+func (m *Publication) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *Publication) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Subscriptions)(nil), "pb.Subscriptions")
+	proto.RegisterType((*Publication)(nil), "pb.Publication")
+}
+
+func init() { proto.RegisterFile("pubsub.proto", fileDescriptor5) }
+
+var fileDescriptor5 = []byte{
+	// 127 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x29, 0x28, 0x4d, 0x2a,
+	0x2e, 0x4d, 0xd2, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x2a, 0x48, 0x52, 0x52, 0xe7, 0xe2,
+	0x0d, 0x2e, 0x4d, 0x2a, 0x4e, 0x2e, 0xca, 0x2c, 0x28, 0xc9, 0xcc, 0xcf, 0x2b, 0x16, 0x12, 0xe3,
+	0x62, 0x2b, 0xc9, 0x2f, 0xc8, 0x4c, 0x2e, 0x96, 0x60, 0x54, 0x60, 0xd6, 0xe0, 0x0c, 0x82, 0xf2,
+	0x94, 0x6c, 0xb9, 0xb8, 0x03, 0x4a, 0x93, 0x72, 0x32, 0x93, 0x13, 0x41, 0xea, 0x84, 0x44, 0xb8,
+	0x58, 0xc1, 0x12, 0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0x9c, 0x41, 0x10, 0x8e, 0x90, 0x04, 0x17, 0x7b,
+	0x41, 0x62, 0x65, 0x4e, 0x7e, 0x62, 0x8a, 0x04, 0x93, 0x02, 0xa3, 0x06, 0x4f, 0x10, 0x8c, 0x9b,
+	0xc4, 0x06, 0xb6, 0xd2, 0x18, 0x30, 0x00, 0x8e, 0x2a, 0xd8, 0xf8, 0x82, 0x00, 0x00, 0x00,
+}
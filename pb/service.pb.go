@@ -121,15 +121,15 @@ var _LiveNet_serviceDesc = grpc.ServiceDesc{
 	Metadata: "service.proto",
 }
 
-func init() { proto.RegisterFile("service.proto", fileDescriptor1) }
+func init() { proto.RegisterFile("service.proto", fileDescriptor6) }
 
-var fileDescriptor1 = []byte{
-	// 100 bytes of a gzipped FileDescriptorProto
+var fileDescriptor6 = []byte{
+	// 97 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x2d, 0x4e, 0x2d, 0x2a,
 	0xcb, 0x4c, 0x4e, 0xd5, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x2a, 0x48, 0x92, 0xe2, 0xcd,
 	0x4d, 0x2d, 0x2e, 0x4e, 0x4c, 0x87, 0x0a, 0x19, 0x19, 0x73, 0xb1, 0xfb, 0x64, 0x96, 0xa5, 0xfa,
 	0xa5, 0x96, 0x08, 0x69, 0x70, 0xb1, 0x04, 0xe4, 0x17, 0x97, 0x08, 0xf1, 0xe8, 0x15, 0x24, 0xe9,
 	0xb9, 0xe6, 0x95, 0xa5, 0xe6, 0xe4, 0x17, 0xa4, 0x4a, 0xa1, 0xf0, 0x94, 0x18, 0x34, 0x18, 0x0d,
-	0x18, 0x93, 0xd8, 0xc0, 0x7a, 0x8d, 0x01, 0x01, 0x00, 0x00, 0xff, 0xff, 0xbf, 0x0c, 0xa4, 0x52,
-	0x5f, 0x00, 0x00, 0x00,
+	0x18, 0x93, 0xd8, 0xc0, 0x7a, 0x8d, 0x01, 0x03, 0x00, 0xbf, 0x0c, 0xa4, 0x52, 0x5f, 0x00, 0x00,
+	0x00,
 }
@@ -0,0 +1,179 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: sync.proto
+
+package pb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type MerkleNode struct {
+	Level uint32 `protobuf:"varint,1,opt,name=level" json:"level,omitempty"`
+	Index uint32 `protobuf:"varint,2,opt,name=index" json:"index,omitempty"`
+	Hash  []byte `protobuf:"bytes,3,opt,name=hash,proto3" json:"hash,omitempty"`
+}
+
+func (m *MerkleNode) Reset()                    { *m = MerkleNode{} }
+func (m *MerkleNode) String() string            { return proto.CompactTextString(m) }
+func (*MerkleNode) ProtoMessage()               {}
+func (*MerkleNode) Descriptor() ([]byte, []int) { return fileDescriptor7, []int{0} }
+
+func (m *MerkleNode) GetLevel() uint32 {
+	if m != nil {
+		return m.Level
+	}
+	return 0
+}
+
+func (m *MerkleNode) GetIndex() uint32 {
+	if m != nil {
+		return m.Index
+	}
+	return 0
+}
+
+func (m *MerkleNode) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+type Digest struct {
+	Key  string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	Hash []byte `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
+}
+
+func (m *Digest) Reset()                    { *m = Digest{} }
+func (m *Digest) String() string            { return proto.CompactTextString(m) }
+func (*Digest) ProtoMessage()               {}
+func (*Digest) Descriptor() ([]byte, []int) { return fileDescriptor7, []int{1} }
+
+func (m *Digest) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *Digest) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+type Entry struct {
+	Key   string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	Value []byte `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (m *Entry) Reset()                    { *m = Entry{} }
+func (m *Entry) String() string            { return proto.CompactTextString(m) }
+func (*Entry) ProtoMessage()               {}
+func (*Entry) Descriptor() ([]byte, []int) { return fileDescriptor7, []int{2} }
+
+func (m *Entry) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *Entry) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+type Sync struct {
+	Store   string        `protobuf:"bytes,1,opt,name=store" json:"store,omitempty"`
+	Nodes   []*MerkleNode `protobuf:"bytes,2,rep,name=nodes" json:"nodes,omitempty"`
+	Buckets []uint32      `protobuf:"varint,3,rep,packed,name=buckets" json:"buckets,omitempty"`
+	Digests []*Digest     `protobuf:"bytes,4,rep,name=digests" json:"digests,omitempty"`
+	Entries []*Entry      `protobuf:"bytes,5,rep,name=entries" json:"entries,omitempty"`
+	Wants   []string      `protobuf:"bytes,6,rep,name=wants" json:"wants,omitempty"`
+}
+
+func (m *Sync) Reset()                    { *m = Sync{} }
+func (m *Sync) String() string            { return proto.CompactTextString(m) }
+func (*Sync) ProtoMessage()               {}
+func (*Sync) Descriptor() ([]byte, []int) { return fileDescriptor7, []int{3} }
+
+func (m *Sync) GetStore() string {
+	if m != nil {
+		return m.Store
+	}
+	return ""
+}
+
+func (m *Sync) GetNodes() []*MerkleNode {
+	if m != nil {
+		return m.Nodes
+	}
+	return nil
+}
+
+func (m *Sync) GetBuckets() []uint32 {
+	if m != nil {
+		return m.Buckets
+	}
+	return nil
+}
+
+func (m *Sync) GetDigests() []*Digest {
+	if m != nil {
+		return m.Digests
+	}
+	return nil
+}
+
+func (m *Sync) GetEntries() []*Entry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+func (m *Sync) GetWants() []string {
+	if m != nil {
+		return m.Wants
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*MerkleNode)(nil), "pb.MerkleNode")
+	proto.RegisterType((*Digest)(nil), "pb.Digest")
+	proto.RegisterType((*Entry)(nil), "pb.Entry")
+	proto.RegisterType((*Sync)(nil), "pb.Sync")
+}
+
+func init() { proto.RegisterFile("sync.proto", fileDescriptor7) }
+
+var fileDescriptor7 = []byte{
+	// 259 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x90, 0xbf, 0x4e, 0xc3, 0x30,
+	0x10, 0x87, 0x95, 0x38, 0x4e, 0xd4, 0x83, 0x22, 0x64, 0x75, 0xf0, 0x68, 0x85, 0x0e, 0x99, 0x82,
+	0x04, 0xaf, 0x00, 0x1b, 0x30, 0x98, 0x27, 0xc8, 0x9f, 0x13, 0x8d, 0x12, 0xd9, 0x91, 0xed, 0x16,
+	0xf2, 0x70, 0xbc, 0x1b, 0xb2, 0xdd, 0x00, 0x43, 0xb7, 0xfb, 0xee, 0xf7, 0xf9, 0x74, 0x67, 0x00,
+	0xbb, 0xa8, 0xae, 0x9e, 0x8d, 0x76, 0x9a, 0xa5, 0x73, 0x5b, 0xbe, 0x00, 0xbc, 0xa2, 0x19, 0x27,
+	0x7c, 0xd3, 0x3d, 0xb2, 0x1d, 0xd0, 0x09, 0x4f, 0x38, 0xf1, 0x44, 0x24, 0xd5, 0x56, 0x46, 0xf0,
+	0xdd, 0x41, 0xf5, 0xf8, 0xc5, 0xd3, 0xd8, 0x0d, 0xc0, 0x18, 0x64, 0x87, 0xc6, 0x1e, 0x38, 0x11,
+	0x49, 0x75, 0x2d, 0x43, 0x5d, 0xd6, 0x90, 0x3f, 0x0d, 0x1f, 0x68, 0x1d, 0xbb, 0x05, 0x32, 0xe2,
+	0x12, 0xe6, 0x6c, 0xa4, 0x2f, 0x7f, 0xfd, 0xf4, 0x9f, 0x7f, 0x0f, 0xf4, 0x59, 0x39, 0xb3, 0x5c,
+	0xd0, 0x77, 0x40, 0x4f, 0xcd, 0x74, 0xc4, 0xb3, 0x1f, 0xa1, 0xfc, 0x4e, 0x20, 0x7b, 0x5f, 0x54,
+	0xe7, 0x63, 0xeb, 0xb4, 0xc1, 0xf3, 0x93, 0x08, 0x6c, 0x0f, 0x54, 0xe9, 0x1e, 0x2d, 0x4f, 0x05,
+	0xa9, 0xae, 0x1e, 0x6e, 0xea, 0xb9, 0xad, 0xff, 0xce, 0x93, 0x31, 0x64, 0x1c, 0x8a, 0xf6, 0xd8,
+	0x8d, 0xe8, 0x2c, 0x27, 0x82, 0x54, 0x5b, 0xb9, 0x22, 0xdb, 0x43, 0xd1, 0x87, 0xfd, 0x2d, 0xcf,
+	0xc2, 0x04, 0xf0, 0x13, 0xe2, 0x49, 0x72, 0x8d, 0xd8, 0x1d, 0x14, 0xa8, 0x9c, 0x19, 0xd0, 0x72,
+	0x1a, 0xac, 0x8d, 0xb7, 0xc2, 0x21, 0x72, 0x4d, 0xfc, 0x82, 0x9f, 0x8d, 0x72, 0x96, 0xe7, 0x82,
+	0xf8, 0x05, 0x03, 0xb4, 0x79, 0xf8, 0xf9, 0xc7, 0x9f, 0x01, 0x00, 0x62, 0xc8, 0x02, 0xc8, 0x87,
+	0x01, 0x00, 0x00,
+}
@@ -0,0 +1,132 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: transfer.proto
+
+package pb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type Chunk struct {
+	Transfer string `protobuf:"bytes,1,opt,name=transfer" json:"transfer,omitempty"`
+	Index    uint64 `protobuf:"varint,2,opt,name=index" json:"index,omitempty"`
+	Data     []byte `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	Checksum uint32 `protobuf:"varint,4,opt,name=checksum" json:"checksum,omitempty"`
+	Last     bool   `protobuf:"varint,5,opt,name=last" json:"last,omitempty"`
+	Size     uint64 `protobuf:"varint,6,opt,name=size" json:"size,omitempty"`
+	Digest   []byte `protobuf:"bytes,7,opt,name=digest,proto3" json:"digest,omitempty"`
+	Ack      bool   `protobuf:"varint,8,opt,name=ack" json:"ack,omitempty"`
+	Next     uint64 `protobuf:"varint,9,opt,name=next" json:"next,omitempty"`
+	Complete bool   `protobuf:"varint,10,opt,name=complete" json:"complete,omitempty"`
+	Error    string `protobuf:"bytes,11,opt,name=error" json:"error,omitempty"`
+}
+
+func (m *Chunk) Reset()                    { *m = Chunk{} }
+func (m *Chunk) String() string            { return proto.CompactTextString(m) }
+func (*Chunk) ProtoMessage()               {}
+func (*Chunk) Descriptor() ([]byte, []int) { return fileDescriptor8, []int{0} }
+
+func (m *Chunk) GetTransfer() string {
+	if m != nil {
+		return m.Transfer
+	}
+	return ""
+}
+
+func (m *Chunk) GetIndex() uint64 {
+	if m != nil {
+		return m.Index
+	}
+	return 0
+}
+
+func (m *Chunk) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *Chunk) GetChecksum() uint32 {
+	if m != nil {
+		return m.Checksum
+	}
+	return 0
+}
+
+func (m *Chunk) GetLast() bool {
+	if m != nil {
+		return m.Last
+	}
+	return false
+}
+
+func (m *Chunk) GetSize() uint64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
+}
+
+func (m *Chunk) GetDigest() []byte {
+	if m != nil {
+		return m.Digest
+	}
+	return nil
+}
+
+func (m *Chunk) GetAck() bool {
+	if m != nil {
+		return m.Ack
+	}
+	return false
+}
+
+func (m *Chunk) GetNext() uint64 {
+	if m != nil {
+		return m.Next
+	}
+	return 0
+}
+
+func (m *Chunk) GetComplete() bool {
+	if m != nil {
+		return m.Complete
+	}
+	return false
+}
+
+func (m *Chunk) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*Chunk)(nil), "pb.Chunk")
+}
+
+func init() { proto.RegisterFile("transfer.proto", fileDescriptor8) }
+
+var fileDescriptor8 = []byte{
+	// 208 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x3c, 0x90, 0x4d, 0x4e, 0x86, 0x30,
+	0x10, 0x86, 0x53, 0x3e, 0x40, 0xbe, 0xf1, 0x27, 0xa6, 0x31, 0x66, 0xe2, 0xaa, 0x71, 0xd5, 0x95,
+	0x1b, 0x8f, 0xe0, 0x0d, 0x7a, 0x83, 0x02, 0xa3, 0x10, 0xa0, 0x25, 0x6d, 0x49, 0x88, 0x3b, 0x6f,
+	0x6e, 0x3a, 0x28, 0xbb, 0xe7, 0x69, 0xe7, 0x7d, 0xd3, 0x29, 0x3c, 0xa4, 0x60, 0x5d, 0xfc, 0xa4,
+	0xf0, 0xb6, 0x06, 0x9f, 0xbc, 0x2c, 0xd6, 0xf6, 0xf5, 0xa7, 0x80, 0xea, 0x63, 0xd8, 0xdc, 0x24,
+	0x5f, 0xa0, 0xf9, 0xbf, 0x47, 0xa1, 0x84, 0xbe, 0x9a, 0xd3, 0xe5, 0x13, 0x54, 0xa3, 0xeb, 0x69,
+	0xc7, 0x42, 0x09, 0x5d, 0x9a, 0x43, 0xa4, 0x84, 0xb2, 0xb7, 0xc9, 0xe2, 0x45, 0x09, 0x7d, 0x67,
+	0x98, 0x73, 0x4b, 0x37, 0x50, 0x37, 0xc5, 0x6d, 0xc1, 0x52, 0x09, 0x7d, 0x6f, 0x4e, 0xcf, 0xf3,
+	0xb3, 0x8d, 0x09, 0x2b, 0x25, 0x74, 0x63, 0x98, 0xf3, 0x59, 0x1c, 0xbf, 0x09, 0x6b, 0x2e, 0x66,
+	0x96, 0xcf, 0x50, 0xf7, 0xe3, 0x17, 0xc5, 0x84, 0x37, 0xdc, 0xfc, 0x67, 0xf2, 0x11, 0x2e, 0xb6,
+	0x9b, 0xb0, 0xe1, 0x78, 0xc6, 0x9c, 0x76, 0xb4, 0x27, 0xbc, 0x1e, 0xe9, 0xcc, 0xfc, 0x02, 0xbf,
+	0xac, 0x33, 0x25, 0x42, 0xe0, 0xd1, 0xd3, 0xf3, 0x1e, 0x14, 0x82, 0x0f, 0x78, 0xcb, 0x0b, 0x1e,
+	0xd2, 0xd6, 0xfc, 0x1d, 0xef, 0xbf, 0x03, 0x00, 0x46, 0x25, 0xad, 0xe4, 0x20, 0x01, 0x00, 0x00,
+}
@@ -0,0 +1,73 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: transport.proto
+
+package pb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type Handshake struct {
+	Metadata []*Metadata `protobuf:"bytes,1,rep,name=metadata" json:"metadata,omitempty"`
+}
+
+func (m *Handshake) Reset()                    { *m = Handshake{} }
+func (m *Handshake) String() string            { return proto.CompactTextString(m) }
+func (*Handshake) ProtoMessage()               {}
+func (*Handshake) Descriptor() ([]byte, []int) { return fileDescriptor9, []int{0} }
+
+func (m *Handshake) GetMetadata() []*Metadata {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+type Metadata struct {
+	Key    string   `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	Values []string `protobuf:"bytes,2,rep,name=values" json:"values,omitempty"`
+}
+
+func (m *Metadata) Reset()                    { *m = Metadata{} }
+func (m *Metadata) String() string            { return proto.CompactTextString(m) }
+func (*Metadata) ProtoMessage()               {}
+func (*Metadata) Descriptor() ([]byte, []int) { return fileDescriptor9, []int{1} }
+
+func (m *Metadata) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *Metadata) GetValues() []string {
+	if m != nil {
+		return m.Values
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Handshake)(nil), "pb.Handshake")
+	proto.RegisterType((*Metadata)(nil), "pb.Metadata")
+}
+
+func init() { proto.RegisterFile("transport.proto", fileDescriptor9) }
+
+var fileDescriptor9 = []byte{
+	// 130 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x2f, 0x29, 0x4a, 0xcc,
+	0x2b, 0x2e, 0xc8, 0x2f, 0x2a, 0xd1, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x2a, 0x48, 0x52,
+	0x32, 0xe5, 0xe2, 0xf4, 0x48, 0xcc, 0x4b, 0x29, 0xce, 0x48, 0xcc, 0x4e, 0x15, 0xd2, 0xe0, 0xe2,
+	0xc8, 0x4d, 0x2d, 0x49, 0x4c, 0x49, 0x2c, 0x49, 0x94, 0x60, 0x54, 0x60, 0xd6, 0xe0, 0x36, 0xe2,
+	0xd1, 0x2b, 0x48, 0xd2, 0xf3, 0x85, 0x8a, 0x05, 0xc1, 0x65, 0x95, 0x4c, 0xb8, 0x38, 0x60, 0xa2,
+	0x42, 0x02, 0x5c, 0xcc, 0xd9, 0xa9, 0x95, 0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0x9c, 0x41, 0x20, 0xa6,
+	0x90, 0x18, 0x17, 0x5b, 0x59, 0x62, 0x4e, 0x69, 0x6a, 0xb1, 0x04, 0x93, 0x02, 0xb3, 0x06, 0x67,
+	0x10, 0x94, 0x97, 0xc4, 0x06, 0xb6, 0xd7, 0x18, 0x30, 0x00, 0x7f, 0x09, 0xe5, 0x51, 0x8a, 0x00,
+	0x00, 0x00,
+}
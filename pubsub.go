@@ -0,0 +1,208 @@
+package livenet
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+// topics maintains the local subscribers of each topic as well as the topics
+// that remote peers are interested in. Local subscriptions can be modified by
+// any thread, but the interests of remote peers are only accessed from the
+// event loop.
+type topics struct {
+	sync.RWMutex
+	subscribers map[string]*listeners      // local callbacks by topic
+	interests   map[string]map[string]bool // remote topics by peer name
+}
+
+//===========================================================================
+// Server Publish/Subscribe API
+//===========================================================================
+
+// Subscribe registers a callback for messages published to the topic by any
+// peer on the network. Callbacks receive a TopicEvent whose source is the
+// name of the publishing peer and whose value is the *pb.Publication. The
+// first subscription to a topic is propagated to all peers so that they
+// begin to forward publications on it to this server.
+//
+// The returned ID can be passed to Unsubscribe to remove the callback.
+func (s *Server) Subscribe(topic string, callback Callback) ListenerID {
+	s.topics.Lock()
+	if s.topics.subscribers == nil {
+		s.topics.subscribers = make(map[string]*listeners)
+	}
+
+	subscribers, ok := s.topics.subscribers[topic]
+	if !ok {
+		subscribers = new(listeners)
+		s.topics.subscribers[topic] = subscribers
+	}
+
+	id := subscribers.add(TopicEvent, callback)
+	s.topics.Unlock()
+
+	// Notify the remote peers of the new topic; if the server is not listening
+	// the subscriptions will be sent when the remotes connect.
+	if !ok {
+		s.Dispatch(&event{etype: SubscriptionEvent, source: nil, value: topic})
+	}
+	return id
+}
+
+// Unsubscribe removes the callback registered to the topic with the specified
+// ID, returning false if no such callback was registered. When the last
+// callback is removed from a topic, remote peers stop forwarding it.
+func (s *Server) Unsubscribe(topic string, id ListenerID) bool {
+	s.topics.Lock()
+	subscribers, ok := s.topics.subscribers[topic]
+	if !ok || !subscribers.remove(TopicEvent, id) {
+		s.topics.Unlock()
+		return false
+	}
+
+	if subscribers.count(TopicEvent) > 0 {
+		s.topics.Unlock()
+		return true
+	}
+
+	delete(s.topics.subscribers, topic)
+	s.topics.Unlock()
+
+	s.Dispatch(&event{etype: SubscriptionEvent, source: nil, value: topic})
+	return true
+}
+
+// Publish sends the payload to every peer that has subscribers to the topic,
+// relaying it to peers that are not neighbors in the topology. Publications
+// are not delivered to the local subscribers. The send is handled
+// asynchronously by the event loop, so an error is only returned if the server
+// is not currently listening.
+func (s *Server) Publish(topic string, payload []byte) error {
+	return s.PublishContext(context.Background(), topic, payload)
+}
+
+// PublishContext publishes the payload to the topic like Publish. If the block
+// overflow policy is configured, it first waits until the send queues of all
+// remotes have room, returning an error if the context is done or the server
+// stops.
+func (s *Server) PublishContext(ctx context.Context, topic string, payload []byte) error {
+	if topic == "" {
+		return errors.New("cannot publish to an empty topic")
+	}
+
+	pub := &pb.Publication{Topic: topic, Payload: payload}
+	return s.dispatchBlocking(ctx, &event{etype: PublishEvent, source: nil, value: pub}, s.remotes...)
+}
+
+// Topics returns the sorted names of the topics with local subscribers.
+func (s *Server) Topics() []string {
+	s.topics.RLock()
+	defer s.topics.RUnlock()
+
+	names := make([]string, 0, len(s.topics.subscribers))
+	for topic := range s.topics.subscribers {
+		names = append(names, topic)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+//===========================================================================
+// Publish/Subscribe Event Handlers
+//===========================================================================
+
+// Broadcast the local subscriptions to all peers, relaying them to the peers
+// that are not neighbors.
+func (s *Server) onSubscriptionEvent(e Event) error {
+	trace("subscription to %s changed", e.Value())
+
+	msg, err := s.subscriptions()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range s.peerNames() {
+		if err := s.sendTo(name, msg.Type, msg.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Send the publication only to the peers that are interested in the topic.
+func (s *Server) onPublishEvent(e Event) error {
+	defer messageQueued(e)
+	pub := e.Value().(*pb.Publication)
+	data, err := proto.Marshal(pub)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range s.peerNames() {
+		if !s.topics.interests[name][pub.Topic] {
+			continue
+		}
+
+		if err := s.sendTo(name, pb.MessageType_PUBLISH, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Record the topics the sender is interested in and reply with the local
+// subscriptions so that the sender learns the interests of this server.
+func (s *Server) onSubscribe(in *pb.Envelope) (*pb.Envelope, error) {
+	subs := new(pb.Subscriptions)
+	if err := proto.Unmarshal(in.Message, subs); err != nil {
+		return nil, err
+	}
+
+	if s.topics.interests == nil {
+		s.topics.interests = make(map[string]map[string]bool)
+	}
+
+	interests := make(map[string]bool, len(subs.Topics))
+	for _, topic := range subs.Topics {
+		interests[topic] = true
+	}
+	s.topics.interests[in.Sender] = interests
+	debug("%s is subscribed to %d topics", in.Sender, len(interests))
+
+	return s.subscriptions()
+}
+
+// Deliver a publication to the local subscribers of its topic.
+func (s *Server) onPublish(in *pb.Envelope) (*pb.Envelope, error) {
+	pub := new(pb.Publication)
+	if err := proto.Unmarshal(in.Message, pub); err != nil {
+		return nil, err
+	}
+
+	s.topics.RLock()
+	subscribers, ok := s.topics.subscribers[pub.Topic]
+	s.topics.RUnlock()
+
+	if ok {
+		if err := subscribers.call(&event{etype: TopicEvent, source: in.Sender, value: pub}); err != nil {
+			return nil, callbackError{err}
+		}
+	}
+
+	return pb.Wrap(s.Name, pb.MessageType_HEARTBEAT, nil), nil
+}
+
+// Create a subscribe message with all topics that have local subscribers.
+func (s *Server) subscriptions() (*pb.Envelope, error) {
+	data, err := proto.Marshal(&pb.Subscriptions{Topics: s.Topics()})
+	if err != nil {
+		return nil, err
+	}
+	return pb.Wrap(s.Name, pb.MessageType_SUBSCRIBE, data), nil
+}
@@ -0,0 +1,284 @@
+package livenet
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+)
+
+// DefaultSendQueue is the number of messages that can be queued in each lane
+// to a remote before the overflow policy is applied.
+const DefaultSendQueue = 256
+
+// Overflow policies applied when a message is sent to a remote with a full
+// send queue. Messages are queued from the event loop, which never blocks, so
+// the block policy makes the application wait in Send and Publish until the
+// data lanes have room; the control lane discards its oldest message instead.
+const (
+	OverflowDropOldest = "drop-oldest" // discard the oldest queued message (default)
+	OverflowDropNewest = "drop-newest" // discard the message being sent
+	OverflowBlock      = "block"       // wait in Send and Publish until the queue has room
+)
+
+// Lanes of the send queues of a remote in priority order. Messages in the
+// control lane are always sent before messages in the data lane so that
+// heartbeats and protocol messages are not delayed by application payloads.
+const (
+	LaneControl Lane = iota
+	LaneData
+	numLanes
+)
+
+var laneStrings = [...]string{"control", "data"}
+
+// Lane is the priority of a message sent to a remote.
+type Lane uint8
+
+// String returns the name of the lane.
+func (l Lane) String() string {
+	if int(l) < len(laneStrings) {
+		return laneStrings[l]
+	}
+	return laneStrings[LaneData]
+}
+
+// Returns the lane that messages of the type are sent in; application
+// payloads and state transfers are data and all other messages are control.
+func laneOf(mtype pb.MessageType) Lane {
+	switch mtype {
+	case pb.MessageType_PUBLISH, pb.MessageType_DIRECT, pb.MessageType_SYNC:
+		return LaneData
+	default:
+		return LaneControl
+	}
+}
+
+// QueueMetrics describes a lane of the outbound queue of a remote.
+type QueueMetrics struct {
+	Lane       Lane          // priority of the messages in the queue
+	Depth      int           // number of messages currently queued
+	Capacity   int           // maximum number of messages that can be queued
+	Peak       int           // largest number of messages queued at once
+	Overflow   uint64        // number of messages discarded because the queue was full
+	Sent       uint64        // number of messages taken from the queue to be sent
+	Latency    time.Duration // mean time from queuing a message until it was sent
+	MaxLatency time.Duration // longest time from queuing a message until it was sent
+}
+
+func (m QueueMetrics) String() string {
+	return fmt.Sprintf(
+		"%s queue %d/%d (peak %d, %d overflowed), %s mean latency (%s max)",
+		m.Lane, m.Depth, m.Capacity, m.Peak, m.Overflow, m.Latency, m.MaxLatency,
+	)
+}
+
+// queued is a message waiting in a send queue.
+type queued struct {
+	msg    *pb.Envelope
+	queued time.Time
+}
+
+// sendQueue is a bounded queue of messages to a remote that is drained by a
+// goroutine of the remote so that a slow or unreachable peer does not block
+// the event loop or the messages sent to other peers.
+type sendQueue struct {
+	lane     Lane
+	messages chan queued
+	capacity int
+	policy   string
+	mu       sync.Mutex
+	room     chan struct{} // closed when a message is sent while the queue is awaited
+	peak     int64
+	overflow uint64
+	sent     uint64
+	waited   int64 // total nanoseconds from queuing messages until they were sent
+	longest  int64 // longest nanoseconds from queuing a message until it was sent
+}
+
+// Create a lane with the configured capacity and overflow policy. The data
+// lane of the block policy has room for as many messages again as its capacity,
+// since the senders that waited for room may be queued at the same time; if
+// that is exceeded, the oldest messages are discarded.
+func newSendQueue(lane Lane, c *Config) *sendQueue {
+	policy, _ := c.GetQueueOverflow()
+	capacity, size := c.GetSendQueue(), c.GetSendQueue()
+	if policy == OverflowBlock {
+		if lane == LaneControl {
+			policy = OverflowDropOldest
+		} else {
+			size *= 2
+		}
+	}
+
+	return &sendQueue{
+		lane:     lane,
+		messages: make(chan queued, size),
+		capacity: capacity,
+		policy:   policy,
+	}
+}
+
+// Wait until the queue has fewer messages than its capacity, returning an
+// error if the context is done or the stop channel is closed first.
+func (q *sendQueue) wait(ctx context.Context, stop <-chan struct{}) error {
+	for {
+		q.mu.Lock()
+		if len(q.messages) < q.capacity {
+			q.mu.Unlock()
+			return nil
+		}
+
+		if q.room == nil {
+			q.room = make(chan struct{})
+		}
+		room := q.room
+		q.mu.Unlock()
+
+		select {
+		case <-room:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-stop:
+			return errStopped
+		}
+	}
+}
+
+// Add the message to the queue, applying the overflow policy if it is full.
+// Returns the messages that were discarded.
+func (q *sendQueue) push(msg *pb.Envelope) (discarded []*pb.Envelope) {
+	item := queued{msg: msg, queued: time.Now()}
+
+	switch q.policy {
+	case OverflowDropNewest:
+		select {
+		case q.messages <- item:
+		default:
+			atomic.AddUint64(&q.overflow, 1)
+			return []*pb.Envelope{msg}
+		}
+	default:
+		for {
+			select {
+			case q.messages <- item:
+				q.mark()
+				return discarded
+			default:
+			}
+
+			// Discard the oldest message, unless it was drained concurrently
+			select {
+			case oldest := <-q.messages:
+				atomic.AddUint64(&q.overflow, 1)
+				discarded = append(discarded, oldest.msg)
+			default:
+			}
+		}
+	}
+	q.mark()
+	return nil
+}
+
+// Record the high-water mark of the queue.
+func (q *sendQueue) mark() {
+	depth := int64(len(q.messages))
+	for {
+		peak := atomic.LoadInt64(&q.peak)
+		if depth <= peak || atomic.CompareAndSwapInt64(&q.peak, peak, depth) {
+			return
+		}
+	}
+}
+
+// Record the time from queuing the message until it was sent and wake the
+// senders waiting for room in the queue.
+func (q *sendQueue) done(item queued) {
+	q.mu.Lock()
+	if q.room != nil {
+		close(q.room)
+		q.room = nil
+	}
+	q.mu.Unlock()
+
+	wait := int64(time.Since(item.queued))
+	atomic.AddUint64(&q.sent, 1)
+	atomic.AddInt64(&q.waited, wait)
+	for {
+		longest := atomic.LoadInt64(&q.longest)
+		if wait <= longest || atomic.CompareAndSwapInt64(&q.longest, longest, wait) {
+			return
+		}
+	}
+}
+
+// Returns the current metrics of the queue.
+func (q *sendQueue) metrics() QueueMetrics {
+	m := QueueMetrics{
+		Lane:       q.lane,
+		Depth:      len(q.messages),
+		Capacity:   q.capacity,
+		Peak:       int(atomic.LoadInt64(&q.peak)),
+		Overflow:   atomic.LoadUint64(&q.overflow),
+		Sent:       atomic.LoadUint64(&q.sent),
+		MaxLatency: time.Duration(atomic.LoadInt64(&q.longest)),
+	}
+
+	if m.Sent > 0 {
+		m.Latency = time.Duration(atomic.LoadInt64(&q.waited) / int64(m.Sent))
+	}
+	return m
+}
+
+// Dispatch the event of a message sent by the application. If the block
+// overflow policy is configured, waits until the data lanes of the remotes
+// have room before dispatching the event and until the event loop has queued
+// the message after, so that each sender has at most one message on its way to
+// the queues. Does not wait if the server is not listening, since the event
+// cannot be dispatched anyway.
+func (s *Server) dispatchBlocking(ctx context.Context, e *event, remotes ...*Remote) error {
+	_, done := s.channels()
+	if policy, _ := s.config.GetQueueOverflow(); policy != OverflowBlock || done == nil {
+		return s.Dispatch(e)
+	}
+
+	for _, remote := range remotes {
+		if err := remote.lanes[LaneData].wait(ctx, done); err != nil {
+			return err
+		}
+	}
+
+	queued := make(chan struct{})
+	e.source = queued
+	if err := s.Dispatch(e); err != nil {
+		return err
+	}
+
+	select {
+	case <-queued:
+		return nil
+	case <-done:
+		return errStopped
+	}
+}
+
+// Signal the sender waiting in dispatchBlocking that the message of the event
+// has been queued.
+func messageQueued(e Event) {
+	if queued, ok := e.Source().(chan struct{}); ok {
+		close(queued)
+	}
+}
+
+// Queues returns the metrics of each lane of the send queue of every remote
+// by name.
+func (s *Server) Queues() map[string][]QueueMetrics {
+	queues := make(map[string][]QueueMetrics, len(s.remotes))
+	for _, remote := range s.remotes {
+		queues[remote.Name] = remote.Queues()
+	}
+	return queues
+}
@@ -0,0 +1,226 @@
+package livenet
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+)
+
+func TestQueueOverflowPolicies(t *testing.T) {
+	for _, policy := range []string{"", OverflowDropOldest, OverflowDropNewest, OverflowBlock} {
+		if _, err := (&Config{QueueOverflow: policy}).GetQueueOverflow(); err != nil {
+			t.Errorf("could not use overflow policy %q: %s", policy, err)
+		}
+	}
+
+	if _, err := (&Config{QueueOverflow: "wait"}).GetQueueOverflow(); err == nil {
+		t.Error("expected an unknown overflow policy to be rejected")
+	}
+}
+
+func TestBlockedSendWaitsForRoom(t *testing.T) {
+	config := &Config{SendQueue: 1, QueueOverflow: OverflowBlock}
+	q := newSendQueue(LaneData, config)
+
+	// Pushing from the event loop never blocks or discards, even beyond capacity
+	q.push(pb.Wrap("a", pb.MessageType_DIRECT, nil))
+	q.push(pb.Wrap("a", pb.MessageType_DIRECT, nil))
+	if m := q.metrics(); m.Depth != 2 || m.Capacity != 1 || m.Overflow != 0 {
+		t.Fatalf("unexpected metrics of the blocked queue: %s", m)
+	}
+
+	stop := make(chan struct{})
+	waiting := make(chan error, 1)
+	go func() { waiting <- q.wait(context.Background(), stop) }()
+
+	// The sender waits until the queue has drained below its capacity
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-waiting:
+			t.Fatalf("sender did not wait with %d queued messages: %v", len(q.messages), err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		q.done(<-q.messages)
+	}
+
+	select {
+	case err := <-waiting:
+		if err != nil {
+			t.Errorf("expected the sender to be released, got %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("sender was not released when the queue drained")
+	}
+
+	// The sender gives up when its context is done or the server stops
+	q.push(pb.Wrap("a", pb.MessageType_DIRECT, nil))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := q.wait(ctx, stop); err != context.DeadlineExceeded {
+		t.Errorf("expected the sender to give up after its deadline, got %v", err)
+	}
+
+	close(stop)
+	if err := q.wait(context.Background(), stop); err != errStopped {
+		t.Errorf("expected the sender to give up when the server stops, got %v", err)
+	}
+
+	// Control messages are never blocked and discard the oldest message
+	control := newSendQueue(LaneControl, config)
+	control.push(pb.Wrap("a", pb.MessageType_HEARTBEAT, nil))
+	if discarded := control.push(pb.Wrap("a", pb.MessageType_HEARTBEAT, nil)); len(discarded) != 1 {
+		t.Errorf("expected the oldest heartbeat to be discarded, got %d", len(discarded))
+	}
+}
+
+func TestSendContextBlocksOnSlowPeer(t *testing.T) {
+	configs := testConfigs(2)
+	configs[0].SendQueue = 1
+	configs[0].QueueOverflow = OverflowBlock
+	servers := testCluster(t, configs)
+	testConnected(t, servers)
+	a, log := servers[0], newDirectLog(servers[1])
+
+	// Every message to b is held back, so its queue fills up
+	if err := a.InjectFaults("b", LinkFaults{Delay: "100ms"}); err != nil {
+		t.Fatalf("could not inject faults: %s", err)
+	}
+
+	sent := 0
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		err := a.SendContext(ctx, "b", []byte("blocked"))
+		cancel()
+
+		if err == context.DeadlineExceeded {
+			break
+		}
+
+		if err != nil {
+			t.Fatalf("could not send message: %s", err)
+		}
+
+		if sent++; sent > 10 {
+			t.Fatal("sends were not blocked by the full queue")
+		}
+	}
+
+	// None of the messages that were sent are discarded
+	a.ClearFaults("b")
+	eventually(t, 3*time.Second, func() bool { return log.count("blocked") == sent }, "expected %d messages to be delivered", sent)
+	if overflow := a.remote("b").Queues()[LaneData].Overflow; overflow != 0 {
+		t.Errorf("expected no messages to overflow, got %d", overflow)
+	}
+}
+
+func TestControlSentBeforeData(t *testing.T) {
+	server, err := New(testConfigs(2)[0])
+	if err != nil {
+		t.Fatalf("could not create server: %s", err)
+	}
+	remote := server.remote("b")
+
+	// Returns the types of the messages in the order that they are drained
+	drain := func(n int) (types []pb.MessageType) {
+		for i := 0; i < n; i++ {
+			item, lane, ok := remote.next(nil, time.After(time.Second))
+			if !ok {
+				t.Fatalf("no message queued after draining %d messages", i)
+			}
+			lane.done(item)
+			types = append(types, item.msg.Type)
+		}
+		return types
+	}
+
+	// A backlog of data is queued before the control messages
+	for i := 0; i < 10; i++ {
+		remote.Send(pb.Wrap("a", pb.MessageType_DIRECT, nil))
+		remote.Send(pb.Wrap("a", pb.MessageType_PUBLISH, nil))
+	}
+
+	control := []pb.MessageType{pb.MessageType_HEARTBEAT, pb.MessageType_LOCK, pb.MessageType_BARRIER, pb.MessageType_SUBSCRIBE}
+	for _, mtype := range control {
+		remote.Send(pb.Wrap("a", mtype, nil))
+	}
+
+	if types := drain(len(control)); fmt.Sprint(types) != fmt.Sprint(control) {
+		t.Errorf("expected the control messages to be sent before the data, got %v", types)
+	}
+
+	// The backlog of data is sent in the order it was queued
+	if types := drain(5); fmt.Sprint(types) != "[DIRECT PUBLISH DIRECT PUBLISH DIRECT]" {
+		t.Errorf("expected the data to be sent in order, got %v", types)
+	}
+
+	// Control messages queued behind a partially sent backlog are sent next
+	remote.Send(pb.Wrap("a", pb.MessageType_LOCK, nil))
+	remote.Send(pb.Wrap("a", pb.MessageType_HEARTBEAT, nil))
+	if types := drain(3); fmt.Sprint(types) != "[LOCK HEARTBEAT PUBLISH]" {
+		t.Errorf("expected the control messages to be sent before the rest of the data, got %v", types)
+	}
+
+	for _, m := range remote.Queues() {
+		if m.Lane == LaneControl && m.Depth != 0 || m.Lane == LaneData && m.Depth != 14 {
+			t.Errorf("unexpected depth of the %s lane: %s", m.Lane, m)
+		}
+	}
+}
+
+func TestDiscardedHeartbeatResendsReplicas(t *testing.T) {
+	for _, policy := range []string{OverflowDropOldest, OverflowDropNewest} {
+		configs := testConfigs(2)
+		configs[0].SendQueue = 1
+		configs[0].QueueOverflow = policy
+
+		server, err := New(configs[0])
+		if err != nil {
+			t.Fatalf("could not create server: %s", err)
+		}
+		remote := server.remote("b")
+
+		// Data messages that overflow the queue do not require a resync
+		remote.Send(pb.Wrap("a", pb.MessageType_DIRECT, nil))
+		remote.Send(pb.Wrap("a", pb.MessageType_DIRECT, nil))
+		if remote.discardedHeartbeat() {
+			t.Errorf("%s: discarded direct message required a resync", policy)
+		}
+
+		remote.Send(pb.Wrap("a", pb.MessageType_HEARTBEAT, nil))
+		remote.Send(pb.Wrap("a", pb.MessageType_HEARTBEAT, nil))
+		if !remote.discardedHeartbeat() {
+			t.Errorf("%s: discarded heartbeat did not require a resync", policy)
+		}
+
+		if remote.discardedHeartbeat() {
+			t.Errorf("%s: resync was not reset", policy)
+		}
+	}
+}
+
+func TestMessageCountsConcurrent(t *testing.T) {
+	counts := new(MessageCounts)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				counts.Sent()
+				counts.Recv()
+				counts.Bytes(10, 5)
+				_ = counts.String()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if counts.RecvR() != 1.0 || counts.WireR() != 0.5 {
+		t.Errorf("unexpected counts: %s", counts)
+	}
+}
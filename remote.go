@@ -1,13 +1,13 @@
 package livenet
 
 import (
-	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/bbengfort/livenet/pb"
 	"github.com/bbengfort/x/peers"
-	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 // Remote implements a streaming connection to a remote peer on the network.
@@ -15,73 +15,251 @@ type Remote struct {
 	sync.RWMutex
 	peers.Peer
 
-	actor  Dispatcher            // the listener to dispatch events to
-	conn   *grpc.ClientConn      // grpc dial connection to the remote
-	client pb.LiveNetClient      // rpc client specified by protobuf
-	stream pb.LiveNet_PostClient // message stream to send on
-	online bool                  // if the client is connected or not
-	counts *MessageCounts        // keep track of message request traffic
+	actor     Dispatcher     // the listener to dispatch events to
+	config    *Config        // the configuration of the network
+	transport Transport      // creates the stream to the remote
+	stream    ClientStream   // message stream to send on
+	codec     Compressor     // compressor negotiated for the stream, nil if none
+	batch     bool           // if the remote unpacks batches of envelopes
+	keys      *keyring       // keys to sign and verify envelopes
+	lanes     []*sendQueue   // messages waiting to be sent to the remote by priority
+	done      chan struct{}  // stops the goroutine draining the queue
+	online    bool           // if the client is connected or not
+	counts    *MessageCounts // keep track of message request traffic
+	outbox    *outbox        // undelivered messages held while offline, nil if disabled
+	breaker   *breaker       // limits attempts to reconnect to the remote
+	faults    *faults        // faults injected on the link to the remote
+	accepts   bool           // if requests are sent on the stream created by the remote
+	shared    ServerStream   // server side of the stream created by the remote, if attached
+	resync    uint32         // set when a heartbeat to the remote is discarded, accessed atomically
+
+	transfers map[string]chan *pb.Chunk // acknowledgments of chunked transfers by id
 }
 
 // NewRemote creates a new remote associated with the actor
-func NewRemote(p peers.Peer, a Dispatcher) *Remote {
-	return &Remote{Peer: p, actor: a, counts: new(MessageCounts)}
+func NewRemote(p peers.Peer, a Dispatcher, c *Config) *Remote {
+	r := &Remote{Peer: p, actor: a, config: c, counts: new(MessageCounts), breaker: newBreaker(p.Name, c)}
+	r.accepts = accepts(p, c)
+	r.lanes = make([]*sendQueue, numLanes)
+	for lane := range r.lanes {
+		r.lanes[lane] = newSendQueue(Lane(lane), c)
+	}
+	return r
 }
 
-// Send a message to the remote
+// Send a message to the remote by adding it to the send queue of the lane for
+// its type, which is drained by the remote once the server is listening. If
+// the lane is full the configured overflow policy is applied.
 func (r *Remote) Send(msg *pb.Envelope) error {
+	for _, discarded := range r.lanes[laneOf(msg.Type)].push(msg) {
+		// The replica deltas piggybacked on a discarded heartbeat are lost
+		if discarded.Type == pb.MessageType_HEARTBEAT {
+			atomic.StoreUint32(&r.resync, 1)
+		}
+	}
+	return nil
+}
+
+// Returns true if a heartbeat to the remote has been discarded since the last
+// call, in which case the remote must be sent the full state of the replicas.
+func (r *Remote) discardedHeartbeat() bool {
+	return atomic.SwapUint32(&r.resync, 0) == 1
+}
+
+// Queues returns the metrics of each lane of the send queue of the remote.
+func (r *Remote) Queues() []QueueMetrics {
+	metrics := make([]QueueMetrics, 0, len(r.lanes))
+	for _, lane := range r.lanes {
+		metrics = append(metrics, lane.metrics())
+	}
+	return metrics
+}
+
+// Start the goroutine that sends the queued messages to the remote.
+func (r *Remote) start() {
+	r.done = make(chan struct{})
+	go r.drain(r.done)
+}
+
+// Stop sending the queued messages to the remote and close the stream.
+func (r *Remote) stop() {
+	if r.done != nil {
+		close(r.done)
+		r.done = nil
+	}
+	r.close()
+}
+
+// Send the messages in the queue until stopped, sending all queued control
+// messages before each data message. If batching is enabled and the remote
+// unpacks batches, messages queued within the batch window are sent together.
+func (r *Remote) drain(done <-chan struct{}) {
+	window, _ := r.config.GetBatchWindow()
+	for {
+		item, lane, ok := r.next(done, nil)
+		if !ok {
+			return
+		}
+
+		if window > 0 && r.batching() {
+			items, lanes := r.gather(item, lane, done, window)
+			r.sendBatch(items)
+			for i, item := range items {
+				lanes[i].done(item)
+			}
+			continue
+		}
+
+		r.send(item.msg)
+		lane.done(item)
+	}
+}
+
+// Returns true if the remote advertised that it unpacks batches.
+func (r *Remote) batching() bool {
+	r.RLock()
+	defer r.RUnlock()
+	return r.batch
+}
+
+// Send a message on the stream to the remote, connecting if necessary.
+func (r *Remote) send(msg *pb.Envelope) {
 	// Count the number of send attempts
 	r.counts.Sent()
 
-	// TODO: how to reconcile the multiple threads trying to send/reconnect
-	// the stream with the listener that has better knowledge about the state
-	// of the stream? Right now I'm using RLocks to send on the stream.
+	// Messages are only sent by the drain goroutine, but the recv routine may
+	// close the stream concurrently so its state is protected by the lock.
 
 	// Does not reconnect if already online uses double-checked lock for safety
 	if err := r.connect(); err != nil {
 		// Go offline because of the error
-		caution("could not connect to %s: %s", r.Name, err)
-		r.close()
-		r.counts.Drop()
+		if err != errBackoff && err != errAwaiting && err != errPartitioned {
+			caution("could not connect to %s: %s", r.Name, err)
+			r.close()
+		}
+		r.hold(msg)
 
-		// Do not return the error, just stay offline
-		return nil
+		// Stay offline until the next message is sent
+		return
 	}
 
-	// However, at this point, the recv routine may be closing the connection!
-	if err := r.stream.Send(msg); err != nil {
-		// go offline because of the error
+	// Replay the messages held while offline before any new messages
+	if !r.replay() || !r.transmit(msg) {
+		// Stay offline until the next message is sent
+		r.hold(msg)
+	}
+}
+
+// Sign the envelope if it was created by the local host, compress it with the
+// compressor negotiated for the stream, and send it. Returns false and goes
+// offline if the stream failed.
+func (r *Remote) transmit(msg *pb.Envelope) bool {
+	r.RLock()
+	out, err := compress(r.keys.sign(msg), r.codec, r.config.GetCompressAbove())
+	stream := r.sender()
+	r.RUnlock()
+	if err != nil {
 		caution("dropped message to %s: %s", r.Name, err)
-		r.close()
 		r.counts.Drop()
+		return true
+	}
+	r.counts.Bytes(len(msg.Message), len(out.Message))
 
-		// Do not return the error, just stay offline
-		return nil
+	// However, at this point, the recv routine may have closed the connection!
+	if stream == nil {
+		return false
 	}
 
-	return nil
+	// Inject the faults of the link to the remote, which may drop, delay,
+	// duplicate, or corrupt the envelope.
+	for _, out := range r.faults.inject(r.Name, out) {
+		if err = stream.Send(out); err != nil {
+			// go offline because of the error
+			caution("could not send message to %s: %s", r.Name, err)
+			r.close()
+			return false
+		}
+	}
+	return true
 }
 
-// Recv messages from the remote and dispatch message received events
-func (r *Remote) recv() {
+// Recv messages from the remote on the stream and dispatch message received
+// events, signalling alive, if not nil, whenever a message is received.
+func (r *Remote) recv(stream ClientStream, alive chan<- struct{}) {
 	var (
 		msg *pb.Envelope
 		err error
 	)
 
+	// Wait for the server to select the compressor for the stream and to
+	// advertise whether it unpacks batches.
+	if md, err := stream.Header(); err == nil {
+		r.Lock()
+		r.codec = receivedEncoding(md)
+		r.batch = receivedBatch(md)
+		r.Unlock()
+	}
+
 	for {
-		if msg, err = r.stream.Recv(); err != nil {
+		if msg, err = stream.Recv(); err != nil {
 			// If we can no longer receive from the stream, close the conn
 			caution("stream to %s closed: %s", r.Name, err)
 			r.close()
 			return
 		}
 
-		// Dispatch the received message event
+		// Inject the faults of the link from the remote, then decode envelopes
+		// sent by hosts using older versions of the schema, decompress the
+		// payload of compressed envelopes, and unpack batches.
+		var replies []*pb.Envelope
+		limit := r.config.GetMaxPayload()
+		for _, received := range r.faults.inject(r.Name, msg) {
+			var unpacked []*pb.Envelope
+			if err = decodeEnvelope(received, limit); err == nil {
+				unpacked, err = unbatch(received, limit)
+			}
+			if err != nil {
+				break
+			}
+			replies = append(replies, unpacked...)
+		}
+
+		if err != nil {
+			caution("could not decode message from %s: %s", r.Name, err)
+			r.close()
+			return
+		}
+
 		r.counts.Recv()
-		r.actor.DispatchMessage(msg, r)
-	}
+		if len(replies) > 0 {
+			select {
+			case alive <- struct{}{}:
+			default:
+			}
+		}
 
+		for _, reply := range replies {
+			// Drop replies without a valid signature from their sender
+			if err = r.keys.verify(reply); err != nil {
+				r.actor.Dispatch(&event{etype: SignatureRejectedEvent, source: r, value: reply})
+				continue
+			}
+
+			// Reply to requests sent by the server if the stream is shared
+			if r.config.SharedStreams && !isReply(reply) {
+				r.respond(reply)
+				continue
+			}
+
+			// Deliver chunk acknowledgments to the transfers waiting for them
+			if r.onChunkAck(reply) {
+				continue
+			}
+
+			// Dispatch the received message event
+			r.actor.DispatchMessage(reply, r)
+		}
+	}
 }
 
 //===========================================================================
@@ -90,29 +268,72 @@ func (r *Remote) recv() {
 
 // Connect to the remote and create a stream message stream to it.
 func (r *Remote) connect() (err error) {
+	// Do not connect to the remote while it is partitioned
+	if r.faults.isPartitioned(r.Name) {
+		return errPartitioned
+	}
+
+	// Wait for the remote to create the stream if requests are sent on it
+	if r.accepts {
+		r.RLock()
+		defer r.RUnlock()
+		if r.shared == nil {
+			return errAwaiting
+		}
+		return nil
+	}
+
 	// Double-checked locking using RWMutex for safety
 	r.RLock()
 	if !r.isConnected() {
 		r.RUnlock()
+
+		// The peer event is dispatched once the lock is released
+		var online Event
+		defer func() { r.notify(online) }()
+
 		r.Lock()
 		defer r.Unlock()
 
+		// Do not redial the remote during the backoff or while the breaker
+		// is open, and record the outcome of the attempt to connect.
+		if !r.breaker.allow() {
+			return errBackoff
+		}
+
+		defer func() {
+			if err != nil {
+				r.breaker.failure()
+			} else {
+				r.breaker.success()
+			}
+		}()
+
 		addr := r.Endpoint(true)
 
-		if r.conn, err = grpc.Dial(addr, grpc.WithInsecure()); err != nil {
+		// Create the stream, sending the compressors the remote may select from,
+		// the token that authenticates the local host, and its name.
+		md := metadata.Join(acceptEncoding(r.config), clusterToken(r.config), peerName(r.config))
+		if r.stream, err = r.transport.Dial(addr, r.Name, md); err != nil {
 			return fmt.Errorf("could not connect to '%s': %s", addr, err)
 		}
 
-		r.client = pb.NewLiveNetClient(r.conn)
-		if r.stream, err = r.client.Post(context.Background()); err != nil {
-			return fmt.Errorf("could not create message stream to '%s': %s", addr, err)
+		// Go offline as soon as the gRPC connection fails or, on the other
+		// transports, when keepalive pings are not answered.
+		var alive chan struct{}
+		if stream, ok := r.stream.(*grpcStream); ok {
+			go r.watch(stream)
+		} else if interval, _ := r.config.GetKeepalive(); interval > 0 {
+			timeout, _ := r.config.GetKeepaliveTimeout()
+			alive = make(chan struct{}, 1)
+			go r.keepalive(r.stream, alive, interval, timeout)
 		}
 
 		// At this point we can say we are connected because the stream is good
-		r.toggleOnline(true)
+		online = r.toggleOnline(true)
 
 		// Run the go routine that handles replies and dispatches reply events
-		go r.recv()
+		go r.recv(r.stream, alive)
 		return nil
 
 	}
@@ -122,56 +343,82 @@ func (r *Remote) connect() (err error) {
 
 // Close the connection to the remote and cleanup the client
 func (r *Remote) close() (err error) {
-	// Protect the connection
+	// Protect the connection, dispatching the peer event once it is released
+	var offline Event
+	defer func() { r.notify(offline) }()
+
 	r.Lock()
 	defer r.Unlock()
 
 	// Ensure valid state after close
 	defer func() {
-		r.conn = nil
-		r.client = nil
 		r.stream = nil
-		r.toggleOnline(false)
+		r.codec = nil
+		r.batch = false
+		r.shared = nil
+		offline = r.toggleOnline(false)
 	}()
 
 	if r.stream != nil {
-		if err = r.stream.CloseSend(); err != nil {
+		if err = r.stream.Close(); err != nil {
 			return fmt.Errorf("could not close stream to %s: %s", r.Name, err)
 		}
 	}
 
-	if r.conn != nil {
-		if err = r.conn.Close(); err != nil {
-			return fmt.Errorf("could not close connection to %s: %s", r.Name, err)
-		}
-	}
-
 	return nil
 }
 
-// isConnected returns true if the connection is not nil (not thread-safe)
+// isConnected returns true if the stream is not nil (not thread-safe)
 func (r *Remote) isConnected() bool {
-	return r.conn != nil && r.stream != nil
+	return r.stream != nil
 }
 
-// Set the online state and issue a message if the state has changed (not thread-safe)
-func (r *Remote) toggleOnline(online bool) {
+// Set the online state and issue a message if the state has changed, returning
+// the peer event to dispatch or nil if the state has not changed (not
+// thread-safe). The event must be dispatched with notify once the lock is
+// released, since dispatching blocks while the event loop takes the lock.
+func (r *Remote) toggleOnline(online bool) (e Event) {
 	if online && !r.online {
 		info("connection to %s (%s) is now online", r.Name, r.Endpoint(false))
+		e = &event{etype: PeerOnlineEvent, source: r, value: r.Peer}
 	} else if !online && r.online {
 		info("disconnected from %s (%s)", r.Name, r.Endpoint(false))
+		e = &event{etype: PeerOfflineEvent, source: r, value: r.Peer}
 	}
 
 	r.online = online
+	return e
+}
+
+// Dispatch the peer event returned by toggleOnline, if any, without holding
+// the lock of the remote.
+func (r *Remote) notify(e Event) {
+	if e != nil {
+		r.actor.Dispatch(e)
+	}
+}
+
+// Online returns true if the stream to the remote is currently connected.
+func (r *Remote) Online() bool {
+	r.RLock()
+	defer r.RUnlock()
+	return r.online
 }
 
 // Status returns a string with information about the remote connection.
 func (r *Remote) Status() string {
 	var status string
-	if r.online {
+	if r.Online() {
 		status = "online"
 	} else {
 		status = "offline"
 	}
-	return fmt.Sprintf("%s %s: %s", r.Name, status, r.counts)
+	status = fmt.Sprintf(
+		"%s %s (%s): %s, %s, %s", r.Name, status, r.breaker,
+		r.counts, r.lanes[LaneControl].metrics(), r.lanes[LaneData].metrics(),
+	)
+	if outbox, ok := r.Outbox(); ok {
+		status += ", " + outbox.String()
+	}
+	return status
 }
@@ -0,0 +1,152 @@
+package livenet
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/bbengfort/livenet/pb"
+)
+
+// Replicated is a conflict-free replicated data type (see the crdt package)
+// whose replicas are kept in sync by piggybacking deltas on heartbeats. The
+// deltas and state are drained and merged from the event loop while the
+// application may modify the data type concurrently, so implementations must
+// be thread-safe.
+type Replicated interface {
+	Delta() ([]byte, error)          // drain the changes since the last delta, nil if none
+	State() ([]byte, error)          // the full state of the replica
+	Merge(data []byte) (bool, error) // join a delta or state, true if the replica changed
+}
+
+// replicas maintains the replicated data types registered by the application
+// by name. The forwarded deltas and remotes that require the full state are
+// only accessed from the event loop.
+type replicas struct {
+	sync.RWMutex
+	registered map[string]Replicated
+	forward    []*pb.Delta     // deltas received that changed the local replica
+	full       map[string]bool // remotes that have come online since the last heartbeat
+}
+
+//===========================================================================
+// Server Replication API
+//===========================================================================
+
+// Replicate registers a replicated data type under the specified name, which
+// must be the same on every host. Local changes are sent to the neighbors on
+// every heartbeat and changes received from neighbors are merged in the event
+// loop and forwarded so that the replicas on all hosts converge.
+func (s *Server) Replicate(name string, replica Replicated) error {
+	s.replicas.Lock()
+	defer s.replicas.Unlock()
+
+	if s.replicas.registered == nil {
+		s.replicas.registered = make(map[string]Replicated)
+	}
+
+	if _, ok := s.replicas.registered[name]; ok {
+		return fmt.Errorf("a replicated data type named '%s' is already registered", name)
+	}
+
+	s.replicas.registered[name] = replica
+	return nil
+}
+
+//===========================================================================
+// Replication Helpers
+//===========================================================================
+
+// Collect the deltas of the local replicas along with the deltas received from
+// neighbors since the last heartbeat, resetting both.
+func (s *Server) drainDeltas() ([]*pb.Delta, error) {
+	deltas := s.replicas.forward
+	s.replicas.forward = nil
+
+	for _, name := range s.replicaNames() {
+		replica, _ := s.replica(name)
+		data, err := replica.Delta()
+		if err != nil {
+			return nil, fmt.Errorf("could not get delta of %s: %s", name, err)
+		}
+
+		if data != nil {
+			deltas = append(deltas, &pb.Delta{Name: name, State: data})
+		}
+	}
+
+	return deltas, nil
+}
+
+// Returns the deltas to send on the heartbeat to the remote: the full state
+// of every replica if the remote has just come online, otherwise the deltas.
+func (s *Server) replicaDeltas(remote string, deltas []*pb.Delta) ([]*pb.Delta, error) {
+	if !s.replicas.full[remote] {
+		return deltas, nil
+	}
+
+	delete(s.replicas.full, remote)
+	states := make([]*pb.Delta, 0, len(deltas))
+	for _, name := range s.replicaNames() {
+		replica, _ := s.replica(name)
+		data, err := replica.State()
+		if err != nil {
+			return nil, fmt.Errorf("could not get state of %s: %s", name, err)
+		}
+		states = append(states, &pb.Delta{Name: name, State: data})
+	}
+
+	return states, nil
+}
+
+// Mark the remote to receive the full state of every replica on the next
+// heartbeat since it may have missed deltas while offline.
+func (s *Server) resendReplicas(remote string) {
+	if s.replicas.full == nil {
+		s.replicas.full = make(map[string]bool)
+	}
+	s.replicas.full[remote] = true
+}
+
+// Merge the deltas received on a heartbeat into the local replicas and keep
+// the deltas that changed a replica to forward them to the other neighbors.
+func (s *Server) mergeDeltas(sender string, deltas []*pb.Delta) error {
+	for _, delta := range deltas {
+		replica, ok := s.replica(delta.Name)
+		if !ok {
+			caution("received delta for unregistered data type %s", delta.Name)
+			continue
+		}
+
+		changed, err := replica.Merge(delta.State)
+		if err != nil {
+			return fmt.Errorf("could not merge delta of %s from %s: %s", delta.Name, sender, err)
+		}
+
+		if changed {
+			s.replicas.forward = append(s.replicas.forward, delta)
+		}
+	}
+	return nil
+}
+
+// Returns the replicated data type registered with the name.
+func (s *Server) replica(name string) (Replicated, bool) {
+	s.replicas.RLock()
+	defer s.replicas.RUnlock()
+	replica, ok := s.replicas.registered[name]
+	return replica, ok
+}
+
+// Returns the sorted names of the registered replicated data types.
+func (s *Server) replicaNames() []string {
+	s.replicas.RLock()
+	defer s.replicas.RUnlock()
+
+	names := make([]string, 0, len(s.replicas.registered))
+	for name := range s.replicas.registered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,280 @@
+package livenet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+// routes implements a distance-vector routing table so that messages can be
+// relayed to peers that are not directly reachable. Each server advertises its
+// routes to its neighbors on every heartbeat, and the table is recomputed from
+// the online remotes and the most recent view of each online neighbor. The
+// routes are only accessed from the event loop and so are not thread-safe.
+type routes struct {
+	views map[string]map[string]uint32 // hops advertised by each neighbor
+	table map[string]route             // best route to each destination
+}
+
+// route describes the next hop to a destination and the total hops to it.
+type route struct {
+	next string
+	hops uint32
+}
+
+//===========================================================================
+// Server Routing API
+//===========================================================================
+
+// Send a direct message to the recipient, which is delivered as a
+// DirectMessageEvent on the recipient. If the recipient is not directly
+// reachable, the message is relayed through a peer that can reach it. The
+// send is handled asynchronously by the event loop, so an error is only
+// returned if the message cannot be dispatched.
+func (s *Server) Send(recipient string, payload []byte) error {
+	return s.SendContext(context.Background(), recipient, payload)
+}
+
+// SendContext sends a direct message to the recipient like Send. If the block
+// overflow policy is configured, it first waits until the send queue of the
+// recipient (or of every remote if the recipient is not an online neighbor)
+// has room, returning an error if the context is done or the server stops.
+func (s *Server) SendContext(ctx context.Context, recipient string, payload []byte) error {
+	if recipient == s.Name {
+		return errors.New("cannot send a direct message to the local host")
+	}
+
+	msg := pb.WrapTo(s.Name, recipient, s.maxHops(), pb.MessageType_DIRECT, payload)
+	e := &event{etype: SendEvent, source: nil, value: msg}
+	if direct := s.remote(recipient); direct != nil && direct.Online() {
+		return s.dispatchBlocking(ctx, e, direct)
+	}
+	return s.dispatchBlocking(ctx, e, s.remotes...)
+}
+
+//===========================================================================
+// Routing Event Handlers
+//===========================================================================
+
+// Route an application message to its recipient.
+func (s *Server) onSendEvent(e Event) error {
+	defer messageQueued(e)
+	return s.route(e.Value().(*pb.Envelope))
+}
+
+// Update the view of the sender from the routes advertised on its heartbeat,
+// merge the gossiped heartbeat counters and the replica deltas. Heartbeats
+// sent as replies carry no routes and do not modify the view.
+func (s *Server) onHeartbeat(in *pb.Envelope) (*pb.Envelope, error) {
+	if len(in.Message) > 0 {
+		hb := new(pb.Heartbeat)
+		if err := proto.Unmarshal(in.Message, hb); err != nil {
+			return nil, err
+		}
+
+		view := make(map[string]uint32, len(hb.Routes))
+		for _, rt := range hb.Routes {
+			view[rt.Peer] = rt.Hops
+		}
+
+		if s.routes.views == nil {
+			s.routes.views = make(map[string]map[string]uint32)
+		}
+		s.routes.views[in.Sender] = view
+		s.updateRoutes()
+		s.onGossip(hb)
+
+		if err := s.mergeDeltas(in.Sender, hb.Deltas); err != nil {
+			return nil, err
+		}
+	}
+
+	return pb.Wrap(s.Name, pb.MessageType_HEARTBEAT, nil), nil
+}
+
+// Deliver a direct message to the listeners of direct message events.
+func (s *Server) onDirect(in *pb.Envelope) (*pb.Envelope, error) {
+	if err := s.listeners.call(&event{etype: DirectMessageEvent, source: in.Sender, value: in}); err != nil {
+		return nil, callbackError{err}
+	}
+	return pb.Wrap(s.Name, pb.MessageType_HEARTBEAT, nil), nil
+}
+
+// Relay a message addressed to another host, dropping it if its TTL expires.
+func (s *Server) forward(in *pb.Envelope) error {
+	if in.Ttl <= 1 {
+		caution("dropped %s message from %s to %s: ttl expired", in.Type, in.Sender, in.Recipient)
+		return nil
+	}
+
+	msg := proto.Clone(in).(*pb.Envelope)
+	msg.Ttl--
+	msg.SetHeader(HeaderRelay, s.Name)
+	trace("relaying %s message from %s to %s", msg.Type, msg.Sender, msg.Recipient)
+	return s.route(msg)
+}
+
+//===========================================================================
+// Routing Helpers
+//===========================================================================
+
+// Send the message directly to its recipient if the remote is online,
+// otherwise send it to the next hop in the routing table. If no route is
+// known the message is sent directly, which reconnects or drops it.
+func (s *Server) route(msg *pb.Envelope) error {
+	direct := s.remote(msg.Recipient)
+	if direct != nil && direct.Online() {
+		return direct.Send(msg)
+	}
+
+	if rt, ok := s.routes.table[msg.Recipient]; ok {
+		if next := s.remote(rt.next); next != nil {
+			return next.Send(msg)
+		}
+	}
+
+	if direct == nil {
+		caution("dropped %s message to %s: no route to host", msg.Type, msg.Recipient)
+		return nil
+	}
+	return direct.Send(msg)
+}
+
+// Recompute the routing table from the online remotes and neighbor views.
+// Routes longer than the maximum number of hops are discarded to prevent
+// counting to infinity when a host leaves the network.
+func (s *Server) updateRoutes() {
+	maxHops := s.maxHops()
+	table := make(map[string]route)
+
+	for _, remote := range s.remotes {
+		if remote.Online() {
+			table[remote.Name] = route{next: remote.Name, hops: 1}
+		}
+	}
+
+	for neighbor, view := range s.routes.views {
+		if remote := s.remote(neighbor); remote == nil || !remote.Online() {
+			continue
+		}
+
+		for dest, hops := range view {
+			if dest == s.Name || hops+1 > maxHops {
+				continue
+			}
+
+			// Prefer the shortest route, breaking ties by neighbor name so that
+			// the table is deterministic regardless of map ordering.
+			cur, ok := table[dest]
+			if !ok || hops+1 < cur.hops || (hops+1 == cur.hops && neighbor < cur.next) {
+				table[dest] = route{next: neighbor, hops: hops + 1}
+			}
+		}
+	}
+
+	s.routes.table = table
+}
+
+// Create the heartbeat message advertised to the specified neighbor, omitting
+// routes through that neighbor (split horizon), along with the counters, their
+// incarnations, and the piggybacked replica deltas.
+func (s *Server) heartbeat(neighbor string, counters, incarnations map[string]uint64, deltas []*pb.Delta) (*pb.Envelope, error) {
+	hb := &pb.Heartbeat{
+		Routes:       make([]*pb.Route, 0, len(s.routes.table)),
+		Counters:     counters,
+		Incarnations: incarnations,
+		Deltas:       deltas,
+	}
+	for dest, rt := range s.routes.table {
+		if dest == neighbor || rt.next == neighbor {
+			continue
+		}
+		hb.Routes = append(hb.Routes, &pb.Route{Peer: dest, Hops: rt.hops})
+	}
+
+	data, err := proto.Marshal(hb)
+	if err != nil {
+		return nil, err
+	}
+	return pb.Wrap(s.Name, pb.MessageType_HEARTBEAT, data), nil
+}
+
+// Send a message created by the local host to the named host: directly if it
+// is a neighbor, otherwise addressed to the host and relayed over the routing
+// table so that protocols that involve every host work in any topology.
+func (s *Server) sendTo(name string, mtype pb.MessageType, data []byte) error {
+	if remote := s.remote(name); remote != nil {
+		return remote.Send(pb.Wrap(s.Name, mtype, data))
+	}
+	return s.route(pb.WrapTo(s.Name, name, s.maxHops(), mtype, data))
+}
+
+// Forget the view of a neighbor that has gone offline and reroute.
+func (s *Server) dropRoutes(neighbor string) {
+	delete(s.routes.views, neighbor)
+	s.updateRoutes()
+}
+
+// indirectStatus returns a description of the liveness of a host that is not
+// a neighbor and of the route to it. Not thread-safe, call from the event loop.
+func (s *Server) indirectStatus(name string) string {
+	status := "offline"
+	if s.Alive(name) {
+		status = "online"
+	}
+
+	if since, ok := s.gossip.since(name); ok {
+		status += fmt.Sprintf(", last heard %s ago", since.Round(time.Millisecond))
+	} else {
+		status += ", never heard"
+	}
+
+	if rt, ok := s.routes.table[name]; ok {
+		status += fmt.Sprintf(", via %s in %d hops", rt.next, rt.hops)
+	} else {
+		status += ", no route"
+	}
+
+	return fmt.Sprintf("%s %s", name, status)
+}
+
+// Returns the remote with the specified name or nil if it doesn't exist.
+func (s *Server) remote(name string) *Remote {
+	for _, remote := range s.remotes {
+		if remote.Name == name {
+			return remote
+		}
+	}
+	return nil
+}
+
+// Returns the names of the other hosts on the network in the order of the
+// configuration, whether or not they are neighbors.
+func (s *Server) peerNames() []string {
+	names := make([]string, 0, len(s.config.Peers))
+	for _, peer := range s.config.Peers {
+		if peer.Name != s.Name {
+			names = append(names, peer.Name)
+		}
+	}
+	return names
+}
+
+// Returns true if the host is a peer on the network other than the local host.
+func (s *Server) isPeer(name string) bool {
+	for _, peer := range s.peerNames() {
+		if peer == name {
+			return true
+		}
+	}
+	return false
+}
+
+// The maximum number of hops in a route is the number of hosts on the network.
+func (s *Server) maxHops() uint32 {
+	return uint32(len(s.config.Peers))
+}
@@ -4,74 +4,159 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net"
+	"sync"
+	"sync/atomic"
 
 	"github.com/bbengfort/livenet/pb"
 	"github.com/bbengfort/x/peers"
-	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	grpcstatus "google.golang.org/grpc/status"
 )
 
+// errStopped is returned when the server stops listening for events before an
+// event has been dispatched or handled.
+var errStopped = errors.New("server is no longer listening for events")
+
 // Server implements a LiveNet host that connects to all peers on the network
-// via gRPC streams. It can send a variety of messages but primarily sends
-// routine heartbeats to the other servers.
+// via the streams of its transport, gRPC by default. It can send a variety of
+// messages but primarily sends routine heartbeats to the other servers.
 type Server struct {
 	peers.Peer
 
-	config  *Config    // Configuration of the service
-	remotes []*Remote  // Remote peers on the network
-	events  chan Event // Event handling channel
-	clients uint64     //  Number of connected clients
+	config    *Config       // Configuration of the service
+	transport Transport     // Streams to and from the peers
+	remotes   []*Remote     // Remote peers on the network
+	loop      sync.RWMutex  // Protects the channels of the event loop
+	events    chan Event    // Event handling channel
+	done      chan struct{} // Closed when the server stops listening
+	clients   uint64        //  Number of connected clients, accessed atomically
+	listeners listeners     // Callbacks registered by the application
+	topics    topics        // Local subscriptions and remote topic interests
+	routes    routes        // Routing table to relay messages to unreachable peers
+	gossip    gossip        // Heartbeat counters to detect liveness of non-neighbors
+	stores    stores        // Application state reconciled by anti-entropy
+	replicas  replicas      // Replicated data types synchronized on heartbeats
+	locks     locks         // Distributed lock votes and requests
+	barriers  barriers      // Arrivals of hosts at named barriers
+	keys      *keyring      // Keys to sign and verify envelopes
+	transfers transfers     // Chunked payloads being received from peers
+	datagrams datagrams     // Liveness of peers by UDP heartbeats
+	faults    *faults       // Faults injected on the links to peers
+	invalid   invalid       // Envelopes dropped because they could not be handled
 }
 
 // Listen for messages from peers and clients and run the event loop.
 func (s *Server) Listen() error {
-	// Create the events channel and ensure it is nilified when exhausted
-	s.events = make(chan Event, actorEventBufferSize)
-	defer func() { s.events = nil }()
+	// Create the events channel and ensure it is nilified when exhausted, and
+	// stop the timers and goroutines of the server when it stops listening so
+	// that it can listen again.
+	events, done := make(chan Event, actorEventBufferSize), make(chan struct{})
+	s.loop.Lock()
+	s.events, s.done = events, done
+	s.loop.Unlock()
+
+	defer func() {
+		s.loop.Lock()
+		s.events = nil
+		s.loop.Unlock()
+	}()
+	defer s.shutdown()
 
-	// Open TCP socket to listen for incoming streams
+	// Open the socket to listen for incoming streams
 	addr := s.Endpoint(false)
-	sock, err := net.Listen("tcp", addr)
+	sock, err := s.transport.Listen(addr)
 	if err != nil {
 		return fmt.Errorf("could not listen on %s", addr)
 	}
 	defer sock.Close()
 	info("listening for requests on %s", addr)
 
-	// Initialize and run the gRPC server in its own thread
-	srv := grpc.NewServer()
-	pb.RegisterLiveNetServer(srv, s)
+	// Serve the incoming streams in their own thread, requiring mutual TLS
+	// from the clients if it is configured and a valid cluster token.
 	go func() {
-		if err := srv.Serve(sock); err != nil {
+		if err := s.transport.Serve(sock, s.Post); err != nil {
 			// Dispatch an error event and stop the server
-			s.DispatchError(err, srv)
+			s.DispatchError(err, s.transport)
 		}
 	}()
 
-	// Send off the heartbeat and status ticker
-	go s.Heartbeat()
-	go s.Status()
+	// Serve the admin API to control fault injection if configured
+	if s.config.Admin != "" {
+		admin, err := s.serveAdmin(s.config.Admin)
+		if err != nil {
+			return fmt.Errorf("could not serve admin api on %s", s.config.Admin)
+		}
+		defer admin.Close()
+	}
 
-	// Run the event handling loop
-	for event := range s.events {
-		if err := s.Handle(event); err != nil {
+	// Send and receive UDP heartbeats to track liveness independently of the
+	// streams if enabled.
+	if s.config.Datagrams {
+		conn, err := s.listenDatagrams()
+		if err != nil {
 			return err
 		}
+		defer conn.Close()
+
+		done := make(chan struct{})
+		defer close(done)
+		go s.recvDatagrams(conn)
+		go s.sendDatagrams(conn, done)
 	}
 
-	return nil
+	// Start sending the queued messages to the remotes
+	for _, remote := range s.remotes {
+		remote.start()
+		defer remote.stop()
+	}
+
+	// Send off the heartbeat, status, and anti-entropy tickers
+	go s.Heartbeat()
+	go s.Status()
+	go s.AntiEntropy()
+
+	// Run the event handling loop until the server is closed
+	for {
+		select {
+		case event := <-events:
+			if err := s.Handle(event); err != nil {
+				return err
+			}
+		case <-done:
+			return nil
+		}
+	}
 }
 
-// Close the event handler and shutdown the server gracefully.
+// Close the event handler and shutdown the server gracefully, closing the
+// streams to and from the remotes. The server can then listen again.
 func (s *Server) Close() error {
-	if s.events == nil {
+	if events, _ := s.channels(); events == nil {
 		return errors.New("server is not currently listening for events")
 	}
 
-	close(s.events)
+	s.shutdown()
 	return nil
 }
 
+// Stop the event loop, the timers, and any dispatches waiting on the loop.
+func (s *Server) shutdown() {
+	s.loop.Lock()
+	defer s.loop.Unlock()
+	if s.done != nil && !stopped(s.done) {
+		close(s.done)
+	}
+}
+
+// Returns the events channel of the event loop and the channel that is closed
+// when it stops, nil if the server is not listening.
+func (s *Server) channels() (chan Event, chan struct{}) {
+	s.loop.RLock()
+	defer s.loop.RUnlock()
+	return s.events, s.done
+}
+
 // Post implements the LiveNet stream server, listening for stream connections
 // from clients and remote hosts and dispatching each message as an event.
 // Every message received on the stream is responded to before a new message
@@ -81,7 +166,7 @@ func (s *Server) Close() error {
 // Post and Dispatch together also implements the simple multiplexer based on
 // message type. Post sends events of the specified type, which gets handled
 // by the specific event handler.
-func (s *Server) Post(stream pb.LiveNet_PostServer) (err error) {
+func (s *Server) Post(stream ServerStream) (err error) {
 	var (
 		client   string
 		messages uint64
@@ -89,8 +174,26 @@ func (s *Server) Post(stream pb.LiveNet_PostServer) (err error) {
 	)
 
 	// Increment the current number of clients and decrement when done
-	s.clients++
-	defer func() { s.clients-- }()
+	atomic.AddUint64(&s.clients, 1)
+	defer atomic.AddUint64(&s.clients, ^uint64(0))
+
+	// Identify the client by its certificate if the stream uses mutual TLS
+	identity, secure := peerIdentity(stream.Context())
+
+	// Select the compressor for replies from those accepted by the client
+	// and advertise that batches of envelopes are unpacked.
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	codec := negotiateEncoding(s.config, md)
+	if err = stream.SendHeader(metadata.Join(selectedEncoding(codec), acceptBatch())); err != nil {
+		return err
+	}
+
+	// If the client shares the stream, the remote sends requests on it too
+	attached := s.accept(md, identity, secure)
+	if attached != nil {
+		attached.attach(stream, codec)
+		defer attached.detach(stream)
+	}
 
 	// Keep receiving messages on the stream until the client disconnects,
 	// send a reply after each message is received and handled by the server.
@@ -110,40 +213,160 @@ func (s *Server) Post(stream pb.LiveNet_PostServer) (err error) {
 			return err
 		}
 
-		// Log the client connection
-		if client == "" {
-			client = envelope.Sender
-			info("%s connected to %s", client, s.Name)
+		// Close the streams from hosts that are partitioned
+		if s.faults.isPartitioned(lastHop(envelope)) {
+			return grpcstatus.Errorf(codes.Unavailable, "partitioned from %s", lastHop(envelope))
 		}
 
-		// Create a channel to wait for the event handler
-		source := make(chan *pb.Envelope, 1)
+		// Inject the faults of the link from the client, then decode envelopes
+		// sent by hosts using older versions of the schema, decompress the
+		// payload of compressed envelopes, and unpack batches.
+		var envelopes []*pb.Envelope
+		for _, received := range s.faults.inject(lastHop(envelope), envelope) {
+			if err = decodeEnvelope(received, s.config.GetMaxPayload()); err != nil {
+				return err
+			}
 
-		// Dispatch the message event and wait for it to be handled
-		if err = s.DispatchMessage(envelope, source); err != nil {
-			return err
+			var unpacked []*pb.Envelope
+			if unpacked, err = unbatch(received, s.config.GetMaxPayload()); err != nil {
+				return err
+			}
+			envelopes = append(envelopes, unpacked...)
+		}
+
+		replies := make([]*pb.Envelope, 0, len(envelopes))
+		for _, msg := range envelopes {
+			// Reject envelopes that were not sent by the host in the certificate
+			// and drop relayed envelopes whose sender cannot be verified.
+			if secure {
+				if err = s.verifyIdentity(identity, msg); err == errUnsignedRelay {
+					caution("dropped %s message from %s relayed by %s: %s", msg.Type, msg.Sender, identity, err)
+					s.invalid.add(identity)
+					continue
+				} else if err != nil {
+					warne(err)
+					return grpcstatus.Error(codes.PermissionDenied, err.Error())
+				}
+			}
+
+			// Drop envelopes without a valid signature from their sender; the
+			// stream is kept open since the envelope may have been relayed.
+			if err = s.keys.verify(msg); err != nil {
+				if err = s.Dispatch(&event{etype: SignatureRejectedEvent, source: s, value: msg}); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// Handle replies to the requests sent by the attached remote
+			if attached != nil && isReply(msg) {
+				if !attached.onChunkAck(msg) {
+					if err = s.DispatchMessage(msg, attached); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			// Log the client connection, and reconnect to the host that sent
+			// the message on the stream without waiting for the backoff.
+			if client == "" {
+				client = msg.Sender
+				info("%s connected to %s", client, s.Name)
+
+				if remote := s.remote(lastHop(msg)); remote != nil {
+					remote.breaker.reset()
+				}
+			}
+
+			// Create a channel to wait for the event handler
+			source := make(chan *pb.Envelope, 1)
+
+			// Dispatch the message event and wait for it to be handled
+			if err = s.DispatchMessage(msg, source); err != nil {
+				return err
+			}
+
+			// Wait for the event to be handled before handling the next
+			// message. This ensures that the order of messages received
+			// matches the order of replies sent.
+			var reply *pb.Envelope
+			if reply, err = s.await(source); err != nil {
+				return err
+			}
+			reply.SetHeader(HeaderReplyTo, msg.Id)
+			replies = append(replies, s.keys.sign(reply))
+			messages++
+		}
+
+		if len(replies) == 0 {
+			continue
+		}
+
+		// The replies on a shared stream are queued with the requests of the
+		// remote so that receiving is never blocked by flow control.
+		if attached != nil {
+			for _, reply := range replies {
+				attached.Send(reply)
+			}
+			continue
+		}
+
+		// Reply to a batch with a batch of the replies to its envelopes
+		reply := replies[0]
+		if envelope.Type == pb.MessageType_BATCH {
+			if reply, err = batch(s.Name, replies); err != nil {
+				return err
+			}
 		}
 
-		// Wait for the event to be handled before receiving the next message
-		// on the stream. This ensures that the order of messages received
-		// matches the order of replies sent.
-		if err = stream.Send(<-source); err != nil {
+		if reply, err = compress(s.keys.sign(reply), codec, s.config.GetCompressAbove()); err != nil {
 			return err
 		}
 
-		// Increment the number of handled messages
-		messages++
+		if err = stream.Send(reply); err != nil {
+			return err
+		}
 	}
 }
 
 // Dispatch an event to be serialized by the event channel.
 func (s *Server) Dispatch(e Event) error {
-	if s.events == nil {
+	events, done := s.channels()
+	if events == nil {
 		return errors.New("server is not currently listening for events")
 	}
 
-	s.events <- e
-	return nil
+	select {
+	case events <- e:
+		return nil
+	case <-done:
+		return errStopped
+	}
+}
+
+// Wait for the event loop to handle a message dispatched with the channel as
+// its source, returning an error if the server stops listening first.
+func (s *Server) await(source chan *pb.Envelope) (*pb.Envelope, error) {
+	_, done := s.channels()
+	select {
+	case reply := <-source:
+		return reply, nil
+	case <-done:
+		return nil, errStopped
+	}
+}
+
+// Wait for the event loop to respond to a request of the application on the
+// channel, returning an error if the server stops listening first.
+func (s *Server) wait(reply chan error) error {
+	_, done := s.channels()
+	select {
+	case err := <-reply:
+		return err
+	case <-done:
+		return errStopped
+	}
 }
 
 // DispatchMessage creates an event for the specified message type
@@ -157,10 +380,34 @@ func (s *Server) DispatchError(err error, source interface{}) {
 	s.Dispatch(&event{etype: ErrorEvent, source: source, value: err})
 }
 
-// Handle events by passing the event to the specified event handlers.
+// On registers a callback that is called whenever an event of the specified
+// type is handled by the event loop. Multiple callbacks can be registered for
+// the same event type; they are called in the order they were registered and
+// before the server's own handler for the event. Callbacks are executed on the
+// event loop, so they must not block or dispatch events synchronously. If a
+// callback returns an error, no further callbacks are called and the error
+// stops the server in the same manner as an error event.
+//
+// The returned ID can be passed to Off to remove the callback.
+func (s *Server) On(etype EventType, callback Callback) ListenerID {
+	return s.listeners.add(etype, callback)
+}
+
+// Off removes the callback registered for the event type with the specified
+// ID, returning false if no such callback was registered.
+func (s *Server) Off(etype EventType, id ListenerID) bool {
+	return s.listeners.remove(etype, id)
+}
+
+// Handle events by passing the event to the registered listeners and then to
+// the specified event handlers.
 func (s *Server) Handle(e Event) error {
 	trace("%s event received: %v", e.Type(), e.Value())
 
+	if err := s.listeners.call(e); err != nil {
+		return err
+	}
+
 	switch e.Type() {
 	case ErrorEvent:
 		return e.Value().(error)
@@ -170,6 +417,36 @@ func (s *Server) Handle(e Event) error {
 		return s.onStatusTimeout(e)
 	case MessageEvent:
 		return s.onMessageEvent(e)
+	case PeerOnlineEvent:
+		return s.onPeerOnlineEvent(e)
+	case PeerOfflineEvent:
+		return s.onPeerOfflineEvent(e)
+	case SubscriptionEvent:
+		return s.onSubscriptionEvent(e)
+	case PublishEvent:
+		return s.onPublishEvent(e)
+	case SendEvent:
+		return s.onSendEvent(e)
+	case AntiEntropyTimeout:
+		return s.onAntiEntropyTimeout(e)
+	case LockEvent:
+		return s.onLockEvent(e)
+	case UnlockEvent:
+		return s.onUnlockEvent(e)
+	case LockRetryTimeout:
+		return s.onLockRetryTimeout(e)
+	case BarrierEvent:
+		return s.onBarrierEvent(e)
+	case BarrierTimeout:
+		return s.onBarrierTimeout(e)
+	case SignatureRejectedEvent:
+		return s.onSignatureRejectedEvent(e)
+	case ConnectivityEvent:
+		return s.onConnectivityEvent(e)
+	case DatagramOnlineEvent:
+		return s.onDatagramOnlineEvent(e)
+	case DatagramOfflineEvent:
+		return s.onDatagramOfflineEvent(e)
 	default:
 		return fmt.Errorf("no handler identified for event %s", e.Type())
 	}
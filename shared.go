@@ -0,0 +1,119 @@
+package livenet
+
+import (
+	"errors"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/bbengfort/x/peers"
+	"google.golang.org/grpc/metadata"
+)
+
+// HeaderReplyTo is set on replies to the ID of the envelope they reply to, so
+// that a host can tell requests and replies apart on a shared stream.
+const HeaderReplyTo = "livenet-reply-to"
+
+// Metadata key sent by a remote when it creates the Post stream with the name
+// of the local host, so that the server can reuse the stream for requests.
+const mdPeer = "livenet-peer"
+
+// errAwaiting is returned when a remote that shares the stream created by the
+// peer cannot send because the peer has not connected.
+var errAwaiting = errors.New("waiting for peer to connect")
+
+// Returns true if the local host sends requests to the peer on the stream
+// created by the peer rather than dialing it. When streams are shared, the
+// host with the lower PID creates the stream.
+func accepts(peer peers.Peer, config *Config) bool {
+	if !config.SharedStreams {
+		return false
+	}
+
+	local, err := config.GetPeer()
+	if err != nil {
+		return false
+	}
+	return peer.PID < local.PID
+}
+
+// Returns the metadata that identifies the local host to the server.
+func peerName(config *Config) metadata.MD {
+	name, _ := config.GetName()
+	return metadata.Pairs(mdPeer, name)
+}
+
+// Returns true if the envelope is a reply to a request.
+func isReply(msg *pb.Envelope) bool {
+	_, ok := msg.Header(HeaderReplyTo)
+	return ok
+}
+
+// Returns the remote that reuses the stream from the peer identified by the
+// metadata to send requests, or nil if streams are not shared with the peer.
+// If the stream is secured by mutual TLS, the peer must match the identity.
+func (s *Server) accept(md metadata.MD, identity string, secure bool) *Remote {
+	for _, name := range md.Get(mdPeer) {
+		if (secure && name != identity) || s.faults.isPartitioned(name) {
+			return nil
+		}
+
+		if remote := s.remote(name); remote != nil && remote.accepts {
+			return remote
+		}
+	}
+	return nil
+}
+
+// Send requests on the server side of the stream created by the peer.
+func (r *Remote) attach(stream ServerStream, codec Compressor) {
+	r.Lock()
+	r.shared = stream
+	r.codec = codec
+	r.batch = true
+	online := r.toggleOnline(true)
+	r.Unlock()
+
+	r.notify(online)
+}
+
+// Stop sending requests on the stream when the peer disconnects, unless the
+// peer has already created a new stream.
+func (r *Remote) detach(stream ServerStream) {
+	var offline Event
+	r.Lock()
+	if r.shared == stream {
+		r.shared = nil
+		r.codec = nil
+		r.batch = false
+		offline = r.toggleOnline(false)
+	}
+	r.Unlock()
+
+	r.notify(offline)
+}
+
+// Returns the stream that messages to the remote are sent on, or nil if the
+// remote is offline (not thread-safe).
+func (r *Remote) sender() interface {
+	Send(*pb.Envelope) error
+} {
+	if r.shared != nil {
+		return r.shared
+	}
+	if r.stream != nil {
+		return r.stream
+	}
+	return nil
+}
+
+// Handle a request received from the server on a shared stream, queueing the
+// reply to be sent back to the server.
+func (r *Remote) respond(msg *pb.Envelope) {
+	source := make(chan *pb.Envelope, 1)
+	if err := r.actor.DispatchMessage(msg, source); err != nil {
+		return
+	}
+
+	reply := <-source
+	reply.SetHeader(HeaderReplyTo, msg.Id)
+	r.Send(reply)
+}
@@ -0,0 +1,113 @@
+package livenet
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+)
+
+// Records the IDs of the direct messages received by a server and the IDs
+// that the replies it received from its remotes are addressed to.
+type replyLog struct {
+	sync.Mutex
+	requests map[string]bool // IDs of the direct messages received
+	replies  map[string]bool // reply-to headers of the replies received
+}
+
+func newReplyLog(server *Server) *replyLog {
+	log := &replyLog{requests: make(map[string]bool), replies: make(map[string]bool)}
+	server.On(DirectMessageEvent, func(e Event) error {
+		log.Lock()
+		defer log.Unlock()
+		log.requests[e.Value().(*pb.Envelope).Id] = true
+		return nil
+	})
+
+	server.On(MessageEvent, func(e Event) error {
+		if _, ok := e.Source().(*Remote); !ok {
+			return nil
+		}
+
+		if replyTo, ok := e.Value().(*pb.Envelope).Header(HeaderReplyTo); ok {
+			log.Lock()
+			defer log.Unlock()
+			log.replies[replyTo] = true
+		}
+		return nil
+	})
+	return log
+}
+
+// Returns the number of requests received by the log that are replied to in
+// the other log, and the number of replies in the other log to requests that
+// the host of the other log received rather than sent.
+func (l *replyLog) repliedIn(other *replyLog) (replied, misrouted int) {
+	l.Lock()
+	defer l.Unlock()
+	other.Lock()
+	defer other.Unlock()
+
+	for id := range l.requests {
+		if other.replies[id] {
+			replied++
+		}
+	}
+
+	for id := range other.requests {
+		if other.replies[id] {
+			misrouted++
+		}
+	}
+	return replied, misrouted
+}
+
+func TestSharedStreamConcurrentRequests(t *testing.T) {
+	const n = 100
+	configs := testConfigs(2)
+	for _, config := range configs {
+		config.SharedStreams = true
+	}
+
+	servers := testCluster(t, configs)
+	testConnected(t, servers)
+	a, b := servers[0], servers[1]
+	logA, logB := newReplyLog(a), newReplyLog(b)
+
+	// Both peers send requests on the single stream at the same time
+	var wg sync.WaitGroup
+	for _, pair := range [][2]*Server{{a, b}, {b, a}} {
+		wg.Add(1)
+		go func(sender, recipient *Server) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				if err := sender.Send(recipient.Name, []byte(fmt.Sprintf("request %d", i))); err != nil {
+					t.Errorf("%s could not send to %s: %s", sender.Name, recipient.Name, err)
+					return
+				}
+			}
+		}(pair[0], pair[1])
+	}
+	wg.Wait()
+
+	// Every request is replied to on the host that sent it
+	eventually(t, 3*time.Second, func() bool {
+		fromA, _ := logB.repliedIn(logA)
+		fromB, _ := logA.repliedIn(logB)
+		return fromA == n && fromB == n
+	}, "requests were not all replied to")
+
+	if _, misrouted := logB.repliedIn(logA); misrouted > 0 {
+		t.Errorf("%d replies to requests sent by b were received by b", misrouted)
+	}
+
+	if _, misrouted := logA.repliedIn(logB); misrouted > 0 {
+		t.Errorf("%d replies to requests sent by a were received by a", misrouted)
+	}
+
+	if a.remote("b").accepts || !b.remote("a").accepts {
+		t.Error("expected b to send its requests on the stream created by a")
+	}
+}
@@ -0,0 +1,203 @@
+package livenet
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bbengfort/livenet/pb"
+)
+
+// keyring holds the key that signs the envelopes sent by the local host and
+// the public keys that verify envelopes received from its peers. Envelopes
+// from peers without a public key are accepted unverified.
+type keyring struct {
+	sync.Mutex
+	name     string                       // the name of the local host
+	private  ed25519.PrivateKey           // signs envelopes sent by the local host, nil if unsigned
+	public   map[string]ed25519.PublicKey // verifies envelopes sent by the peers
+	rejected map[string]uint64            // number of envelopes rejected by claimed sender
+}
+
+// Load the signing key of the local host and the public keys of the peers.
+func (c *Config) keyring() (*keyring, error) {
+	name, err := c.GetName()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &keyring{
+		name:     name,
+		public:   make(map[string]ed25519.PublicKey),
+		rejected: make(map[string]uint64),
+	}
+
+	for _, peer := range c.Peers {
+		if peer.PublicKey == "" {
+			continue
+		}
+
+		data, err := base64.StdEncoding.DecodeString(peer.PublicKey)
+		if err != nil || len(data) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("could not parse public key of %s", peer.Name)
+		}
+		keys.public[peer.Name] = ed25519.PublicKey(data)
+	}
+
+	if c.SigningKey != "" {
+		if keys.private, err = loadSigningKey(strings.Replace(c.SigningKey, NamePlaceholder, name, -1)); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+// Returns a copy of the envelope signed by the local host if it is the sender
+// of an unsigned envelope, otherwise the envelope is returned unmodified.
+func (k *keyring) sign(msg *pb.Envelope) *pb.Envelope {
+	if k == nil || k.private == nil || msg.Sender != k.name || len(msg.Signature) > 0 {
+		return msg
+	}
+
+	out := *msg
+	out.Sign(k.private)
+	return &out
+}
+
+// Verify the signature of the envelope if the sender has a public key.
+func (k *keyring) verify(msg *pb.Envelope) error {
+	if k == nil {
+		return nil
+	}
+
+	key, ok := k.public[msg.Sender]
+	if !ok {
+		return nil
+	}
+
+	if len(msg.Signature) == 0 {
+		return fmt.Errorf("unsigned %s envelope %s from %s", msg.Type, msg.Id, msg.Sender)
+	}
+
+	if !msg.Verify(key) {
+		return fmt.Errorf("invalid signature on %s envelope %s from %s", msg.Type, msg.Id, msg.Sender)
+	}
+	return nil
+}
+
+// Returns true if the envelope has a valid signature from its sender, false if
+// it is unsigned or the sender has no public key.
+func (k *keyring) signed(msg *pb.Envelope) bool {
+	if k == nil {
+		return false
+	}
+
+	key, ok := k.public[msg.Sender]
+	return ok && msg.Verify(key)
+}
+
+// Count an envelope rejected because of its signature.
+func (k *keyring) reject(sender string) {
+	k.Lock()
+	defer k.Unlock()
+	k.rejected[sender]++
+}
+
+// Rejected returns the number of envelopes received with a missing or invalid
+// signature, by the host that was claimed to have sent them.
+func (s *Server) Rejected() map[string]uint64 {
+	s.keys.Lock()
+	defer s.keys.Unlock()
+
+	rejected := make(map[string]uint64, len(s.keys.rejected))
+	for sender, count := range s.keys.rejected {
+		rejected[sender] = count
+	}
+	return rejected
+}
+
+// Handle envelopes rejected because of their signature by the server or by a
+// remote; the listeners have been called with the event before this handler.
+func (s *Server) onSignatureRejectedEvent(e Event) error {
+	msg := e.Value().(*pb.Envelope)
+	s.keys.reject(msg.Sender)
+
+	if remote, ok := e.Source().(*Remote); ok {
+		remote.counts.Reject()
+	}
+
+	warn("rejected %s envelope %s from %s with bad signature", msg.Type, msg.Id, msg.Sender)
+	return nil
+}
+
+//===========================================================================
+// Key Generation
+//===========================================================================
+
+// GenerateKeys creates an ed25519 signing key for every peer in the
+// configuration, writing them to the directory as {name}.key and setting the
+// public key of each peer. Returns the signing key path for the configuration.
+func (c *Config) GenerateKeys(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	for i, peer := range c.Peers {
+		if peer.Name == "" {
+			return "", errors.New("could not generate key for peer with no name")
+		}
+
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", err
+		}
+
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return "", err
+		}
+
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err = ioutil.WriteFile(filepath.Join(dir, peer.Name+".key"), data, 0600); err != nil {
+			return "", err
+		}
+
+		c.Peers[i].PublicKey = base64.StdEncoding.EncodeToString(pub)
+	}
+
+	return filepath.Join(dir, NamePlaceholder+".key"), nil
+}
+
+// Load a PEM encoded PKCS #8 ed25519 private key.
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read signing key: %s", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("could not decode signing key %s", path)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse signing key: %s", err)
+	}
+
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not an ed25519 key", path)
+	}
+	return priv, nil
+}
@@ -0,0 +1,50 @@
+package livenet
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/bbengfort/livenet/pb"
+)
+
+func TestSignedHeaders(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %s", err)
+	}
+
+	keys := &keyring{name: "a", private: private, public: map[string]ed25519.PublicKey{"a": public}}
+	msg := pb.WrapTo("a", "c", 3, pb.MessageType_DIRECT, []byte("hello"))
+	msg.SetHeader(HeaderReplyTo, "request")
+	msg.SetHeader("x-trace", "1234")
+	msg = keys.sign(msg)
+
+	// Transit headers and the TTL may change without invalidating the signature
+	msg.Ttl--
+	msg.SetHeader(HeaderRelay, "b")
+	msg.SetHeader(HeaderContentEncoding, "gzip")
+	if err = keys.verify(msg); err != nil {
+		t.Errorf("signature invalidated by transit headers: %s", err)
+	}
+
+	// The headers set by the sender cannot be modified, added, or removed
+	tampered := []func(e *pb.Envelope){
+		func(e *pb.Envelope) { e.SetHeader(HeaderReplyTo, "other") },
+		func(e *pb.Envelope) { e.SetHeader("x-forged", "") },
+		func(e *pb.Envelope) { delete(e.Headers, "x-trace") },
+	}
+
+	for i, tamper := range tampered {
+		out := *msg
+		out.Headers = make(map[string]string, len(msg.Headers))
+		for key, value := range msg.Headers {
+			out.Headers[key] = value
+		}
+
+		tamper(&out)
+		if err = keys.verify(&out); err == nil {
+			t.Errorf("tampered headers %d were not rejected", i)
+		}
+	}
+}
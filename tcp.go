@@ -0,0 +1,282 @@
+package livenet
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Limits of the raw TCP transport.
+const (
+	maxFrameSize     = 16 * 1024 * 1024 // largest frame accepted from a peer
+	dialTimeout      = 5 * time.Second  // time to wait to connect to a peer
+	handshakeTimeout = 5 * time.Second  // time to wait for the handshake of a peer
+)
+
+// tcpTransport sends envelopes as length-prefixed protobuf frames over plain
+// TCP connections, secured by mutual TLS if it is configured. Each frame is a
+// 4-byte big endian length followed by the serialized message. The first frame
+// in each direction is a handshake with the metadata of the stream, which gRPC
+// sends as headers, so the same negotiation and authentication apply.
+//
+// If keepalives are configured, the interval is used as the TCP keepalive
+// period of the connections and remotes ping the peer with a heartbeat when
+// nothing has been received for the interval.
+type tcpTransport struct {
+	config *Config
+}
+
+// Listen on the TCP socket for incoming connections, performing the TLS
+// handshake on the connections if it is configured.
+func (t *tcpTransport) Listen(addr string) (net.Listener, error) {
+	interval, _ := t.config.GetKeepalive()
+	lc := net.ListenConfig{KeepAlive: interval}
+	sock, err := lc.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return t.secure(sock)
+}
+
+// Perform the TLS handshake on the connections accepted on the socket if TLS
+// is configured.
+func (t *tcpTransport) secure(sock net.Listener) (net.Listener, error) {
+	conf, err := t.config.serverTLS()
+	if err != nil {
+		sock.Close()
+		return nil, err
+	}
+	if conf != nil {
+		return tls.NewListener(sock, conf), nil
+	}
+	return sock, nil
+}
+
+// Serve a stream on each connection accepted on the socket, closing the
+// connections that are still open when the socket is closed.
+func (t *tcpTransport) Serve(sock net.Listener, handler StreamHandler) error {
+	var (
+		mu    sync.Mutex
+		conns = make(map[net.Conn]struct{})
+	)
+
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	for {
+		conn, err := sock.Accept()
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		conns[conn] = struct{}{}
+		mu.Unlock()
+
+		go func() {
+			t.serve(conn, handler)
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock()
+		}()
+	}
+}
+
+// Wait for the handshake of the connection, reject it without a valid cluster
+// token, and handle the stream until it is closed.
+func (t *tcpTransport) serve(conn net.Conn, handler StreamHandler) {
+	defer conn.Close()
+	stream := newTCPStream(conn)
+
+	conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	md, err := stream.Header()
+	if err != nil {
+		caution("no handshake from %s: %s", conn.RemoteAddr(), err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	if !authenticate(t.config, md) {
+		caution("rejected stream from %s with invalid cluster token", conn.RemoteAddr())
+		return
+	}
+
+	// Identify the remote by its certificate in the same manner as gRPC
+	info := &peer.Peer{Addr: conn.RemoteAddr()}
+	if tc, ok := conn.(*tls.Conn); ok {
+		info.AuthInfo = credentials.TLSInfo{State: tc.ConnectionState()}
+	}
+	stream.ctx = peer.NewContext(metadata.NewIncomingContext(context.Background(), md), info)
+
+	if err = handler(stream); err != nil {
+		caution("stream from %s closed: %s", conn.RemoteAddr(), err)
+	}
+}
+
+// Dial the remote and open a stream on the connection.
+func (t *tcpTransport) Dial(addr, remote string, md metadata.MD) (ClientStream, error) {
+	interval, _ := t.config.GetKeepalive()
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: interval}
+
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return t.open(conn, remote, md)
+}
+
+// Open a stream on the connection to the remote, verifying its certificate if
+// TLS is configured, and send the handshake with the metadata.
+func (t *tcpTransport) open(conn net.Conn, remote string, md metadata.MD) (ClientStream, error) {
+	conf, err := t.config.clientTLS(remote)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not load credentials: %s", err)
+	}
+
+	if conf != nil {
+		conn = tls.Client(conn, conf)
+	}
+
+	stream := newTCPStream(conn)
+	conn.SetWriteDeadline(time.Now().Add(handshakeTimeout))
+	if err = stream.SendHeader(md); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not create message stream: %s", err)
+	}
+	conn.SetWriteDeadline(time.Time{})
+	return stream, nil
+}
+
+// tcpStream reads and writes the frames of a stream on a TCP connection. The
+// same stream is used by both the client and the server.
+type tcpStream struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	ctx    context.Context
+	mu     sync.Mutex // serializes the frames written to the connection
+	once   sync.Once  // reads the handshake before the first envelope
+	md     metadata.MD
+	err    error
+}
+
+func newTCPStream(conn net.Conn) *tcpStream {
+	return &tcpStream{conn: conn, reader: bufio.NewReader(conn), ctx: context.Background()}
+}
+
+// Send the envelope in a frame.
+func (s *tcpStream) Send(msg *pb.Envelope) error {
+	return s.write(msg)
+}
+
+// Recv the envelope in the next frame, waiting for the handshake first.
+func (s *tcpStream) Recv() (*pb.Envelope, error) {
+	if _, err := s.Header(); err != nil {
+		return nil, err
+	}
+
+	msg := new(pb.Envelope)
+	if err := s.read(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// SendHeader sends the handshake with the metadata of the local host.
+func (s *tcpStream) SendHeader(md metadata.MD) error {
+	keys := make([]string, 0, len(md))
+	for key := range md {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	handshake := &pb.Handshake{Metadata: make([]*pb.Metadata, 0, len(keys))}
+	for _, key := range keys {
+		handshake.Metadata = append(handshake.Metadata, &pb.Metadata{Key: key, Values: md[key]})
+	}
+	return s.write(handshake)
+}
+
+// Header waits for the handshake from the remote host and returns its metadata.
+func (s *tcpStream) Header() (metadata.MD, error) {
+	s.once.Do(func() {
+		handshake := new(pb.Handshake)
+		if s.err = s.read(handshake); s.err != nil {
+			return
+		}
+
+		s.md = metadata.MD{}
+		for _, item := range handshake.Metadata {
+			s.md[item.Key] = append(s.md[item.Key], item.Values...)
+		}
+	})
+	return s.md, s.err
+}
+
+// Context returns the context of the stream.
+func (s *tcpStream) Context() context.Context {
+	return s.ctx
+}
+
+// Close the connection.
+func (s *tcpStream) Close() error {
+	return s.conn.Close()
+}
+
+// Write the message in a single frame.
+func (s *tcpStream) write(msg proto.Message) error {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.conn.Write(frame)
+	return err
+}
+
+// Read the next frame into the message. Returns io.EOF if the connection was
+// closed between frames.
+func (s *tcpStream) read(msg proto.Message) error {
+	var prefix [4]byte
+	if _, err := io.ReadFull(s.reader, prefix[:]); err != nil {
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(prefix[:])
+	if size > maxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds the maximum of %d bytes", size, maxFrameSize)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(s.reader, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return proto.Unmarshal(data, msg)
+}
@@ -0,0 +1,147 @@
+package livenet
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+	"google.golang.org/grpc/metadata"
+)
+
+// Returns the configurations of a cluster of n hosts on the TCP transport.
+func testTCPConfigs(n int) []*Config {
+	configs := testConfigs(n)
+	for _, config := range configs {
+		config.Transport = TransportTCP
+		config.Tokens = []string{"secret"}
+	}
+	return configs
+}
+
+// Connect to the server over a raw TCP connection, failing the test if the
+// connection cannot be opened.
+func testTCPConn(t *testing.T, server *Server) net.Conn {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", server.Endpoint(false), time.Second)
+	if err != nil {
+		t.Fatalf("could not connect to %s: %s", server.Name, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// Wait for the server to close the connection, failing the test if it sends
+// a frame or keeps the connection open.
+func testClosed(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Errorf("expected the server to close the connection, read %d bytes: %v", n, err)
+	}
+}
+
+func TestTCPCluster(t *testing.T) {
+	servers := testCluster(t, testTCPConfigs(3))
+	testConnected(t, servers)
+	a, c := servers[0], servers[2]
+
+	log := newDirectLog(c)
+	eventually(t, 2*time.Second, func() bool {
+		if err := a.Send("c", []byte("hello")); err != nil {
+			t.Fatalf("could not send message: %s", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+		return log.count("hello") > 0
+	}, "direct message was not delivered over tcp")
+
+	for _, server := range servers {
+		for _, remote := range server.remotes {
+			if !server.Alive(remote.Name) {
+				t.Errorf("%s is not alive on %s", remote.Name, server.Name)
+			}
+		}
+	}
+}
+
+func TestTCPRejectsOversizedFrame(t *testing.T) {
+	configs := testTCPConfigs(2)
+	server := testCluster(t, configs[:1])[0]
+
+	conn := testTCPConn(t, server)
+	stream := newTCPStream(conn)
+	if err := stream.SendHeader(metadata.Join(clusterToken(configs[1]), peerName(configs[1]))); err != nil {
+		t.Fatalf("could not send handshake: %s", err)
+	}
+
+	if _, err := stream.Header(); err != nil {
+		t.Fatalf("no handshake from %s: %s", server.Name, err)
+	}
+
+	// The length prefix of a frame larger than the limit closes the stream
+	// before its payload is read.
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], maxFrameSize+1)
+	if _, err := conn.Write(prefix[:]); err != nil {
+		t.Fatalf("could not write frame: %s", err)
+	}
+	testClosed(t, conn)
+
+	// The stream reading the frame reports the size of the frame
+	client, peer := net.Pipe()
+	defer client.Close()
+	go func() {
+		peer.Write(prefix[:])
+		peer.Close()
+	}()
+
+	if err := newTCPStream(client).read(new(pb.Envelope)); err == nil {
+		t.Error("expected the oversized frame to be rejected")
+	}
+}
+
+func TestTCPRejectsBadHandshake(t *testing.T) {
+	configs := testTCPConfigs(2)
+	server := testCluster(t, configs[:1])[0]
+
+	// A handshake with an invalid token is closed without a reply
+	conn := testTCPConn(t, server)
+	md := metadata.Join(metadata.Pairs(mdToken, "guess"), peerName(configs[1]))
+	if err := newTCPStream(conn).SendHeader(md); err != nil {
+		t.Fatalf("could not send handshake: %s", err)
+	}
+	testClosed(t, conn)
+
+	// A handshake without a token is closed without a reply
+	conn = testTCPConn(t, server)
+	if err := newTCPStream(conn).SendHeader(peerName(configs[1])); err != nil {
+		t.Fatalf("could not send handshake: %s", err)
+	}
+	testClosed(t, conn)
+
+	// A first frame that is not a handshake is closed without a reply
+	conn = testTCPConn(t, server)
+	if _, err := conn.Write([]byte{0, 0, 0, 3, 0xff, 0xff, 0xff}); err != nil {
+		t.Fatalf("could not write frame: %s", err)
+	}
+	testClosed(t, conn)
+
+	// The server keeps serving valid streams
+	conn = testTCPConn(t, server)
+	stream := newTCPStream(conn)
+	if err := stream.SendHeader(metadata.Join(clusterToken(configs[1]), peerName(configs[1]))); err != nil {
+		t.Fatalf("could not send handshake: %s", err)
+	}
+
+	if err := stream.Send(pb.Wrap("b", pb.MessageType_HEARTBEAT, nil)); err != nil {
+		t.Fatalf("could not send heartbeat: %s", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := stream.Recv(); err != nil {
+		t.Errorf("no reply after the bad handshakes: %s", err)
+	}
+}
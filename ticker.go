@@ -5,15 +5,22 @@ import (
 	"time"
 )
 
-// Heartbeat sends a routine liveness message to other peers.
+// Heartbeat sends a routine liveness message to other peers until the server
+// stops listening.
 func (s *Server) Heartbeat() {
+	_, done := s.channels()
+	s.scheduleHeartbeat(done)
+}
+
+// Dispatch a heartbeat event and schedule the next unless done is closed.
+func (s *Server) scheduleHeartbeat(done <-chan struct{}) {
 	tick, err := s.config.GetTick()
-	if err != nil {
+	if err != nil || stopped(done) {
 		return
 	}
 
 	// Schedule the next heartbeat event
-	defer time.AfterFunc(tick, s.Heartbeat)
+	defer time.AfterFunc(tick, func() { s.scheduleHeartbeat(done) })
 
 	// Dispatch the heartbeat event
 	s.Dispatch(&event{etype: HeartbeatTimeout, source: nil, value: nil})
@@ -24,16 +31,55 @@ func (s *Server) Heartbeat() {
 	time.Sleep(sleep)
 }
 
-// Status reports the liveness status to the console.
+// Status reports the liveness status to the console until the server stops
+// listening.
 func (s *Server) Status() {
+	_, done := s.channels()
+	s.scheduleStatus(done)
+}
+
+// Dispatch a status event and schedule the next unless done is closed.
+func (s *Server) scheduleStatus(done <-chan struct{}) {
 	tick, err := s.config.GetTick()
-	if err != nil {
+	if err != nil || stopped(done) {
 		return
 	}
 
 	// Schedule the next status event when this event is dispatched
-	defer time.AfterFunc(tick*1000, s.Status)
+	defer time.AfterFunc(tick*1000, func() { s.scheduleStatus(done) })
 
 	// Dispatch the status event
 	s.Dispatch(&event{etype: StatusTimeout, source: nil, value: nil})
 }
+
+// AntiEntropy reconciles the registered state stores with a random peer until
+// the server stops listening.
+func (s *Server) AntiEntropy() {
+	_, done := s.channels()
+	s.scheduleAntiEntropy(done)
+}
+
+// Dispatch an anti-entropy event and schedule the next unless done is closed.
+func (s *Server) scheduleAntiEntropy(done <-chan struct{}) {
+	interval, err := s.config.GetAntiEntropy()
+	if err != nil || stopped(done) {
+		return
+	}
+
+	// Schedule the next anti-entropy event when this event is dispatched
+	defer time.AfterFunc(interval, func() { s.scheduleAntiEntropy(done) })
+
+	// Dispatch the anti-entropy event
+	s.Dispatch(&event{etype: AntiEntropyTimeout, source: nil, value: nil})
+}
+
+// Returns true if the server that started a timer has stopped listening, so
+// that the timers are not duplicated when the server listens again.
+func stopped(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
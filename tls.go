@@ -0,0 +1,305 @@
+package livenet
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/bbengfort/x/peers"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// NamePlaceholder is replaced by the name of the local host in the paths of
+// the TLS configuration so that all hosts can share a configuration file.
+const NamePlaceholder = "{name}"
+
+// HeaderRelay is set on an envelope by each host that relays it, identifying
+// the host that sent the envelope on the stream when it is not the sender.
+const HeaderRelay = pb.HeaderRelay
+
+// Validity of the certificates generated for the network.
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	certValidity = 365 * 24 * time.Hour
+)
+
+// TLSConfig defines the certificates used for mutual TLS between peers. Each
+// host presents a certificate whose common name is the name of its peer, and
+// verifies that the certificate of the remote host is signed by the CA.
+type TLSConfig struct {
+	CA   string `json:"ca"`   // path to the PEM encoded certificate authority
+	Cert string `json:"cert"` // path to the PEM encoded certificate of the host, may contain {name}
+	Key  string `json:"key"`  // path to the PEM encoded private key of the host, may contain {name}
+}
+
+//===========================================================================
+// Transport Credentials
+//===========================================================================
+
+// ServerCredentials returns the transport credentials for the gRPC server that
+// require clients to present a certificate signed by the CA, or nil if TLS is
+// not configured.
+func (c *Config) ServerCredentials() (credentials.TransportCredentials, error) {
+	conf, err := c.serverTLS()
+	if conf == nil || err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(conf), nil
+}
+
+// ClientCredentials returns the transport credentials to connect to the named
+// remote host, verifying that its certificate was issued to that name, or nil
+// if TLS is not configured.
+func (c *Config) ClientCredentials(remote string) (credentials.TransportCredentials, error) {
+	conf, err := c.clientTLS(remote)
+	if conf == nil || err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(conf), nil
+}
+
+// Returns the TLS configuration of a server that requires clients to present
+// a certificate signed by the CA, or nil if TLS is not configured.
+func (c *Config) serverTLS() (*tls.Config, error) {
+	if c.TLS == nil {
+		return nil, nil
+	}
+
+	cert, pool, err := c.loadTLS()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}, nil
+}
+
+// Returns the TLS configuration of a client that verifies the certificate of
+// the named remote host, or nil if TLS is not configured.
+func (c *Config) clientTLS(remote string) (*tls.Config, error) {
+	if c.TLS == nil {
+		return nil, nil
+	}
+
+	cert, pool, err := c.loadTLS()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   remote,
+	}, nil
+}
+
+// Load the certificate of the local host and the pool of the CA.
+func (c *Config) loadTLS() (cert tls.Certificate, pool *x509.CertPool, err error) {
+	var name string
+	if name, err = c.GetName(); err != nil {
+		return cert, nil, err
+	}
+
+	certPath := strings.Replace(c.TLS.Cert, NamePlaceholder, name, -1)
+	keyPath := strings.Replace(c.TLS.Key, NamePlaceholder, name, -1)
+	if cert, err = tls.LoadX509KeyPair(certPath, keyPath); err != nil {
+		return cert, nil, fmt.Errorf("could not load certificate: %s", err)
+	}
+
+	var data []byte
+	if data, err = ioutil.ReadFile(c.TLS.CA); err != nil {
+		return cert, nil, fmt.Errorf("could not read certificate authority: %s", err)
+	}
+
+	pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return cert, nil, fmt.Errorf("could not parse certificate authority %s", c.TLS.CA)
+	}
+
+	return cert, pool, nil
+}
+
+// Returns the name of the host from the verified certificate of the peer on
+// the stream, and false if the stream is not secured by mutual TLS.
+func peerIdentity(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	return info.State.VerifiedChains[0][0].Subject.CommonName, true
+}
+
+// errUnsignedRelay is returned for envelopes relayed by the host identified by
+// the certificate whose signature cannot be verified.
+var errUnsignedRelay = errors.New("relayed envelope is not signed by its sender")
+
+// Verify that the envelope was sent on the stream by the host identified by
+// the certificate: the sender of the envelope, or the last host to relay it.
+// The relay header is not authenticated, so relayed envelopes are only
+// accepted if they are signed by their sender.
+func (s *Server) verifyIdentity(identity string, msg *pb.Envelope) error {
+	if msg.Sender == identity {
+		return nil
+	}
+
+	if relay, _ := msg.Header(HeaderRelay); relay != identity {
+		return fmt.Errorf("envelope from %s sent by host with certificate for %s", msg.Sender, identity)
+	}
+
+	if !s.keys.signed(msg) {
+		return errUnsignedRelay
+	}
+	return nil
+}
+
+// Returns the host that sent the envelope on the stream: the sender of the
+// envelope, or the last host to relay it. The relay header is not verified,
+// so the last hop is only used to inject faults.
+func lastHop(msg *pb.Envelope) string {
+	if relay, ok := msg.Header(HeaderRelay); ok {
+		return relay
+	}
+	return msg.GetSender()
+}
+
+//===========================================================================
+// Certificate Generation
+//===========================================================================
+
+// GenerateCerts creates a certificate authority and a certificate and key
+// for every peer in the configuration, writing them to the directory as
+// ca.pem, ca.key, {name}.pem and {name}.key. Returns the TLS configuration
+// that refers to the generated files.
+func (c *Config) GenerateCerts(dir string) (*TLSConfig, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	// Create the self-signed certificate authority
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	caTemplate := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "LiveNet CA", Organization: []string{"LiveNet"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := createCertificate(caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = writePEM(dir, "ca", caDER, caKey); err != nil {
+		return nil, err
+	}
+
+	// Create a certificate for every peer, identified by its name
+	for _, p := range c.Peers {
+		if err = generatePeerCert(dir, p.Peer, ca, caKey); err != nil {
+			return nil, fmt.Errorf("could not generate certificate for %s: %s", p.Name, err)
+		}
+	}
+
+	return &TLSConfig{
+		CA:   filepath.Join(dir, "ca.pem"),
+		Cert: filepath.Join(dir, NamePlaceholder+".pem"),
+		Key:  filepath.Join(dir, NamePlaceholder+".key"),
+	}, nil
+}
+
+// Generate the certificate of a peer signed by the certificate authority.
+func generatePeerCert(dir string, p peers.Peer, ca *x509.Certificate, caKey *ecdsa.PrivateKey) error {
+	if p.Name == "" {
+		return errors.New("peer has no name")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: p.Name, Organization: []string{"LiveNet"}},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(certValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:    []string{p.Name},
+	}
+
+	// The certificate is also valid for the address of the peer
+	if ip := net.ParseIP(p.IPAddr); ip != nil {
+		template.IPAddresses = append(template.IPAddresses, ip)
+	} else if p.IPAddr != "" && p.IPAddr != p.Name {
+		template.DNSNames = append(template.DNSNames, p.IPAddr)
+	}
+
+	der, err := createCertificate(template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+	return writePEM(dir, p.Name, der, key)
+}
+
+// Sign the template with a random serial number.
+func createCertificate(template, parent *x509.Certificate, pub *ecdsa.PublicKey, priv *ecdsa.PrivateKey) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	template.SerialNumber = serial
+	return x509.CreateCertificate(rand.Reader, template, parent, pub, priv)
+}
+
+// Write the certificate to name.pem and the private key to name.key.
+func writePEM(dir, name string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err = ioutil.WriteFile(filepath.Join(dir, name+".pem"), cert, 0644); err != nil {
+		return err
+	}
+
+	priv := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return ioutil.WriteFile(filepath.Join(dir, name+".key"), priv, 0600)
+}
@@ -0,0 +1,54 @@
+package livenet
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/bbengfort/livenet/pb"
+)
+
+func TestVerifyIdentity(t *testing.T) {
+	server, err := New(testConfigs(3)[0])
+	if err != nil {
+		t.Fatalf("could not create server: %s", err)
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %s", err)
+	}
+	server.keys.public["c"] = public
+
+	direct := pb.Wrap("b", pb.MessageType_DIRECT, []byte("hello"))
+	if err = server.verifyIdentity("b", direct); err != nil {
+		t.Errorf("envelope sent by the host in the certificate was rejected: %s", err)
+	}
+
+	if err = server.verifyIdentity("c", direct); err == nil || err == errUnsignedRelay {
+		t.Errorf("envelope from b sent by c was not rejected: %v", err)
+	}
+
+	// A host cannot impersonate another by claiming to have relayed the envelope
+	forged := pb.WrapTo("c", "a", 2, pb.MessageType_DIRECT, []byte("hello"))
+	forged.SetHeader(HeaderRelay, "b")
+	if err = server.verifyIdentity("b", forged); err != errUnsignedRelay {
+		t.Errorf("expected unsigned relayed envelope to be dropped, got %v", err)
+	}
+
+	forged.Signature = make([]byte, ed25519.SignatureSize)
+	if err = server.verifyIdentity("b", forged); err != errUnsignedRelay {
+		t.Errorf("expected relayed envelope with an invalid signature to be dropped, got %v", err)
+	}
+
+	relayed := pb.WrapTo("c", "a", 2, pb.MessageType_DIRECT, []byte("hello"))
+	relayed.Sign(private)
+	relayed.SetHeader(HeaderRelay, "b")
+	if err = server.verifyIdentity("b", relayed); err != nil {
+		t.Errorf("signed envelope relayed by b was rejected: %s", err)
+	}
+
+	if err = server.verifyIdentity("d", relayed); err == nil || err == errUnsignedRelay {
+		t.Errorf("envelope relayed by b sent by d was not rejected: %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package livenet
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/bbengfort/x/peers"
+)
+
+// Overlay topologies that determine which peers are connected as neighbors.
+const (
+	TopologyMesh      = "mesh"
+	TopologyRing      = "ring"
+	TopologyStar      = "star"
+	TopologyRegular   = "regular"
+	TopologyHypercube = "hypercube"
+)
+
+// Maximum number of attempts to generate a random regular graph.
+const regularGraphAttempts = 100
+
+// Topology computes the neighbors of each peer in an overlay network. The
+// peers are identified by their index in the configuration so that every
+// host that shares the configuration computes the same graph.
+type Topology interface {
+	Neighbors(idx int) []int
+}
+
+// NewTopology creates the named topology for a network of n peers. The
+// degree is only used by the regular topology, which uses the seed to
+// generate the same random graph on every host.
+func NewTopology(name string, n, degree int, seed int64) (Topology, error) {
+	switch name {
+	case "", TopologyMesh:
+		return mesh(n), nil
+	case TopologyRing:
+		return ring(n), nil
+	case TopologyStar:
+		return star(n), nil
+	case TopologyRegular:
+		return newRegular(n, degree, seed)
+	case TopologyHypercube:
+		return hypercube(n), nil
+	default:
+		return nil, fmt.Errorf("unknown topology '%s'", name)
+	}
+}
+
+//===========================================================================
+// Topology Implementations
+//===========================================================================
+
+// mesh connects every peer to every other peer.
+type mesh int
+
+func (t mesh) Neighbors(idx int) []int {
+	neighbors := make([]int, 0, int(t)-1)
+	for i := 0; i < int(t); i++ {
+		if i != idx {
+			neighbors = append(neighbors, i)
+		}
+	}
+	return neighbors
+}
+
+// ring connects every peer to the peers before and after it.
+type ring int
+
+func (t ring) Neighbors(idx int) []int {
+	n := int(t)
+	switch n {
+	case 1:
+		return nil
+	case 2:
+		return []int{(idx + 1) % n}
+	default:
+		return []int{(idx + n - 1) % n, (idx + 1) % n}
+	}
+}
+
+// star connects the first peer (the hub) to all other peers.
+type star int
+
+func (t star) Neighbors(idx int) []int {
+	if idx == 0 {
+		return mesh(t).Neighbors(idx)
+	}
+	return []int{0}
+}
+
+// hypercube connects peers whose indices differ by a single bit. If the
+// number of peers is not a power of two, the cube is incomplete but remains
+// connected since every peer is connected to the peer with its highest bit
+// cleared.
+type hypercube int
+
+func (t hypercube) Neighbors(idx int) []int {
+	neighbors := make([]int, 0)
+	for bit := 1; bit < int(t); bit <<= 1 {
+		if nbr := idx ^ bit; nbr < int(t) {
+			neighbors = append(neighbors, nbr)
+		}
+	}
+	return neighbors
+}
+
+// regular is a random graph where every peer has the same number of
+// neighbors, generated with the pairing model.
+type regular [][]int
+
+func (t regular) Neighbors(idx int) []int {
+	return t[idx]
+}
+
+// Generate a random k-regular graph by randomly pairing k stubs for each peer,
+// retrying if the pairing creates a self loop or duplicate edge.
+func newRegular(n, k int, seed int64) (regular, error) {
+	if k <= 0 || k >= n || (n*k)%2 != 0 {
+		return nil, fmt.Errorf("cannot create %d-regular graph with %d peers", k, n)
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+
+attempts:
+	for attempt := 0; attempt < regularGraphAttempts; attempt++ {
+		stubs := make([]int, 0, n*k)
+		for i := 0; i < n; i++ {
+			for j := 0; j < k; j++ {
+				stubs = append(stubs, i)
+			}
+		}
+		rng.Shuffle(len(stubs), func(i, j int) { stubs[i], stubs[j] = stubs[j], stubs[i] })
+
+		edges := make([]map[int]bool, n)
+		for i := range edges {
+			edges[i] = make(map[int]bool, k)
+		}
+
+		for i := 0; i < len(stubs); i += 2 {
+			u, v := stubs[i], stubs[i+1]
+			if u == v || edges[u][v] {
+				continue attempts
+			}
+			edges[u][v] = true
+			edges[v][u] = true
+		}
+
+		graph := make(regular, n)
+		for i, nbrs := range edges {
+			for j := range nbrs {
+				graph[i] = append(graph[i], j)
+			}
+			sort.Ints(graph[i])
+		}
+		return graph, nil
+	}
+
+	return nil, fmt.Errorf("could not generate %d-regular graph with %d peers", k, n)
+}
+
+//===========================================================================
+// Configuration Helpers
+//===========================================================================
+
+// GetNeighbors returns the peer configurations of the hosts that the local
+// host is directly connected to in the configured topology.
+func (c *Config) GetNeighbors() ([]peers.Peer, error) {
+	local, err := c.GetName()
+	if err != nil {
+		return nil, err
+	}
+
+	topo, err := NewTopology(c.Topology, len(c.Peers), c.Degree, c.Seed)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, peer := range c.Peers {
+		if peer.Name != local {
+			continue
+		}
+
+		neighbors := make([]peers.Peer, 0)
+		for _, nbr := range topo.Neighbors(idx) {
+			neighbors = append(neighbors, c.Peers[nbr].Peer)
+		}
+		return neighbors, nil
+	}
+
+	return nil, fmt.Errorf("could not find peer for '%s'", local)
+}
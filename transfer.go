@@ -0,0 +1,358 @@
+package livenet
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/golang/protobuf/proto"
+
+	gohash "hash"
+)
+
+// Chunked transfer defaults. Chunks must be smaller than the gRPC message
+// size limit, and at most a window of unacknowledged chunks is sent before
+// waiting for the recipient. Chunks that are not acknowledged within a number
+// of ticks are resent, e.g. after the stream reconnects.
+const (
+	DefaultChunkSize    = 64 * 1024
+	MaxChunkSize        = 1024 * 1024
+	transferWindow      = 16
+	transferRetryTicks  = 4
+	transferExpiration  = 10 * time.Minute
+	transferAckCapacity = 2 * transferWindow
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// Transfer is a large payload received in chunks from a peer, the value of
+// the TransferEvent dispatched when the payload has been reassembled.
+type Transfer struct {
+	ID     string // the unique identity of the transfer
+	Sender string // the host that sent the payload
+	Data   []byte // the reassembled payload
+}
+
+// GetChunkSize returns the maximum size of the chunks of a transfer or
+// DefaultChunkSize if not specified, or an error if it exceeds MaxChunkSize.
+func (c *Config) GetChunkSize() (int, error) {
+	if c.ChunkSize <= 0 {
+		return DefaultChunkSize, nil
+	}
+	if c.ChunkSize > MaxChunkSize {
+		return 0, fmt.Errorf("chunk size %d exceeds maximum of %d bytes", c.ChunkSize, MaxChunkSize)
+	}
+	return c.ChunkSize, nil
+}
+
+//===========================================================================
+// Sending Transfers
+//===========================================================================
+
+// SendLarge transfers the payload read from the reader to the neighbor in
+// chunks, blocking until it has been reassembled by the neighbor. Chunked
+// transfers are not relayed, so the recipient must be a neighbor.
+func (s *Server) SendLarge(ctx context.Context, recipient string, reader io.Reader) error {
+	remote := s.remote(recipient)
+	if remote == nil {
+		return fmt.Errorf("cannot transfer to %s: not a neighbor of %s", recipient, s.Name)
+	}
+	return remote.SendLarge(ctx, reader)
+}
+
+// SendLarge transfers the payload read from the reader to the remote in
+// ordered chunks that are sent in the data lane, so they are interleaved with
+// heartbeats. Chunks that are not acknowledged, e.g. because the stream was
+// disconnected, are resent until the context is done. Blocks until the remote
+// has reassembled the payload and dispatched a TransferEvent.
+func (r *Remote) SendLarge(ctx context.Context, reader io.Reader) error {
+	size, err := r.config.GetChunkSize()
+	if err != nil {
+		return err
+	}
+
+	tick, err := r.config.GetTick()
+	if err != nil {
+		return err
+	}
+
+	sender, err := r.config.GetName()
+	if err != nil {
+		return err
+	}
+
+	// Register to receive the acknowledgments of the transfer
+	id := pb.NewID()
+	acks := make(chan *pb.Chunk, transferAckCapacity)
+	r.Lock()
+	if r.transfers == nil {
+		r.transfers = make(map[string]chan *pb.Chunk)
+	}
+	r.transfers[id] = acks
+	r.Unlock()
+
+	defer func() {
+		r.Lock()
+		delete(r.transfers, id)
+		r.Unlock()
+	}()
+
+	var (
+		next    uint64         // index of the next chunk the remote expects
+		sent    uint64         // number of chunks read and sent
+		done    bool           // if the final chunk has been read
+		pending []*pb.Envelope // unacknowledged chunks, starting at next
+		retry   = time.NewTimer(tick * transferRetryTicks)
+		chunker = &chunker{transfer: id, reader: reader, size: size, digest: sha256.New()}
+	)
+	defer retry.Stop()
+
+	for {
+		// Read and send chunks until the window is full
+		for !done && sent < next+transferWindow {
+			var chunk *pb.Chunk
+			if chunk, err = chunker.read(sent); err != nil {
+				return err
+			}
+			done = chunk.Last
+
+			var msg *pb.Envelope
+			if msg, err = wrapChunk(sender, chunk); err != nil {
+				return err
+			}
+
+			pending = append(pending, msg)
+			r.Send(msg)
+			sent++
+		}
+
+		select {
+		case ack := <-acks:
+			if ack.Error != "" {
+				return fmt.Errorf("transfer %s to %s aborted: %s", id, r.Name, ack.Error)
+			}
+
+			if ack.Complete {
+				return nil
+			}
+
+			// Discard the acknowledged chunks and wait for more progress
+			if ack.Next > next && ack.Next <= sent {
+				pending = pending[ack.Next-next:]
+				next = ack.Next
+				resetTimer(retry, tick*transferRetryTicks)
+			}
+		case <-retry.C:
+			// Resend the unacknowledged chunks from the next expected chunk
+			trace("resending %d chunks of transfer %s to %s", len(pending), id, r.Name)
+			for _, msg := range pending {
+				r.Send(msg)
+			}
+			retry.Reset(tick * transferRetryTicks)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Deliver the acknowledgment of a chunk to the transfer that sent it. Returns
+// false if the envelope is not a chunk acknowledgment.
+func (r *Remote) onChunkAck(msg *pb.Envelope) bool {
+	if msg.Type != pb.MessageType_CHUNK {
+		return false
+	}
+
+	ack := new(pb.Chunk)
+	if err := proto.Unmarshal(msg.Message, ack); err != nil || !ack.Ack {
+		return false
+	}
+
+	r.RLock()
+	acks, ok := r.transfers[ack.Transfer]
+	r.RUnlock()
+
+	// Acknowledgments are cumulative so they can be dropped if the transfer
+	// is not keeping up with them.
+	if ok {
+		select {
+		case acks <- ack:
+		default:
+		}
+	}
+	return true
+}
+
+// chunker splits the payload read from a reader into chunks.
+type chunker struct {
+	transfer string
+	reader   io.Reader
+	size     int
+	total    uint64      // size of the payload read so far
+	digest   gohash.Hash // hash of the payload read so far
+}
+
+// Read the chunk at the index, the final chunk has the size and digest of the
+// payload and may be empty if the payload ends at a chunk boundary.
+func (c *chunker) read(index uint64) (*pb.Chunk, error) {
+	data := make([]byte, c.size)
+	n, err := io.ReadFull(c.reader, data)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("could not read chunk %d of transfer %s: %s", index, c.transfer, err)
+	}
+
+	data = data[:n]
+	c.digest.Write(data)
+	c.total += uint64(n)
+
+	chunk := &pb.Chunk{
+		Transfer: c.transfer,
+		Index:    index,
+		Data:     data,
+		Checksum: crc32.Checksum(data, crc32c),
+	}
+
+	if err != nil {
+		chunk.Last = true
+		chunk.Size = c.total
+		chunk.Digest = c.digest.Sum(nil)
+	}
+	return chunk, nil
+}
+
+// Wrap the chunk in an envelope from the sender.
+func wrapChunk(sender string, chunk *pb.Chunk) (*pb.Envelope, error) {
+	data, err := proto.Marshal(chunk)
+	if err != nil {
+		return nil, err
+	}
+	return pb.Wrap(sender, pb.MessageType_CHUNK, data), nil
+}
+
+// Reset a timer that may have fired without its channel being drained.
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+//===========================================================================
+// Receiving Transfers
+//===========================================================================
+
+// transfers reassembles the chunks of the payloads sent by peers; it is only
+// accessed by the event loop.
+type transfers struct {
+	incoming  map[string]*assembly // partially received transfers by sender and id
+	completed map[string]time.Time // recently reassembled transfers by sender and id
+}
+
+// assembly is a transfer whose chunks are being received in order.
+type assembly struct {
+	data    bytes.Buffer
+	next    uint64
+	updated time.Time
+}
+
+// Handle a chunk of a transfer sent by a remote host, appending it to the
+// payload if it is the next chunk expected, and reply with the index of the
+// next chunk expected so that the sender can resend missing chunks.
+func (s *Server) onChunk(in *pb.Envelope) (*pb.Envelope, error) {
+	chunk := new(pb.Chunk)
+	if err := proto.Unmarshal(in.Message, chunk); err != nil {
+		return nil, err
+	}
+
+	if s.transfers.incoming == nil {
+		s.transfers.incoming = make(map[string]*assembly)
+		s.transfers.completed = make(map[string]time.Time)
+	}
+	s.expireTransfers()
+
+	key := in.Sender + "/" + chunk.Transfer
+	ack := &pb.Chunk{Transfer: chunk.Transfer, Ack: true}
+
+	// Acknowledge chunks resent after the transfer was completed
+	if _, ok := s.transfers.completed[key]; ok {
+		ack.Complete = true
+		return wrapChunk(s.Name, ack)
+	}
+
+	asm, ok := s.transfers.incoming[key]
+	if !ok {
+		asm = new(assembly)
+		s.transfers.incoming[key] = asm
+	}
+	asm.updated = time.Now()
+
+	// Only append the next chunk if it is not corrupted, otherwise the sender
+	// resends the chunks from the next chunk expected.
+	if chunk.Index == asm.next {
+		if crc32.Checksum(chunk.Data, crc32c) != chunk.Checksum {
+			caution("chunk %d of transfer %s from %s failed checksum", chunk.Index, chunk.Transfer, in.Sender)
+		} else {
+			asm.data.Write(chunk.Data)
+			asm.next++
+
+			if chunk.Last {
+				delete(s.transfers.incoming, key)
+				if err := verifyTransfer(chunk, asm); err != nil {
+					ack.Error = err.Error()
+					warne(err)
+					return wrapChunk(s.Name, ack)
+				}
+
+				s.transfers.completed[key] = time.Now()
+				ack.Complete = true
+
+				transfer := &Transfer{ID: chunk.Transfer, Sender: in.Sender, Data: asm.data.Bytes()}
+				if err := s.listeners.call(&event{etype: TransferEvent, source: in.Sender, value: transfer}); err != nil {
+					return nil, callbackError{err}
+				}
+			}
+		}
+	}
+
+	ack.Next = asm.next
+	return wrapChunk(s.Name, ack)
+}
+
+// Verify the size and digest of a reassembled payload.
+func verifyTransfer(last *pb.Chunk, asm *assembly) error {
+	if uint64(asm.data.Len()) != last.Size {
+		return fmt.Errorf("transfer %s reassembled %d of %d bytes", last.Transfer, asm.data.Len(), last.Size)
+	}
+
+	digest := sha256.Sum256(asm.data.Bytes())
+	if !bytes.Equal(digest[:], last.Digest) {
+		return errors.New("transfer " + last.Transfer + " failed digest verification")
+	}
+	return nil
+}
+
+// Discard transfers that have not received a chunk recently and forget the
+// transfers that were completed long ago.
+func (s *Server) expireTransfers() {
+	expired := time.Now().Add(-transferExpiration)
+	for key, asm := range s.transfers.incoming {
+		if asm.updated.Before(expired) {
+			caution("transfer %s expired after %d chunks", key, asm.next)
+			delete(s.transfers.incoming, key)
+		}
+	}
+
+	for key, completed := range s.transfers.completed {
+		if completed.Before(expired) {
+			delete(s.transfers.completed, key)
+		}
+	}
+}
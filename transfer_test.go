@@ -0,0 +1,192 @@
+package livenet
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+// Create a cluster of two hosts that transfer payloads in chunks of 1KiB and
+// return the channel of the transfers received by b.
+func testTransfers(t *testing.T) (a, b *Server, transfers chan *Transfer) {
+	t.Helper()
+	configs := testConfigs(2)
+	for _, config := range configs {
+		config.ChunkSize = 1024
+	}
+
+	servers := testCluster(t, configs)
+	testConnected(t, servers)
+	a, b = servers[0], servers[1]
+
+	transfers = make(chan *Transfer, 4)
+	b.On(TransferEvent, func(e Event) error {
+		transfers <- e.Value().(*Transfer)
+		return nil
+	})
+	return a, b, transfers
+}
+
+// Returns a random payload of the size.
+func testPayload(t *testing.T, size int) []byte {
+	t.Helper()
+	payload := make([]byte, size)
+	if _, err := rand.Read(payload); err != nil {
+		t.Fatalf("could not create payload: %s", err)
+	}
+	return payload
+}
+
+// Send the payload from a to b and check that it is reassembled by b.
+func testSendLarge(t *testing.T, a *Server, transfers chan *Transfer, payload []byte) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := a.SendLarge(ctx, "b", bytes.NewReader(payload)); err != nil {
+		t.Fatalf("could not transfer payload: %s", err)
+	}
+
+	select {
+	case transfer := <-transfers:
+		if transfer.Sender != "a" || !bytes.Equal(transfer.Data, payload) {
+			t.Errorf("expected %d bytes from a, got %d bytes from %s", len(payload), len(transfer.Data), transfer.Sender)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no transfer event after the transfer completed")
+	}
+}
+
+func TestTransferChunks(t *testing.T) {
+	a, _, transfers := testTransfers(t)
+
+	// The payload spans more chunks than the window of unacknowledged chunks
+	testSendLarge(t, a, transfers, testPayload(t, 20*1024+100))
+
+	// A payload that ends on a chunk boundary ends with an empty chunk
+	testSendLarge(t, a, transfers, testPayload(t, 4*1024))
+}
+
+func TestTransferResumesAfterDisconnect(t *testing.T) {
+	a, b, transfers := testTransfers(t)
+	eventsA := newPeerEvents(a)
+	payload := testPayload(t, 40*1024)
+
+	// Slow down the chunks so that the transfer is disconnected partway
+	if err := a.InjectFaults("b", LinkFaults{Delay: "5ms"}); err != nil {
+		t.Fatalf("could not inject faults: %s", err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		errc <- a.SendLarge(ctx, "b", bytes.NewReader(payload))
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	a.Partition("b")
+	eventually(t, time.Second, func() bool { _, offline := eventsA.count("b"); return offline > 0 }, "b did not go offline")
+
+	select {
+	case <-transfers:
+		t.Fatal("transfer completed before it was disconnected")
+	case err := <-errc:
+		t.Fatalf("transfer returned before it was disconnected: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The unacknowledged chunks are resent once the remote reconnects
+	a.Heal("b")
+	a.ClearFaults("b")
+	testConnected(t, []*Server{a, b})
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("could not resume transfer: %s", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("transfer did not resume after reconnecting")
+	}
+
+	select {
+	case transfer := <-transfers:
+		if !bytes.Equal(transfer.Data, payload) {
+			t.Errorf("resumed transfer reassembled %d of %d bytes incorrectly", len(transfer.Data), len(payload))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no transfer event after the transfer resumed")
+	}
+}
+
+func TestTransferRejectsCorruptedChunks(t *testing.T) {
+	server, err := New(testConfigs(2)[0])
+	if err != nil {
+		t.Fatalf("could not create server: %s", err)
+	}
+
+	var received []*Transfer
+	server.On(TransferEvent, func(e Event) error {
+		received = append(received, e.Value().(*Transfer))
+		return nil
+	})
+
+	// Send a chunk to the server and return its acknowledgment
+	send := func(chunk *pb.Chunk) *pb.Chunk {
+		t.Helper()
+		msg, err := wrapChunk("b", chunk)
+		if err != nil {
+			t.Fatalf("could not wrap chunk: %s", err)
+		}
+
+		reply, err := server.onChunk(msg)
+		if err != nil {
+			t.Fatalf("could not handle chunk: %s", err)
+		}
+
+		ack := new(pb.Chunk)
+		if err = proto.Unmarshal(reply.Message, ack); err != nil {
+			t.Fatalf("could not unmarshal ack: %s", err)
+		}
+		return ack
+	}
+
+	data := []byte("hello world")
+	digest := sha256.Sum256(data)
+	chunk := &pb.Chunk{Transfer: "t1", Index: 0, Data: data, Checksum: crc32.Checksum(data, crc32c) + 1}
+
+	// A chunk that fails its checksum is not appended and must be resent
+	if ack := send(chunk); ack.Next != 0 || ack.Complete || ack.Error != "" {
+		t.Errorf("expected the corrupted chunk to be rejected, got %+v", ack)
+	}
+
+	chunk.Checksum = crc32.Checksum(data, crc32c)
+	if ack := send(chunk); ack.Next != 1 {
+		t.Errorf("expected the resent chunk to be accepted, got %+v", ack)
+	}
+
+	// A payload that fails its digest is aborted
+	last := &pb.Chunk{Transfer: "t1", Index: 1, Checksum: crc32.Checksum(nil, crc32c), Last: true, Size: uint64(len(data)), Digest: make([]byte, len(digest))}
+	if ack := send(last); ack.Error == "" || ack.Complete {
+		t.Errorf("expected the transfer to fail its digest, got %+v", ack)
+	}
+
+	// A payload with a valid digest is reassembled
+	chunk.Transfer, last.Transfer, last.Digest = "t2", "t2", digest[:]
+	send(chunk)
+	if ack := send(last); !ack.Complete || ack.Error != "" {
+		t.Errorf("expected the transfer to complete, got %+v", ack)
+	}
+
+	if len(received) != 1 || received[0].ID != "t2" || !bytes.Equal(received[0].Data, data) {
+		t.Errorf("expected only the valid transfer to be received, got %+v", received)
+	}
+}
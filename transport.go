@@ -0,0 +1,155 @@
+package livenet
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/bbengfort/livenet/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Transports that carry the streams of envelopes between hosts.
+const (
+	TransportGRPC   = "grpc"   // bidirectional gRPC streams, the default
+	TransportTCP    = "tcp"    // length-prefixed protobuf frames over plain TCP
+	TransportMemory = "memory" // frames over in-process connections, for tests
+)
+
+// Transport creates the streams of envelopes between hosts on the network.
+// The liveness of a remote is determined by the stream it opens to the remote,
+// so all transports are driven by the same connection and reconnection logic.
+type Transport interface {
+	// Listen opens the socket that remote hosts connect to on the address.
+	Listen(addr string) (net.Listener, error)
+
+	// Serve the streams connected by remote hosts on the socket, handling each
+	// stream in its own goroutine, until the socket is closed. The streams that
+	// are still open are closed when serving stops.
+	Serve(sock net.Listener, handler StreamHandler) error
+
+	// Dial the named remote host at the address and open a stream to it,
+	// sending the metadata to the remote when the stream is created.
+	Dial(addr, remote string, md metadata.MD) (ClientStream, error)
+}
+
+// StreamHandler receives the envelopes on a stream accepted from a remote host
+// and sends replies until the remote closes the stream.
+type StreamHandler func(stream ServerStream) error
+
+// ServerStream is a stream accepted from a remote host. The context of the
+// stream holds the metadata sent by the remote and its peer information,
+// including the TLS connection state if the transport is secured.
+type ServerStream interface {
+	Send(*pb.Envelope) error
+	Recv() (*pb.Envelope, error)
+	SendHeader(metadata.MD) error
+	Context() context.Context
+}
+
+// ClientStream is a stream opened by the local host to a remote host. Header
+// waits for the metadata sent by the remote when it accepts the stream, and
+// Close closes the stream and the connection it was opened on.
+type ClientStream interface {
+	Send(*pb.Envelope) error
+	Recv() (*pb.Envelope, error)
+	Header() (metadata.MD, error)
+	Close() error
+}
+
+// GetTransport returns the transport selected by the configuration, gRPC if
+// not specified.
+func (c *Config) GetTransport() (Transport, error) {
+	switch c.Transport {
+	case "", TransportGRPC:
+		return &grpcTransport{config: c}, nil
+	case TransportTCP:
+		return &tcpTransport{config: c}, nil
+	case TransportMemory:
+		return &memoryTransport{tcpTransport{config: c}}, nil
+	default:
+		return nil, fmt.Errorf("unknown transport '%s'", c.Transport)
+	}
+}
+
+//===========================================================================
+// gRPC Transport
+//===========================================================================
+
+// grpcTransport serves the LiveNet gRPC service, requiring mutual TLS from the
+// clients if it is configured and a valid cluster token.
+type grpcTransport struct {
+	config *Config
+}
+
+// Listen on the TCP socket for incoming streams.
+func (t *grpcTransport) Listen(addr string) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+// Serve the Post streams of the gRPC service on the socket.
+func (t *grpcTransport) Serve(sock net.Listener, handler StreamHandler) error {
+	opts := []grpc.ServerOption{grpc.StreamInterceptor(authInterceptor(t.config))}
+	opts = append(opts, serverKeepalive(t.config)...)
+	creds, err := t.config.ServerCredentials()
+	if err != nil {
+		return err
+	}
+	if creds != nil {
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	srv := grpc.NewServer(opts...)
+	pb.RegisterLiveNetServer(srv, handler)
+	defer srv.Stop()
+	return srv.Serve(sock)
+}
+
+// Dial the remote and create a Post stream to it.
+func (t *grpcTransport) Dial(addr, remote string, md metadata.MD) (ClientStream, error) {
+	// Use mutual TLS if configured, verifying the identity of the remote
+	opt := grpc.WithInsecure()
+	creds, err := t.config.ClientCredentials(remote)
+	if err != nil {
+		return nil, fmt.Errorf("could not load credentials: %s", err)
+	}
+	if creds != nil {
+		opt = grpc.WithTransportCredentials(creds)
+	}
+
+	opts := append([]grpc.DialOption{opt}, clientKeepalive(t.config)...)
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+	stream, err := pb.NewLiveNetClient(conn).Post(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not create message stream: %s", err)
+	}
+
+	return &grpcStream{LiveNet_PostClient: stream, conn: conn}, nil
+}
+
+// Post implements the LiveNet gRPC service by handling the stream.
+func (h StreamHandler) Post(stream pb.LiveNet_PostServer) error {
+	return h(stream)
+}
+
+// grpcStream is a Post stream and the connection it was created on.
+type grpcStream struct {
+	pb.LiveNet_PostClient
+	conn *grpc.ClientConn
+}
+
+// Close the stream and the connection.
+func (s *grpcStream) Close() error {
+	err := s.CloseSend()
+	if cerr := s.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,321 @@
+package livenet
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+	"github.com/bbengfort/x/peers"
+	"github.com/golang/protobuf/proto"
+)
+
+// DefaultDatagramTicks is the number of ticks without a heartbeat datagram
+// from a peer before it is considered unreachable.
+const DefaultDatagramTicks = 5
+
+// Largest heartbeat datagram that is read from the socket.
+const maxDatagramSize = 512
+
+// GetDatagramTimeout returns the parsed duration from the datagram timeout
+// configuration. If not specified, the timeout is DefaultDatagramTicks ticks.
+func (c *Config) GetDatagramTimeout() (timeout time.Duration, err error) {
+	if c.DatagramTimeout == "" {
+		var tick time.Duration
+		if tick, err = c.GetTick(); err != nil {
+			return 0, err
+		}
+		return tick * DefaultDatagramTicks, nil
+	}
+	if timeout, err = time.ParseDuration(c.DatagramTimeout); err != nil {
+		return timeout, fmt.Errorf("could not parse datagram timeout: %s", err)
+	}
+	return timeout, nil
+}
+
+// DatagramMetrics describes the heartbeat datagrams received from a peer, which
+// determine its liveness independently of the stream to the peer.
+type DatagramMetrics struct {
+	Alive    bool          // if a datagram was received within the timeout
+	Received uint64        // number of datagrams received in sequence
+	Lost     uint64        // number of datagrams missing from the sequence
+	Since    time.Duration // time since the last datagram, zero if none received
+}
+
+// String returns a summary of the datagrams received from the peer.
+func (m DatagramMetrics) String() string {
+	status := "unreachable"
+	if m.Alive {
+		status = "reachable"
+	}
+
+	var loss float64
+	if total := m.Received + m.Lost; total > 0 {
+		loss = float64(m.Lost) / float64(total) * 100
+	}
+
+	return fmt.Sprintf(
+		"%s by datagrams: %d received, %d lost (%0.2f%%), last %s ago",
+		status, m.Received, m.Lost, loss, m.Since.Truncate(time.Millisecond),
+	)
+}
+
+// datagrams tracks the heartbeat datagrams sent to and received from every
+// peer on the network, whether or not it is a neighbor in the topology.
+type datagrams struct {
+	sync.RWMutex
+	sequence uint64                   // local sequence number incremented on each tick
+	peers    map[string]*datagramPeer // liveness of each peer by name
+}
+
+// datagramPeer records the datagrams received from a peer.
+type datagramPeer struct {
+	peers.Peer
+	addr        *net.UDPAddr // resolved address to send datagrams to
+	alive       bool         // if a datagram was received within the timeout
+	incarnation uint64       // incarnation of the peer the sequence belongs to
+	first       uint64       // first sequence number received since the peer started
+	last        uint64       // last sequence number received from the peer
+	received    uint64       // number of datagrams received since the first
+	updated     time.Time    // when the last datagram was received
+}
+
+// Open the UDP socket on the port of the local host and resolve the addresses
+// of the peers to send heartbeat datagrams to.
+func (s *Server) listenDatagrams() (*net.UDPConn, error) {
+	addr, err := net.ResolveUDPAddr("udp", s.Endpoint(false))
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen for datagrams on %s", addr)
+	}
+
+	s.datagrams.Lock()
+	defer s.datagrams.Unlock()
+
+	s.datagrams.peers = make(map[string]*datagramPeer, len(s.config.Peers))
+	for _, peer := range s.config.Peers {
+		if peer.Name == s.Name {
+			continue
+		}
+
+		dp := &datagramPeer{Peer: peer.Peer}
+		if dp.addr, err = net.ResolveUDPAddr("udp", peer.Endpoint(true)); err != nil {
+			caution("could not resolve datagram address of %s: %s", peer.Name, err)
+		}
+		s.datagrams.peers[peer.Name] = dp
+	}
+
+	info("listening for datagrams on %s", addr)
+	return conn, nil
+}
+
+// Send a heartbeat datagram to every peer on each tick and mark the peers that
+// have not been heard from within the timeout as unreachable until stopped.
+func (s *Server) sendDatagrams(conn *net.UDPConn, done <-chan struct{}) {
+	tick, _ := s.config.GetTick()
+	timeout, _ := s.config.GetDatagramTimeout()
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		s.datagrams.Lock()
+		s.datagrams.sequence++
+		msg := &pb.Datagram{
+			Sender:      s.Name,
+			Incarnation: s.gossip.incarnation,
+			Sequence:    s.datagrams.sequence,
+			Timestamp:   time.Now().UnixNano(),
+		}
+		msg.Mac = datagramMAC(clusterSecret(s.config), msg)
+
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			s.datagrams.Unlock()
+			s.DispatchError(err, s)
+			return
+		}
+
+		var unreachable []peers.Peer
+		for _, peer := range s.datagrams.peers {
+			if peer.addr != nil {
+				if _, err = conn.WriteToUDP(data, peer.addr); err != nil {
+					trace("could not send datagram to %s: %s", peer.Name, err)
+				}
+			}
+
+			if peer.alive && time.Since(peer.updated) > timeout {
+				peer.alive = false
+				unreachable = append(unreachable, peer.Peer)
+			}
+		}
+		s.datagrams.Unlock()
+
+		for _, peer := range unreachable {
+			s.Dispatch(&event{etype: DatagramOfflineEvent, source: s, value: peer})
+		}
+	}
+}
+
+// Receive the heartbeat datagrams from peers until the socket is closed,
+// ignoring datagrams that are not accepted.
+func (s *Server) recvDatagrams(conn *net.UDPConn) {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		msg := new(pb.Datagram)
+		if err = proto.Unmarshal(buf[:n], msg); err != nil {
+			trace("could not decode datagram from %s: %s", addr, err)
+			continue
+		}
+
+		if err = s.receiveDatagram(msg); err != nil {
+			caution("rejected datagram from %s: %s", addr, err)
+		}
+	}
+}
+
+// Record a heartbeat datagram from a peer, dispatching an event if the peer
+// has become reachable. Returns an error if the datagram is from an unknown
+// host, has an invalid MAC, or is replayed: sent outside of the timeout, by a
+// previous incarnation of the peer, or with a sequence number that has
+// already been received from the current incarnation.
+func (s *Server) receiveDatagram(msg *pb.Datagram) error {
+	if !verifyDatagram(s.config, msg) {
+		return errors.New("invalid mac")
+	}
+
+	timeout, _ := s.config.GetDatagramTimeout()
+	if age := time.Since(time.Unix(0, msg.Timestamp)); age > timeout || age < -timeout {
+		return fmt.Errorf("stale datagram sent %s ago", age.Truncate(time.Millisecond))
+	}
+
+	s.datagrams.Lock()
+	peer, ok := s.datagrams.peers[msg.Sender]
+	if !ok {
+		s.datagrams.Unlock()
+		return fmt.Errorf("unknown host %s", msg.Sender)
+	}
+
+	// The sequence restarts when the peer restarts in a new incarnation
+	switch {
+	case msg.Incarnation < peer.incarnation:
+		s.datagrams.Unlock()
+		return fmt.Errorf("datagram from previous incarnation of %s", msg.Sender)
+	case msg.Incarnation > peer.incarnation || peer.received == 0:
+		peer.incarnation = msg.Incarnation
+		peer.first, peer.received = msg.Sequence, 0
+	case msg.Sequence <= peer.last:
+		s.datagrams.Unlock()
+		return fmt.Errorf("sequence %d from %s already received", msg.Sequence, msg.Sender)
+	}
+
+	peer.last = msg.Sequence
+	peer.received++
+	peer.updated = time.Now()
+
+	reachable := !peer.alive
+	peer.alive = true
+	s.datagrams.Unlock()
+
+	if reachable {
+		s.Dispatch(&event{etype: DatagramOnlineEvent, source: s, value: peer.Peer})
+	}
+	return nil
+}
+
+// Datagrams returns the metrics of the heartbeat datagrams received from every
+// peer by name, empty if datagrams are not enabled.
+func (s *Server) Datagrams() map[string]DatagramMetrics {
+	s.datagrams.RLock()
+	defer s.datagrams.RUnlock()
+
+	metrics := make(map[string]DatagramMetrics, len(s.datagrams.peers))
+	for name, peer := range s.datagrams.peers {
+		m := DatagramMetrics{Alive: peer.alive, Received: peer.received}
+		if peer.received > 0 {
+			m.Lost = peer.last - peer.first + 1 - peer.received
+			m.Since = time.Since(peer.updated)
+		}
+		metrics[name] = m
+	}
+	return metrics
+}
+
+// Log the peers that are reachable by datagrams; the listeners have been
+// called with the event before this handler.
+func (s *Server) onDatagramOnlineEvent(e Event) error {
+	info("%s is reachable by datagrams", e.Value().(peers.Peer).Name)
+	return nil
+}
+
+// Log the peers that are unreachable by datagrams; the listeners have been
+// called with the event before this handler.
+func (s *Server) onDatagramOfflineEvent(e Event) error {
+	info("%s is unreachable by datagrams", e.Value().(peers.Peer).Name)
+	return nil
+}
+
+//===========================================================================
+// Datagram Authentication
+//===========================================================================
+
+// Returns the token that datagrams are authenticated with, nil if no tokens
+// are configured.
+func clusterSecret(config *Config) []byte {
+	if len(config.Tokens) == 0 {
+		return nil
+	}
+	return []byte(config.Tokens[0])
+}
+
+// Returns the HMAC-SHA256 of the sender, incarnation, sequence, and timestamp
+// of the datagram keyed by the token, nil if there is no token.
+func datagramMAC(token []byte, msg *pb.Datagram) []byte {
+	if token == nil {
+		return nil
+	}
+
+	var fields [24]byte
+	binary.BigEndian.PutUint64(fields[0:8], msg.Incarnation)
+	binary.BigEndian.PutUint64(fields[8:16], msg.Sequence)
+	binary.BigEndian.PutUint64(fields[16:24], uint64(msg.Timestamp))
+
+	mac := hmac.New(sha256.New, token)
+	mac.Write([]byte(msg.Sender))
+	mac.Write(fields[:])
+	return mac.Sum(nil)
+}
+
+// Returns true if the MAC of the datagram is valid for any of the configured
+// tokens or if no tokens are configured.
+func verifyDatagram(config *Config, msg *pb.Datagram) bool {
+	if len(config.Tokens) == 0 {
+		return true
+	}
+
+	for _, token := range config.Tokens {
+		if hmac.Equal(msg.Mac, datagramMAC([]byte(token), msg)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package livenet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bbengfort/livenet/pb"
+)
+
+func TestDatagramReplay(t *testing.T) {
+	configs := testConfigs(2)
+	configs[0].Tokens = []string{"secret"}
+
+	server, err := New(configs[0])
+	if err != nil {
+		t.Fatalf("could not create server: %s", err)
+	}
+	server.datagrams.peers = map[string]*datagramPeer{"b": {Peer: configs[0].Peers[1].Peer}}
+
+	datagram := func(incarnation, sequence uint64, sent time.Time) *pb.Datagram {
+		msg := &pb.Datagram{Sender: "b", Incarnation: incarnation, Sequence: sequence, Timestamp: sent.UnixNano()}
+		msg.Mac = datagramMAC([]byte("secret"), msg)
+		return msg
+	}
+
+	first := datagram(10, 1, time.Now())
+	forged := datagram(10, 2, time.Now())
+	forged.Sequence = 3
+
+	tests := []struct {
+		msg    *pb.Datagram
+		accept bool
+	}{
+		{first, true},
+		{first, false},  // replayed
+		{forged, false}, // sequence not covered by the mac
+		{datagram(10, 2, time.Now().Add(-time.Hour)), false}, // stale
+		{datagram(10, 2, time.Now().Add(time.Hour)), false},  // from the future
+		{datagram(10, 2, time.Now()), true},
+		{datagram(10, 2, time.Now()), false},  // sequence regression
+		{datagram(9, 100, time.Now()), false}, // previous incarnation
+		{datagram(11, 1, time.Now()), true},   // restarted
+	}
+
+	for i, tt := range tests {
+		if err = server.receiveDatagram(tt.msg); (err == nil) != tt.accept {
+			t.Errorf("datagram %d: expected accept %t, got %v", i, tt.accept, err)
+		}
+	}
+
+	if m := server.Datagrams()["b"]; !m.Alive || m.Received != 1 || m.Lost != 0 {
+		t.Errorf("expected one datagram from the restarted peer, got %+v", m)
+	}
+}